@@ -2,65 +2,149 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"os/signal"
+	"sync"
 	"syscall"
-	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 
+	"apatit/internal/api"
+	"apatit/internal/backfill"
+	"apatit/internal/cache"
 	"apatit/internal/client"
 	"apatit/internal/config"
+	"apatit/internal/discovery"
 	"apatit/internal/exporter"
+	"apatit/internal/health"
+	"apatit/internal/history"
 	"apatit/internal/log"
+	"apatit/internal/otlp"
+	"apatit/internal/remotewrite"
 	"apatit/internal/scheduler"
 	"apatit/internal/server"
+	"apatit/internal/sink"
+	"apatit/internal/state"
 	"apatit/internal/translator"
 )
 
-// createExporters creates and returns a list of exporters for the specified tasks.
-func createExporters(apiClient *client.Client, cfg *config.Config) ([]*exporter.Exporter, error) {
-	exportersLog := logrus.WithField("component", "initializer")
-	exportersLog.Infof("Creating exporters for %d tasks...", len(cfg.TaskIDs))
+// exporterConfig builds the exporter configuration for the task:
+// global options with the task overrides from the config file applied.
+func exporterConfig(cfg *config.Config) func(taskID int) *exporter.Config {
+	return func(taskID int) *exporter.Config {
+		expConfig := &exporter.Config{
+			TaskID:                   taskID,
+			EngMPNames:               cfg.EngMPNames,
+			ApiUpdateDelay:           cfg.ApiUpdateDelay,
+			ApiDataTimeStep:          cfg.ApiDataTimeStep,
+			MaxAllowedStalenessSteps: cfg.MaxAllowedStalenessSteps,
+		}
+
+		taskCfg := cfg.TaskConfig(taskID)
+		if taskCfg.EngMPNames != nil {
+			expConfig.EngMPNames = *taskCfg.EngMPNames
+		}
+		if taskCfg.ApiUpdateDelay != nil {
+			expConfig.ApiUpdateDelay = *taskCfg.ApiUpdateDelay
+		}
+		if taskCfg.ApiDataTimeStep != nil {
+			expConfig.ApiDataTimeStep = *taskCfg.ApiDataTimeStep
+		}
+		if taskCfg.MaxAllowedStalenessSteps != nil {
+			expConfig.MaxAllowedStalenessSteps = *taskCfg.MaxAllowedStalenessSteps
+		}
+		expConfig.Labels = taskCfg.Labels
+
+		return expConfig
+	}
+}
 
-	exporters := make([]*exporter.Exporter, 0, len(cfg.TaskIDs))
+// createExporters creates the registry of exporters for the specified and discovered tasks.
+// Saved tasks info (nil if absent) is used if the API is unavailable.
+func createExporters(ctx context.Context, apiClient *client.Client, cfg *config.Config, savedTasks []*client.TaskInfo) (*exporter.Registry, error) {
+	exportersLog := logrus.WithField("component", "initializer")
 
 	// get account tasks
-	tasks, err := apiClient.GetAllTasks()
+	tasks, err := apiClient.GetAllTasks(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tasks metadata: %w", err)
+		if savedTasks == nil {
+			return nil, fmt.Errorf("failed to get tasks metadata: %w", err)
+		}
+		exportersLog.WithField("error", err).Warn("Failed to get tasks metadata, using saved tasks info")
+		tasks = savedTasks
 	}
 
-	// get all available monitoring points
-	mps, err := apiClient.GetMPs()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get MPs metadata: %w", err)
+	taskIDs := discovery.SelectTasks(tasks, cfg)
+	exportersLog.Infof("Creating exporters for %d tasks...", len(taskIDs))
+
+	registry := exporter.NewRegistry(apiClient, exporterConfig(cfg))
+	registry.Sync(taskIDs, tasks)
+	prometheus.MustRegister(registry, exporter.NewCollector(registry))
+
+	if registry.Len() == 0 {
+		if !cfg.Discovery {
+			return nil, fmt.Errorf("no exporters were created, check task IDs and API key")
+		}
+		exportersLog.Warn("No tasks matched discovery rules, waiting for the next discovery run.")
 	}
 
-	// create exporter for each task
-	for _, taskID := range cfg.TaskIDs {
+	exportersLog.Infof("Successfully created %d exporters.", registry.Len())
+	return registry, nil
+}
 
-		expConfig := &exporter.Config{
-			TaskID:          taskID,
-			EngMPNames:      cfg.EngMPNames,
-			ApiUpdateDelay:  cfg.ApiUpdateDelay,
-			ApiDataTimeStep: cfg.ApiDataTimeStep,
+// createSinks creates enabled sinks of MP samples.
+func createSinks(cfg *config.Config) ([]sink.Sink, error) {
+	sinks := make([]sink.Sink, 0)
+	batchConfig := &sink.BatchConfig{
+		Size:          cfg.SinkBatchSize,
+		FlushInterval: cfg.SinkFlushInterval,
+		MaxRetries:    cfg.SinkMaxRetries,
+	}
+
+	if cfg.RemoteWriteURL != "" {
+		remoteWriter, err := remotewrite.New(&remotewrite.Config{
+			URL:       cfg.RemoteWriteURL,
+			QueueDir:  cfg.RemoteWriteQueueDir,
+			QueueSize: cfg.RemoteWriteQueueSize,
+			Timeout:   cfg.RemoteWriteTimeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote writer: %w", err)
 		}
+		sinks = append(sinks, remoteWriter)
+	}
 
-		exp, err := exporter.New(expConfig, apiClient, tasks, mps)
+	if cfg.InfluxDBURL != "" {
+		influxDB, err := sink.NewInfluxDB(&sink.InfluxDBConfig{
+			URL:      cfg.InfluxDBURL,
+			Version:  cfg.InfluxDBVersion,
+			Database: cfg.InfluxDBDatabase,
+			Org:      cfg.InfluxDBOrg,
+			Token:    cfg.InfluxDBToken,
+			Timeout:  cfg.SinkTimeout,
+		})
 		if err != nil {
-			exportersLog.Errorf("Unable to create exporter for TaskID %d: %v", taskID, err)
-			continue
+			return nil, fmt.Errorf("failed to create InfluxDB sink: %w", err)
 		}
-		exporters = append(exporters, exp)
+		sinks = append(sinks, sink.NewBatcher("influxdb", influxDB, batchConfig))
 	}
 
-	if len(exporters) == 0 {
-		return nil, fmt.Errorf("no exporters were created, check task IDs and API key")
+	if cfg.GraphiteAddress != "" {
+		graphite, err := sink.NewGraphite(&sink.GraphiteConfig{
+			Address: cfg.GraphiteAddress,
+			Prefix:  cfg.GraphitePrefix,
+			Timeout: cfg.SinkTimeout,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Graphite sink: %w", err)
+		}
+		sinks = append(sinks, sink.NewBatcher("graphite", graphite, batchConfig))
 	}
 
-	exportersLog.Infof("Successfully created %d exporters.", len(exporters))
-	return exporters, nil
+	return sinks, nil
 }
 
 func main() {
@@ -72,7 +156,7 @@ func main() {
 		logrus.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	app, err := newApp(cfg)
+	app, err := newApp(ctx, cfg)
 	if err != nil {
 		logrus.Fatalf("Application initialization failed: %v", err)
 	}
@@ -83,12 +167,21 @@ func main() {
 }
 
 type application struct {
-	cfg       *config.Config
-	exporters []*exporter.Exporter
-	stop      chan struct{}
+	cfgs      *config.Holder
+	apiClient *client.Client
+	exporters *exporter.Registry
+	server    *server.Server
+	// sinks receive new MP samples, see createSinks
+	sinks []sink.Sink
+	// otlpExporter is nil if OTLP export is disabled
+	otlpExporter *otlp.Exporter
+	// stateStore is nil if the state is disabled
+	stateStore *state.Store
+	tracker    *health.Tracker
+	reloadMu   sync.Mutex
 }
 
-func newApp(cfg *config.Config) (*application, error) {
+func newApp(ctx context.Context, cfg *config.Config) (*application, error) {
 	// Set logger for components
 	log.Init(cfg.LogLevel)
 
@@ -98,44 +191,254 @@ func newApp(cfg *config.Config) (*application, error) {
 	}
 
 	// Create API client
-	apiClient := client.New(cfg.APIKey, nil, cfg.RequestDelay, cfg.RequestRetries, cfg.MaxRequestsPerSecond)
+	httpClient, err := client.NewHTTPClient(&client.TransportConfig{
+		ProxyURL:          cfg.APIProxyURL,
+		CAFile:            cfg.APICAFile,
+		Timeout:           cfg.APITimeout,
+		RecordDir:         cfg.APIRecordDir,
+		RecordMaxFixtures: cfg.APIRecordMaxFixtures,
+		ReplayDir:         cfg.APIReplayDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+
+	endpointLimits := make(map[string]client.EndpointLimit, len(cfg.APIEndpointLimits))
+	for sa, limit := range cfg.APIEndpointLimits {
+		endpointLimits[sa] = client.EndpointLimit{RequestsPerSecond: limit.RequestsPerSecond, Burst: limit.Burst}
+	}
+	apiClient, err := client.New(&client.Config{
+		APIKey:                  cfg.APIKey,
+		Endpoint:                cfg.APIEndpoint,
+		RequestDelay:            cfg.RequestDelay,
+		RequestRetries:          cfg.RequestRetries,
+		RequestTimeout:          cfg.APITimeout,
+		MaxRequestsPerSecond:    cfg.MaxRequestsPerSecond,
+		Burst:                   cfg.APIBurst,
+		EndpointLimits:          endpointLimits,
+		DailyQuota:              cfg.APIDailyQuota,
+		CircuitFailureThreshold: cfg.APICircuitThreshold,
+		CircuitOpenDuration:     cfg.APICircuitOpenDuration,
+	}, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API client: %w", err)
+	}
 
 	// Register metrics, set ServiceInfo metric
 	exporter.RegisterMetrics()
+	client.RegisterMetrics()
 	exporter.AServiceInfo.Set(1)
 
+	// Open state store of the previous run
+	var stateStore *state.Store
+	if cfg.StateDir != "" {
+		stateStore, err = state.Open(cfg.StateDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open state store: %w", err)
+		}
+	}
+
 	// Create Exporters for each task
-	exporters, err := createExporters(apiClient, cfg)
+	var savedTasks []*client.TaskInfo
+	if stateStore != nil {
+		savedTasks = stateStore.State().Tasks
+	}
+	exporters, err := createExporters(ctx, apiClient, cfg, savedTasks)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create exporters: %w", err)
 	}
 
-	return &application{
-		cfg:       cfg,
-		exporters: exporters,
-		stop:      make(chan struct{}),
-	}, nil
+	// Create sinks of MP samples
+	sinks, err := createSinks(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sinks: %w", err)
+	}
+
+	// Create OTLP exporter, it exports the same metrics as /metrics endpoint
+	var otlpExporter *otlp.Exporter
+	if cfg.OTLPEndpoint != "" {
+		otlpExporter, err = otlp.New(&otlp.Config{
+			Endpoint: cfg.OTLPEndpoint,
+			Headers:  cfg.OTLPHeaders,
+			Account:  cfg.OTLPAccount,
+			Interval: cfg.OTLPInterval,
+			Timeout:  cfg.OTLPTimeout,
+		}, prometheus.DefaultGatherer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+	}
+
+	// Create HTTP server, TLS and authentication are set by the web config
+	srv, err := server.New(cfg.ListenAddress, cfg.WebConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP server: %w", err)
+	}
+
+	app := &application{
+		cfgs:         config.NewHolder(cfg),
+		apiClient:    apiClient,
+		exporters:    exporters,
+		server:       srv,
+		sinks:        sinks,
+		otlpExporter: otlpExporter,
+		stateStore:   stateStore,
+		tracker:      health.NewTracker(),
+	}
+	app.server.Handle("/-/reload", server.ReloadHandler(app.reload))
+	app.server.Handle("/healthz", health.LiveHandler())
+	app.server.Handle("/readyz", health.ReadyHandler(app.tracker, app.cfgs))
+	app.server.Handle("/status", health.StatusHandler(app.tracker, app.exporters, app.cfgs))
+	app.server.Handle(api.Prefix, api.Handler(app.exporters))
+
+	// Create local history store, it is a sink too
+	if cfg.HistoryDir != "" {
+		store, err := history.Open(&history.Config{
+			Dir:       cfg.HistoryDir,
+			Retention: cfg.HistoryRetention,
+			MaxPoints: cfg.HistoryMaxPoints,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open history store: %w", err)
+		}
+		app.sinks = append(app.sinks, store)
+		app.server.Handle("/api/v1/history", history.Handler(store))
+	}
+
+	// Restore the data of the previous run
+	if stateStore != nil {
+		restoreState(stateStore.State(), exporters)
+	}
+
+	return app, nil
+}
+
+// restoreState serves the saved state until the first refresh cycles are finished.
+// Restored MP metrics are flagged by apatit_exporter_state_restored,
+// restored JSON responses by the restored data header, see cache.RestoredHeader.
+func restoreState(st *state.State, exporters *exporter.Registry) {
+	if st.SavedAt.IsZero() {
+		return
+	}
+
+	if st.Tasks != nil {
+		allTasksJSON, err := json.Marshal(st.Tasks)
+		if err != nil {
+			logrus.Errorf("Failed to marshal restored tasks info to JSON: %v", err)
+		} else {
+			cache.AllTasksInfoCache.RestoreCache(allTasksJSON, st.SavedAt)
+		}
+	}
+	var stats []*client.TaskStatEntry
+	if st.TaskData != nil {
+		cache.TaskDataCache.RestoreCache(st.TaskData, st.SavedAt)
+		if err := json.Unmarshal(st.TaskData, &stats); err != nil {
+			logrus.Errorf("Failed to unmarshal restored task stats: %v", err)
+		}
+	}
+	cache.Data.Restore(st.Tasks, stats, st.MPs, st.SavedAt)
+
+	tasksByID := make(map[int]*client.TaskInfo, len(st.Tasks))
+	for _, task := range st.Tasks {
+		tasksByID[task.ID] = task
+	}
+	for _, e := range exporters.Exporters() {
+		taskID := e.Config().TaskID
+		if task, ok := tasksByID[taskID]; ok {
+			e.UpdateTaskMetrics(task)
+		}
+		if entries, ok := st.Entries[taskID]; ok {
+			e.RestoreMetrics(entries, st.MPs)
+		}
+	}
+	logrus.WithField("saved_at", st.SavedAt).Info("State restored")
 }
 
 func (a *application) Run(ctx context.Context) error {
+	// Schedulers and HTTP server stop once ctx is canceled
+	var wg sync.WaitGroup
+
 	// Run HTTP server
-	go server.StartServer(a.cfg.ListenAddress)
+	serverErr := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serverErr <- a.server.Run(ctx)
+	}()
 
 	// Task Statistic Loop
-	go scheduler.RunStatsScheduler(a.exporters, a.cfg, a.stop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.RunStatsScheduler(ctx, a.apiClient, a.exporters, a.cfgs, a.stateStore, a.tracker)
+	}()
+
+	// Historical Backfill and Exporter Metrics Loop
+	// history is pushed to sinks before the first live samples,
+	// as remote write endpoints reject samples older than the latest one of the series
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if cfg := a.cfgs.Get(); cfg.BackfillWindow > 0 {
+			if err := backfill.Run(ctx, a.apiClient, a.exporters, cfg.BackfillWindow, cfg.RequestDelay, cfg.BackfillFile, a.sinks); err != nil {
+				logrus.Errorf("Backfill failed: %v", err)
+			}
+		}
+		scheduler.RunMetricsScheduler(ctx, a.apiClient, a.exporters, a.cfgs, a.sinks, a.stateStore, a.tracker)
+	}()
 
-	// Exporter Metrics Loop
-	go scheduler.RunMetricsScheduler(a.exporters, a.cfg, a.stop)
+	// Sinks Loops
+	for _, s := range a.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(ctx)
+		}()
+	}
 
-	logrus.Info("Exporters are running. Press Ctrl+C to exit.")
+	// OTLP Export Loop
+	if a.otlpExporter != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.otlpExporter.Run(ctx)
+		}()
+	}
+
+	// Tasks Discovery Loop
+	if a.cfgs.Get().Discovery {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.RunDiscoveryScheduler(ctx, a.apiClient, a.exporters, a.cfgs)
+		}()
+	}
+
+	// Reload config on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-	// Stop goroutines once context is canceled
-	<-ctx.Done()
+	logrus.Info("Exporters are running. Press Ctrl+C to exit.")
 
-	logrus.Info("Shutdown signal received. Stopping schedulers...")
-	close(a.stop)
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			logrus.Info("Shutdown signal received. Stopping schedulers...")
+			running = false
+		case err := <-serverErr:
+			if err != nil {
+				return fmt.Errorf("HTTP server failed: %w", err)
+			}
+		case <-hup:
+			if err := a.reload(ctx); err != nil {
+				logrus.Errorf("Failed to reload config: %v", err)
+			}
+		}
+	}
 
-	time.Sleep(2 * time.Second)
+	// Wait for schedulers to abort their cycles and for the HTTP server to shut down
+	wg.Wait()
 
 	logrus.Info("Shutdown complete. Bye!")
 	return nil
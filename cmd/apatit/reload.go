@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/config"
+	"apatit/internal/discovery"
+	"apatit/internal/log"
+	"apatit/internal/translator"
+)
+
+// reload re-reads the config and translations, then reconciles running exporters:
+// exporters are added, removed and reconfigured without restarting the HTTP server or schedulers.
+// The running config is kept if the new one can't be loaded.
+// If tasks metadata can't be requested, the new config and translations are applied,
+// but the set of running exporters is kept until the next reload or discovery run.
+func (a *application) reload(ctx context.Context) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	reloadLog := logrus.WithField("component", "reloader")
+	reloadLog.Info("Reloading config...")
+
+	cfg, err := config.New()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	keepNonReloadable(a.cfgs.Get(), cfg)
+
+	// local files are reloaded even if the API is unavailable
+	log.SetLevel(cfg.LogLevel)
+
+	if err := translator.Init(cfg.LocationsFilePath); err != nil {
+		reloadLog.Warnf("Failed to reload translator, previous translations are kept: %v", err)
+	}
+
+	a.exporters.SetConfigFor(exporterConfig(cfg))
+	a.cfgs.Set(cfg)
+
+	// without tasks metadata the running exporters are only reconfigured, the set of tasks is kept
+	tasks, err := a.apiClient.GetAllTasks(ctx)
+	if err != nil {
+		a.exporters.Reconfigure()
+		return fmt.Errorf("config reloaded, but exporters were not synced: failed to get tasks metadata: %w", err)
+	}
+	added, removed := a.exporters.Sync(discovery.SelectTasks(tasks, cfg), tasks)
+
+	reloadLog.WithFields(logrus.Fields{
+		"added":     added,
+		"removed":   removed,
+		"exporters": a.exporters.Len(),
+	}).Info("Config reloaded successfully.")
+	return nil
+}
+
+// keepNonReloadable sets options which can't be changed without restart to their running values.
+func keepNonReloadable(running, loaded *config.Config) {
+	keep("api_key", running.APIKey, &loaded.APIKey)
+	keep("api_endpoint", running.APIEndpoint, &loaded.APIEndpoint)
+	keep("api_proxy_url", running.APIProxyURL, &loaded.APIProxyURL)
+	keep("api_ca_file", running.APICAFile, &loaded.APICAFile)
+	keep("api_timeout", running.APITimeout, &loaded.APITimeout)
+	keep("request_delay", running.RequestDelay, &loaded.RequestDelay)
+	keep("request_retries", running.RequestRetries, &loaded.RequestRetries)
+	keep("max_requests_per_second", running.MaxRequestsPerSecond, &loaded.MaxRequestsPerSecond)
+	keep("api_burst", running.APIBurst, &loaded.APIBurst)
+	keepMap("api_endpoint_limits", running.APIEndpointLimits, &loaded.APIEndpointLimits)
+	keep("api_daily_quota", running.APIDailyQuota, &loaded.APIDailyQuota)
+	keep("api_circuit_failure_threshold", running.APICircuitThreshold, &loaded.APICircuitThreshold)
+	keep("api_circuit_open_duration", running.APICircuitOpenDuration, &loaded.APICircuitOpenDuration)
+	keep("record_dir", running.APIRecordDir, &loaded.APIRecordDir)
+	keep("record_max_fixtures", running.APIRecordMaxFixtures, &loaded.APIRecordMaxFixtures)
+	keep("replay_dir", running.APIReplayDir, &loaded.APIReplayDir)
+	keep("listen_address", running.ListenAddress, &loaded.ListenAddress)
+	keep("web_config_file", running.WebConfigFile, &loaded.WebConfigFile)
+	keep("refresh_interval", running.RefreshInterval, &loaded.RefreshInterval)
+	keep("discovery", running.Discovery, &loaded.Discovery)
+	keep("discovery_interval", running.DiscoveryInterval, &loaded.DiscoveryInterval)
+	keep("remote_write_url", running.RemoteWriteURL, &loaded.RemoteWriteURL)
+	keep("remote_write_queue_dir", running.RemoteWriteQueueDir, &loaded.RemoteWriteQueueDir)
+	keep("remote_write_queue_size", running.RemoteWriteQueueSize, &loaded.RemoteWriteQueueSize)
+	keep("remote_write_timeout", running.RemoteWriteTimeout, &loaded.RemoteWriteTimeout)
+	keep("otlp_endpoint", running.OTLPEndpoint, &loaded.OTLPEndpoint)
+	keepMap("otlp_headers", running.OTLPHeaders, &loaded.OTLPHeaders)
+	keep("otlp_account", running.OTLPAccount, &loaded.OTLPAccount)
+	keep("otlp_interval", running.OTLPInterval, &loaded.OTLPInterval)
+	keep("otlp_timeout", running.OTLPTimeout, &loaded.OTLPTimeout)
+	keep("influxdb_url", running.InfluxDBURL, &loaded.InfluxDBURL)
+	keep("influxdb_version", running.InfluxDBVersion, &loaded.InfluxDBVersion)
+	keep("influxdb_database", running.InfluxDBDatabase, &loaded.InfluxDBDatabase)
+	keep("influxdb_org", running.InfluxDBOrg, &loaded.InfluxDBOrg)
+	keep("influxdb_token", running.InfluxDBToken, &loaded.InfluxDBToken)
+	keep("graphite_address", running.GraphiteAddress, &loaded.GraphiteAddress)
+	keep("graphite_prefix", running.GraphitePrefix, &loaded.GraphitePrefix)
+	keep("sink_batch_size", running.SinkBatchSize, &loaded.SinkBatchSize)
+	keep("sink_flush_interval", running.SinkFlushInterval, &loaded.SinkFlushInterval)
+	keep("sink_max_retries", running.SinkMaxRetries, &loaded.SinkMaxRetries)
+	keep("sink_timeout", running.SinkTimeout, &loaded.SinkTimeout)
+	keep("history_dir", running.HistoryDir, &loaded.HistoryDir)
+	keep("history_retention", running.HistoryRetention, &loaded.HistoryRetention)
+	keep("history_max_points", running.HistoryMaxPoints, &loaded.HistoryMaxPoints)
+	keep("state_dir", running.StateDir, &loaded.StateDir)
+}
+
+// keep sets the loaded option to its running value and warns if it was changed.
+func keep[T comparable](name string, running T, loaded *T) {
+	if *loaded != running {
+		logrus.WithField("option", name).Warn("Option can't be changed without restart, running value is kept")
+		*loaded = running
+	}
+}
+
+// keepMap is keep for map options.
+func keepMap[K, V comparable](name string, running map[K]V, loaded *map[K]V) {
+	if !maps.Equal(*loaded, running) {
+		logrus.WithField("option", name).Warn("Option can't be changed without restart, running value is kept")
+		*loaded = running
+	}
+}
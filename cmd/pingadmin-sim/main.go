@@ -0,0 +1,81 @@
+// Command pingadmin-sim runs a Ping-Admin API simulator for local development.
+// Point APATIT at it with '--api-endpoint=http://localhost:8081'.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/log"
+	"apatit/internal/testing/fakeapi"
+)
+
+func main() {
+	listenAddress := flag.String("listen-address", ":8081", "Address to listen on for HTTP requests")
+	scenarioPath := flag.String("scenario", "cmd/pingadmin-sim/scenario.example.json", "Path to the scenario JSON file")
+	latency := flag.Duration("latency", 0, "Latency added to every response (overrides scenario)")
+	errorRate := flag.Float64("error-rate", 0, "Share (0..1) of requests answered with 503 (overrides scenario)")
+	rateLimit := flag.Int("rate-limit", 0, "Maximum number of requests per second, 0 disables the limit (overrides scenario)")
+	rateLimitPayload := flag.Bool("rate-limit-payload", false, "Answer limited requests with HTTP 200 and an error payload instead of 429 (overrides scenario)")
+	staleOffset := flag.Duration("stale-offset", 0, "Shift all data timestamps into the past (overrides scenario)")
+	mpsDown := flag.String("mps-down", "", "Comma-separated list of MP IDs to mark as unavailable")
+	logLevel := flag.String("log-level", "info", "Log level (e.g., debug, info, warn, error)")
+	flag.Parse()
+
+	log.Init(*logLevel)
+
+	scenario, err := fakeapi.LoadScenario(*scenarioPath)
+	if err != nil {
+		logrus.Fatalf("Failed to load scenario: %v", err)
+	}
+
+	// flags override scenario knobs only when they are set explicitly,
+	// the rate limit flags are merged into the scenario limit one by one
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "latency":
+			scenario.Latency = fakeapi.Duration(*latency)
+		case "error-rate":
+			scenario.ErrorRate = *errorRate
+		case "rate-limit":
+			scenario.RateLimit.MaxRequestsPerSecond = *rateLimit
+		case "rate-limit-payload":
+			scenario.RateLimit.Payload = *rateLimitPayload
+		case "stale-offset":
+			scenario.StaleOffset = fakeapi.Duration(*staleOffset)
+		}
+	})
+	sim := fakeapi.New(scenario)
+	for _, id := range strings.Split(*mpsDown, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			sim.SetMPDown(id, true)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: *listenAddress, Handler: sim}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logrus.WithFields(logrus.Fields{
+		"address":  *listenAddress,
+		"scenario": *scenarioPath,
+	}).Info("Starting Ping-Admin API simulator")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logrus.Fatalf("Failed to start HTTP server: %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/cache"
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+)
+
+const (
+	// Prefix is the path prefix of the REST API
+	Prefix = "/api/v1/"
+	// defaultLimit is the page size if 'limit' parameter is absent
+	defaultLimit = 100
+	// maxLimit is the maximum page size
+	maxLimit = 1000
+)
+
+// openAPI is the OpenAPI document of the REST API
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// openAPIEntry is the compressed OpenAPI document, it has no modification time as it is embedded
+var openAPIEntry = cache.NewEntry(openAPI, time.Time{})
+
+// Page is a paginated list response.
+type Page[T any] struct {
+	Items  []T `json:"items"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// Error is an error response.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Handler handles REST API requests, it is registered at Prefix.
+// Data is taken from the cache and the running exporters of the registry,
+// responses are flagged by cache.RestoredHeader while any cached data is restored from the saved state.
+func Handler(registry *exporter.Registry) http.Handler {
+	h := &handler{registry: registry}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/tasks", h.listTasks)
+	mux.HandleFunc("GET /api/v1/tasks/{id}", h.getTask)
+	mux.HandleFunc("GET /api/v1/tasks/{id}/events", h.listTaskEvents)
+	mux.HandleFunc("GET /api/v1/tasks/{id}/mps", h.listTaskMPs)
+	mux.HandleFunc("GET /api/v1/mps", h.listMPs)
+	mux.HandleFunc("GET /api/v1/mps/{id}", h.getMP)
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		cache.Serve(w, r, openAPIEntry)
+	})
+	mux.HandleFunc("GET "+Prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "resource not found")
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cache.Data.Restored() {
+			w.Header().Set(cache.RestoredHeader, "true")
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+type handler struct {
+	registry *exporter.Registry
+}
+
+// listTasks handles 'GET /api/v1/tasks?limit=&offset=' requests with all account tasks.
+func (h *handler) listTasks(w http.ResponseWriter, r *http.Request) {
+	tasks, updatedAt := cache.Data.Tasks()
+	if updatedAt.IsZero() {
+		writeError(w, http.StatusServiceUnavailable, "tasks info is not available yet")
+		return
+	}
+
+	items := make([]*Task, 0, len(tasks))
+	for _, task := range tasks {
+		_, exported := h.registry.Get(task.ID)
+		items = append(items, newTask(task, exported))
+	}
+	writePage(w, r, items, time.Time{})
+}
+
+// getTask handles 'GET /api/v1/tasks/{id}' requests.
+func (h *handler) getTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, updatedAt := cache.Data.Tasks()
+	if updatedAt.IsZero() {
+		writeError(w, http.StatusServiceUnavailable, "tasks info is not available yet")
+		return
+	}
+
+	for _, task := range tasks {
+		if task.ID == taskID {
+			_, exported := h.registry.Get(task.ID)
+			writeResource(w, r, newTask(task, exported), time.Time{})
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("task %d not found", taskID))
+}
+
+// listTaskEvents handles 'GET /api/v1/tasks/{id}/events?since=&status=&mp_id=&limit=&offset=' requests.
+// Events of the exported tasks only are available, the latest ones go first.
+func (h *handler) listTaskEvents(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	var since time.Time
+	if s := query.Get("since"); s != "" {
+		var err error
+		if since, err = parseTime(s); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid 'since' parameter: "+err.Error())
+			return
+		}
+	}
+	var status *int64
+	if s := query.Get("status"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid 'status' parameter: must be an integer")
+			return
+		}
+		status = &v
+	}
+	mpID := query.Get("mp_id")
+
+	if _, exported := h.registry.Get(taskID); !exported {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("task %d is not exported", taskID))
+		return
+	}
+	stats, ok := cache.Data.TaskStats(taskID)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("stats of task %d are not available yet", taskID))
+		return
+	}
+
+	items := make([]*Event, 0, len(stats.TaskLogs))
+	for _, log := range stats.TaskLogs {
+		if !since.IsZero() && log.Timestamp.Before(since) {
+			continue
+		}
+		if status != nil && log.Status != *status {
+			continue
+		}
+		if mpID != "" && log.MPID != mpID {
+			continue
+		}
+		items = append(items, newEvent(log))
+	}
+	slices.SortStableFunc(items, func(a, b *Event) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	writePage(w, r, items, stats.Timestamp)
+}
+
+// listTaskMPs handles 'GET /api/v1/tasks/{id}/mps?limit=&offset=' requests with the latest task measurements.
+func (h *handler) listTaskMPs(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	e, exported := h.registry.Get(taskID)
+	if !exported {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("task %d is not exported", taskID))
+		return
+	}
+	entries := e.Entries()
+	if entries == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("MP data of task %d is not available yet", taskID))
+		return
+	}
+
+	mps, _ := cache.Data.MPs()
+	mpsByID := make(map[string]*client.MonitoringPointInfo, len(mps))
+	for _, mp := range mps {
+		mpsByID[mp.ID] = mp
+	}
+
+	items := make([]*TaskMP, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, newTaskMP(entry, mpsByID[entry.ID]))
+	}
+	writePage(w, r, items, time.Time{})
+}
+
+// listMPs handles 'GET /api/v1/mps?limit=&offset=' requests with all monitoring points.
+func (h *handler) listMPs(w http.ResponseWriter, r *http.Request) {
+	mps, updatedAt := cache.Data.MPs()
+	if updatedAt.IsZero() {
+		writeError(w, http.StatusServiceUnavailable, "monitoring points info is not available yet")
+		return
+	}
+
+	items := make([]*MP, 0, len(mps))
+	for _, mp := range mps {
+		items = append(items, newMP(mp))
+	}
+	writePage(w, r, items, updatedAt)
+}
+
+// getMP handles 'GET /api/v1/mps/{id}' requests.
+func (h *handler) getMP(w http.ResponseWriter, r *http.Request) {
+	mpID := r.PathValue("id")
+
+	mps, updatedAt := cache.Data.MPs()
+	if updatedAt.IsZero() {
+		writeError(w, http.StatusServiceUnavailable, "monitoring points info is not available yet")
+		return
+	}
+
+	for _, mp := range mps {
+		if mp.ID == mpID {
+			writeResource(w, r, newMP(mp), updatedAt)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("monitoring point %q not found", mpID))
+}
+
+// pathID parses the task ID path value, it writes the error response if the ID is invalid.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid task ID: must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
+// parseTime parses a unix timestamp or RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be a unix timestamp or RFC 3339 time")
+	}
+	return t, nil
+}
+
+// writePage writes the page of items selected by 'limit' and 'offset' parameters, see writeResource.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, modTime time.Time) {
+	query := r.URL.Query()
+
+	limit := defaultLimit
+	if s := query.Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 || v > maxLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid 'limit' parameter: must be between 1 and %d", maxLimit))
+			return
+		}
+		limit = v
+	}
+	offset := 0
+	if s := query.Get("offset"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			writeError(w, http.StatusBadRequest, "invalid 'offset' parameter: must be a non-negative integer")
+			return
+		}
+		offset = v
+	}
+
+	// offset is clamped before adding limit, so a huge offset can't overflow
+	start := min(offset, len(items))
+	page := &Page[T]{
+		Items:  items[start : start+min(limit, len(items)-start)],
+		Total:  len(items),
+		Limit:  limit,
+		Offset: offset,
+	}
+	writeResource(w, r, page, modTime)
+}
+
+// writeResource writes a successful response with ETag and compression, see cache.ServeJSON.
+// modTime is the update time of the source data, it is zero if the resource depends on data without one.
+func writeResource(w http.ResponseWriter, r *http.Request, v any, modTime time.Time) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		logrus.Errorf("Failed to encode response: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	cache.ServeJSON(w, r, buf.Bytes(), modTime)
+}
+
+// writeError writes an error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &Error{Error: message})
+}
+
+// writeJSON writes a JSON response with the status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWritePage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   []int
+	}{
+		{name: "default page", query: "", status: http.StatusOK, want: []int{1, 2, 3, 4, 5}},
+		{name: "limit and offset", query: "?limit=2&offset=1", status: http.StatusOK, want: []int{2, 3}},
+		{name: "last page", query: "?limit=2&offset=4", status: http.StatusOK, want: []int{5}},
+		{name: "offset past the end", query: "?offset=10", status: http.StatusOK, want: []int{}},
+		{name: "huge offset", query: "?limit=1000&offset=" + strconv.Itoa(math.MaxInt), status: http.StatusOK, want: []int{}},
+		{name: "negative offset", query: "?offset=-1", status: http.StatusBadRequest},
+		{name: "zero limit", query: "?limit=0", status: http.StatusBadRequest},
+		{name: "limit above maximum", query: "?limit=1001", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writePage(w, httptest.NewRequest(http.MethodGet, "/api/v1/tasks"+tt.query, nil), items, time.Time{})
+
+			if w.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var page Page[int]
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != len(items) {
+				t.Errorf("got total %d, want %d", page.Total, len(items))
+			}
+			if len(page.Items) != len(tt.want) {
+				t.Fatalf("got items %v, want %v", page.Items, tt.want)
+			}
+			for i := range tt.want {
+				if page.Items[i] != tt.want[i] {
+					t.Errorf("got items %v, want %v", page.Items, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
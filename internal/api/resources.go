@@ -0,0 +1,137 @@
+package api
+
+import (
+	"time"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+)
+
+// Task is a Ping-Admin monitoring task.
+type Task struct {
+	ID                      int    `json:"id"`
+	Name                    string `json:"name"`
+	URL                     string `json:"url"`
+	Type                    string `json:"type"`
+	Enabled                 bool   `json:"enabled"`
+	Up                      bool   `json:"up"`
+	Blacklisted             bool   `json:"blacklisted"`
+	VirusDetected           bool   `json:"virus_detected"`
+	CheckPeriodMinutes      int    `json:"check_period_minutes"`
+	ErrorCheckPeriodMinutes int    `json:"error_check_period_minutes"`
+	// UptimeRatio is nil if the uptime is unknown
+	UptimeRatio      *float64  `json:"uptime_ratio"`
+	LastCheck        time.Time `json:"last_check,omitzero"`
+	LastStatusChange time.Time `json:"last_status_change,omitzero"`
+	// Exported is true if APATIT exports metrics of the task
+	Exported  bool      `json:"exported"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Event is a task check event from the task stats.
+type Event struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Status      int64     `json:"status"`
+	Description string    `json:"description"`
+	MPID        string    `json:"mp_id"`
+	MPName      string    `json:"mp_name"`
+	Traceroute  string    `json:"traceroute,omitempty"`
+}
+
+// MP is a Ping-Admin monitoring point.
+type MP struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	GPS       string `json:"gps"`
+	Available bool   `json:"available"`
+}
+
+// Measurement is the latest measurement of a task by an MP.
+type Measurement struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Values are named as MP metrics without prefix, e.g. connect_seconds
+	Values map[string]float64 `json:"values"`
+}
+
+// TaskMP is an MP of a task with its latest measurement.
+type TaskMP struct {
+	MP
+	// LastMeasurement is nil if the MP has no data
+	LastMeasurement *Measurement `json:"last_measurement"`
+}
+
+// newTask converts tasks info to the resource.
+func newTask(task *client.TaskInfo, exported bool) *Task {
+	t := &Task{
+		ID:                      task.ID,
+		Name:                    task.ServiceName,
+		URL:                     task.URL,
+		Type:                    task.Type,
+		Enabled:                 task.EnabledStatus == 1,
+		Up:                      task.TaskStatus == 1,
+		Blacklisted:             task.BlackListStatus != 0,
+		VirusDetected:           task.VirusStatus != 0,
+		CheckPeriodMinutes:      task.Period,
+		ErrorCheckPeriodMinutes: task.PeriodError,
+		LastCheck:               task.LastCheck,
+		LastStatusChange:        task.LastStatusChange,
+		Exported:                exported,
+		UpdatedAt:               task.Timestamp,
+	}
+	if total := task.UptimeW + task.UptimeNw; total > 0 {
+		ratio := float64(task.UptimeW) / float64(total)
+		t.UptimeRatio = &ratio
+	}
+	return t
+}
+
+// newEvent converts a task log to the resource.
+func newEvent(log *client.TaskLog) *Event {
+	return &Event{
+		Timestamp:   log.Timestamp,
+		Status:      log.Status,
+		Description: log.Description,
+		MPID:        log.MPID,
+		MPName:      log.MPName,
+		Traceroute:  log.Traceroute,
+	}
+}
+
+// newMP converts monitoring point info to the resource.
+func newMP(mp *client.MonitoringPointInfo) *MP {
+	return &MP{
+		ID:        mp.ID,
+		Name:      mp.Name,
+		IP:        mp.IP,
+		GPS:       mp.GPS,
+		Available: mp.Status == 1,
+	}
+}
+
+// newTaskMP converts MP data of a task to the resource, mp is nil if the MP info is unknown.
+func newTaskMP(entry *client.MonitoringPointEntry, mp *client.MonitoringPointInfo) *TaskMP {
+	taskMP := &TaskMP{MP: MP{ID: entry.ID, Name: entry.Name}}
+	if mp != nil {
+		taskMP.MP = *newMP(mp)
+	}
+
+	// the latest result is the measurement, like in MP metrics
+	var latest *client.MonitoringPointConnectionResult
+	for _, res := range entry.Result {
+		if res != nil && (latest == nil || res.Timestamp > latest.Timestamp) {
+			latest = res
+		}
+	}
+	if latest != nil {
+		values := make(map[string]float64, len(exporter.Measurements))
+		for _, m := range exporter.Measurements {
+			values[m.Field] = m.Value(latest)
+		}
+		taskMP.LastMeasurement = &Measurement{
+			Timestamp: time.Unix(latest.Timestamp, 0).UTC(),
+			Values:    values,
+		}
+	}
+	return taskMP
+}
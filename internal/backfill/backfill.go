@@ -0,0 +1,146 @@
+package backfill
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+	"apatit/internal/sink"
+	"apatit/internal/utils"
+)
+
+// Run fetches MP data history of all exporters within the window and writes it
+// to the OpenMetrics file at path, suitable for 'promtool tsdb create-blocks-from openmetrics',
+// and pushes it to the sinks (a batch per task). Empty path disables the file output.
+// Requests to the API are paused by requestDelay like the scheduler ones.
+func Run(ctx context.Context, apiClient *client.Client, registry *exporter.Registry, window, requestDelay time.Duration, path string, sinks []sink.Sink) error {
+	backfillLog := logrus.WithField("component", "backfill")
+	backfillLog.Infof("Starting backfill of the last %s...", window)
+
+	mps, err := apiClient.GetMPs(ctx)
+	if err != nil {
+		exporter.EErrorsTotal.WithLabelValues("api_client", client.ErrorType(err), "", "").Inc()
+		return fmt.Errorf("failed to get monitoring points: %w", err)
+	}
+
+	// drop points older than the window, the API returns at least one point per MP
+	from := time.Now().Add(-window).Unix()
+
+	samples := make([]*exporter.Sample, 0)
+	for _, exp := range registry.Exporters() {
+		if err := utils.RandomizedPause(ctx, requestDelay); err != nil {
+			return err
+		}
+		expSamples, err := exp.FetchHistory(ctx, window, mps)
+		if err != nil {
+			// keep history of other tasks
+			backfillLog.WithField("task_id", exp.Config().TaskID).Errorf("Failed to fetch history: %v", err)
+			continue
+		}
+
+		filtered := make([]*exporter.Sample, 0, len(expSamples))
+		for _, sample := range expSamples {
+			if sample.Result.Timestamp >= from {
+				filtered = append(filtered, sample)
+			}
+		}
+		for _, s := range sinks {
+			if err := s.Push(filtered); err != nil {
+				backfillLog.WithField("task_id", exp.Config().TaskID).Errorf("Failed to push history: %v", err)
+			}
+		}
+		// the latest data points are backfilled, so the first refresh must not push them again
+		exp.MarkSamplesSent(filtered)
+		samples = append(samples, filtered...)
+	}
+
+	if path != "" {
+		if err := writeFile(path, samples); err != nil {
+			return fmt.Errorf("failed to write backfill file '%s': %w", path, err)
+		}
+		backfillLog.Infof("%d data points were written to '%s'.", len(samples), path)
+	}
+
+	backfillLog.Infof("Backfill finished, %d data points were fetched.", len(samples))
+	return nil
+}
+
+// writeFile writes samples in OpenMetrics format, the file is replaced atomically.
+func writeFile(path string, samples []*exporter.Sample) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := writeOpenMetrics(w, samples); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeOpenMetrics writes a metric family for each measurement,
+// samples of a series are sorted by timestamp as promtool requires.
+func writeOpenMetrics(w *bufio.Writer, samples []*exporter.Sample) error {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Result.Timestamp < samples[j].Result.Timestamp
+	})
+
+	for _, m := range exporter.Measurements {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.Name, escape(m.Help, false))
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.Name)
+		for _, sample := range samples {
+			fmt.Fprintf(w, "%s{%s} %s %d\n",
+				m.Name,
+				formatLabels(sample.Labels),
+				strconv.FormatFloat(m.Value(sample.Result), 'g', -1, 64),
+				sample.Result.Timestamp)
+		}
+	}
+	_, err := w.WriteString("# EOF\n")
+	return err
+}
+
+// formatLabels formats labels sorted by name.
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escape(labels[name], true)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// escape escapes OpenMetrics help text and label values.
+func escape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
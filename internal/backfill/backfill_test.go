@@ -0,0 +1,137 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+	"apatit/internal/sink"
+	"apatit/internal/testing/fakeapi"
+)
+
+// recordingSink records pushed samples.
+type recordingSink struct {
+	mu      sync.Mutex
+	samples []*exporter.Sample
+}
+
+func (s *recordingSink) Push(samples []*exporter.Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *recordingSink) Run(ctx context.Context) {}
+
+func TestRun(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	fake := fakeapi.New(&fakeapi.Scenario{
+		DataStep: fakeapi.Duration(3 * time.Minute),
+		MPs: []*fakeapi.MP{
+			{ID: "1", Name: "Moscow"},
+			{ID: "2", Name: "Frankfurt", Down: true},
+		},
+		Tasks: []*fakeapi.Task{{
+			ID: 1001, Name: "Main site", Enabled: true, Up: true, Period: 3,
+			Graph: fakeapi.Graph{Total: 0.231, Age: fakeapi.Duration(4*time.Minute + 30*time.Second)},
+		}},
+	})
+	var clockMu sync.Mutex
+	clock := now
+	fake.SetClock(func() time.Time {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		return clock
+	})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	apiClient, err := client.New(&client.Config{Endpoint: srv.URL, RequestRetries: 1, MaxRequestsPerSecond: 100}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tasks, err := apiClient.GetAllTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := exporter.NewRegistry(apiClient, func(taskID int) *exporter.Config {
+		return &exporter.Config{
+			TaskID:                   taskID,
+			ApiUpdateDelay:           4 * time.Minute,
+			ApiDataTimeStep:          3 * time.Minute,
+			MaxAllowedStalenessSteps: 3,
+		}
+	})
+	if added, _ := registry.Sync([]int{1001}, tasks); len(added) != 1 {
+		t.Fatalf("expected 1 exporter, got %d", len(added))
+	}
+
+	path := filepath.Join(t.TempDir(), "backfill.om")
+	s := &recordingSink{}
+	if err := Run(ctx, apiClient, registry, 10*time.Minute, 0, path, []sink.Sink{s}); err != nil {
+		t.Fatalf("backfill failed: %v", err)
+	}
+
+	// the points 4m30s and 7m30s old are within the window, the down MP has no points
+	latest := now.Add(-4*time.Minute - 30*time.Second).Unix()
+	previous := latest - 180
+	if len(s.samples) != 2 {
+		t.Fatalf("expected 2 pushed samples, got %d", len(s.samples))
+	}
+	for _, sample := range s.samples {
+		if sample.Labels[exporter.LabelMPID] != "1" || (sample.Result.Timestamp != latest && sample.Result.Timestamp != previous) {
+			t.Errorf("unexpected sample %v at %d", sample.Labels, sample.Result.Timestamp)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if !strings.HasSuffix(content, "# EOF\n") {
+		t.Errorf("expected the file to end with # EOF:\n%s", content)
+	}
+	// samples of a series are sorted by timestamp
+	first := strings.Index(content, "apatit_mp_total_duration_seconds{")
+	lines := strings.Split(content[first:], "\n")
+	if !strings.HasSuffix(lines[0], fmt.Sprintf(" 0.231 %d", previous)) || !strings.HasSuffix(lines[1], fmt.Sprintf(" 0.231 %d", latest)) {
+		t.Errorf("unexpected total duration samples:\n%s\n%s", lines[0], lines[1])
+	}
+	if !strings.Contains(lines[0], `mp_id="1"`) || !strings.Contains(lines[0], `task_id="1001"`) {
+		t.Errorf("unexpected labels: %s", lines[0])
+	}
+
+	// the first refresh doesn't push the latest backfilled point again
+	mps, err := apiClient.GetMPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := registry.Exporters()[0]
+	if err := exp.RefreshMetrics(ctx, mps); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if samples := exp.NewSamples(); len(samples) != 0 {
+		t.Errorf("expected no new samples after backfill, got %d", len(samples))
+	}
+
+	clockMu.Lock()
+	clock = clock.Add(3 * time.Minute)
+	clockMu.Unlock()
+	if err := exp.RefreshMetrics(ctx, mps); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if samples := exp.NewSamples(); len(samples) != 1 || samples[0].Result.Timestamp != latest+180 {
+		t.Errorf("expected the next data point to be new, got %v", samples)
+	}
+}
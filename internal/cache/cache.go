@@ -1,30 +1,120 @@
 package cache
 
-import "sync"
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+// minCompressSize is the minimum size of JSON to be compressed, smaller bodies are served as is.
+const minCompressSize = 512
+
+// RestoredHeader is set to "true" in responses with data restored from the saved state which wasn't refreshed yet.
+const RestoredHeader = "X-Apatit-State-Restored"
 
 var TaskDataCache = &TaskCache{}
-var AllTasksInfoCache []byte
+var AllTasksInfoCache = &TaskCache{}
+
+// zstdEncoder is shared by all caches, EncodeAll is safe for concurrent use.
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+
+// Entry
+// is an immutable cached JSON document.
+// Compressed bodies are encoded once per update, they are nil if compression is not worth it.
+type Entry struct {
+	Data []byte
+	Gzip []byte
+	Zstd []byte
+	// ETag is a quoted hash of Data
+	ETag string
+	// ModTime is the time Data was last changed
+	ModTime time.Time
+	// Restored is true if Data was restored from the saved state and wasn't refreshed yet
+	Restored bool
+}
 
 // TaskCache
-// is a cache of TaskStat in JSON
+// is a cache of JSON documents, e.g. TaskStat or TaskInfo lists
 type TaskCache struct {
-	mu   sync.RWMutex // RWMutex allows readings
-	data []byte
+	mu    sync.RWMutex // RWMutex allows readings
+	entry *Entry
 }
 
-// UpdateCache safely updates data in cache
+// UpdateCache safely updates data in cache.
+// Unchanged data keeps the previous entry, so ETag and modification time are kept as well.
 func (c *TaskCache) UpdateCache(data []byte) {
+	tag := etag(data)
+
+	c.mu.RLock()
+	unchanged := c.entry != nil && c.entry.ETag == tag && !c.entry.Restored
+	c.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	c.set(NewEntry(data, time.Now()))
+}
+
+// RestoreCache sets data restored from the saved state, modTime is the time the state was saved.
+// The entry is flagged as restored until the next UpdateCache.
+func (c *TaskCache) RestoreCache(data []byte, modTime time.Time) {
+	entry := NewEntry(data, modTime)
+	entry.Restored = true
+	c.set(entry)
+}
+
+// set safely replaces the cached entry.
+func (c *TaskCache) set(entry *Entry) {
 	c.mu.Lock()
-	c.data = data
+	c.entry = entry
 	c.mu.Unlock()
 }
 
-// GetFromCache safely reads data from cache
-func (c *TaskCache) GetFromCache() []byte {
+// NewEntry creates the entry of data changed at modTime, compressing data if it is worth it.
+func NewEntry(data []byte, modTime time.Time) *Entry {
+	entry := &Entry{
+		Data:    data,
+		ETag:    etag(data),
+		ModTime: modTime,
+	}
+	if len(data) >= minCompressSize {
+		entry.Gzip = gzipEncode(data)
+		entry.Zstd = zstdEncoder.EncodeAll(data, nil)
+	}
+	return entry
+}
+
+// Get safely returns the cached entry, it is nil if there is no data yet.
+// The entry is shared and must not be modified.
+func (c *TaskCache) Get() *Entry {
 	c.mu.RLock()
-	// Returns copy here to avoid data race
-	dataCopy := make([]byte, len(c.data))
-	copy(dataCopy, c.data)
-	c.mu.RUnlock()
-	return dataCopy
+	defer c.mu.RUnlock()
+	return c.entry
+}
+
+// etag returns the quoted hash of data.
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// gzipEncode compresses data with gzip, it returns nil on failure.
+func gzipEncode(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		logrus.Errorf("Failed to gzip cached data: %v", err)
+		return nil
+	}
+	if err := zw.Close(); err != nil {
+		logrus.Errorf("Failed to gzip cached data: %v", err)
+		return nil
+	}
+	return buf.Bytes()
 }
@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"apatit/internal/client"
+)
+
+// Data is the latest processed API data served by the REST API.
+var Data = &DataCache{}
+
+// DataCache
+// is a cache of processed tasks info, task stats and monitoring points info.
+// Cached slices are replaced as a whole and must not be modified.
+type DataCache struct {
+	mu sync.RWMutex
+
+	tasks          []*client.TaskInfo
+	tasksUpdatedAt time.Time
+
+	// task stats by task ID
+	taskStats map[string]*client.TaskStatEntry
+
+	mps          []*client.MonitoringPointInfo
+	mpsUpdatedAt time.Time
+
+	// data restored from the saved state which wasn't refreshed yet
+	tasksRestored, taskStatsRestored, mpsRestored bool
+}
+
+// SetTasks safely replaces all tasks info
+func (c *DataCache) SetTasks(tasks []*client.TaskInfo) {
+	c.mu.Lock()
+	c.tasks = tasks
+	c.tasksUpdatedAt = time.Now()
+	c.tasksRestored = false
+	c.mu.Unlock()
+}
+
+// Tasks safely returns all tasks info and its update time, updatedAt is zero if there is no data yet
+func (c *DataCache) Tasks() (tasks []*client.TaskInfo, updatedAt time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tasks, c.tasksUpdatedAt
+}
+
+// SetTaskStats safely replaces stats of the exported tasks
+func (c *DataCache) SetTaskStats(stats []*client.TaskStatEntry) {
+	byID := make(map[string]*client.TaskStatEntry, len(stats))
+	for _, s := range stats {
+		byID[s.TaskID] = s
+	}
+
+	c.mu.Lock()
+	c.taskStats = byID
+	c.taskStatsRestored = false
+	c.mu.Unlock()
+}
+
+// TaskStats safely returns stats of the task, ok is false if the task has no stats
+func (c *DataCache) TaskStats(taskID int) (stats *client.TaskStatEntry, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats, ok = c.taskStats[strconv.Itoa(taskID)]
+	return stats, ok
+}
+
+// SetMPs safely replaces monitoring points info
+func (c *DataCache) SetMPs(mps []*client.MonitoringPointInfo) {
+	c.mu.Lock()
+	c.mps = mps
+	c.mpsUpdatedAt = time.Now()
+	c.mpsRestored = false
+	c.mu.Unlock()
+}
+
+// MPs safely returns monitoring points info and its update time, updatedAt is zero if there is no data yet
+func (c *DataCache) MPs() (mps []*client.MonitoringPointInfo, updatedAt time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mps, c.mpsUpdatedAt
+}
+
+// Restore safely sets data restored from the saved state, nil data is skipped.
+// Its update time is the time the state was saved, and it is flagged as restored until it is set again.
+func (c *DataCache) Restore(tasks []*client.TaskInfo, stats []*client.TaskStatEntry, mps []*client.MonitoringPointInfo, savedAt time.Time) {
+	if tasks != nil {
+		c.SetTasks(tasks)
+	}
+	if stats != nil {
+		c.SetTaskStats(stats)
+	}
+	if mps != nil {
+		c.SetMPs(mps)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tasks != nil {
+		c.tasksUpdatedAt, c.tasksRestored = savedAt, true
+	}
+	if stats != nil {
+		c.taskStatsRestored = true
+	}
+	if mps != nil {
+		c.mpsUpdatedAt, c.mpsRestored = savedAt, true
+	}
+}
+
+// Restored safely returns true if any data was restored from the saved state and wasn't refreshed yet
+func (c *DataCache) Restored() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tasksRestored || c.taskStatsRestored || c.mpsRestored
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Serve writes the JSON entry with caching headers.
+// Conditional requests are answered with '304 Not Modified', the body is compressed if the client accepts it.
+// Every encoding has its own ETag, as encoded bodies are different representations.
+// Restored data is flagged by RestoredHeader, Last-Modified is omitted if the entry has no ModTime.
+func Serve(w http.ResponseWriter, r *http.Request, entry *Entry) {
+	body, encoding := entry.Data, ""
+	switch {
+	case entry.Zstd != nil && acceptsEncoding(r, "zstd"):
+		body, encoding = entry.Zstd, "zstd"
+	case entry.Gzip != nil && acceptsEncoding(r, "gzip"):
+		body, encoding = entry.Gzip, "gzip"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Cache-Control", "no-cache")
+	h.Add("Vary", "Accept-Encoding")
+	if entry.Restored {
+		h.Set(RestoredHeader, "true")
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+		h.Set("ETag", strings.TrimSuffix(entry.ETag, `"`)+"-"+encoding+`"`)
+	} else {
+		h.Set("ETag", entry.ETag)
+	}
+
+	// ServeContent handles If-None-Match, If-Modified-Since, HEAD and Range requests
+	http.ServeContent(w, r, "", entry.ModTime, bytes.NewReader(body))
+}
+
+// ServeJSON writes the JSON document built for the request like Serve.
+// Unlike cached entries, the body is compressed with the encoding accepted by the client only.
+func ServeJSON(w http.ResponseWriter, r *http.Request, data []byte, modTime time.Time) {
+	entry := &Entry{Data: data, ETag: etag(data), ModTime: modTime}
+	if len(data) >= minCompressSize {
+		switch {
+		case acceptsEncoding(r, "zstd"):
+			entry.Zstd = zstdEncoder.EncodeAll(data, nil)
+		case acceptsEncoding(r, "gzip"):
+			entry.Gzip = gzipEncode(data)
+		}
+	}
+	Serve(w, r, entry)
+}
+
+// acceptsEncoding returns true if Accept-Encoding header of the request allows the encoding.
+// The encoding listed explicitly takes precedence over '*'.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	wildcard := false
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for part := range strings.SplitSeq(header, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.TrimSpace(name)
+
+			// 'q=0' means the encoding is not acceptable
+			accepted := true
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+					accepted = false
+				}
+			}
+
+			switch {
+			case strings.EqualFold(name, encoding):
+				return accepted
+			case name == "*":
+				wildcard = accepted
+			}
+		}
+	}
+	return wildcard
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{header: "", encoding: "gzip", want: false},
+		{header: "gzip, deflate", encoding: "gzip", want: true},
+		{header: "GZIP", encoding: "gzip", want: true},
+		{header: "deflate, br", encoding: "gzip", want: false},
+		{header: "gzip;q=0", encoding: "gzip", want: false},
+		{header: "gzip;q=0.5", encoding: "gzip", want: true},
+		{header: "*", encoding: "zstd", want: true},
+		{header: "*;q=0", encoding: "zstd", want: false},
+		{header: "zstd;q=0, *", encoding: "zstd", want: false},
+		{header: "*, zstd;q=0", encoding: "zstd", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header+"/"+tt.encoding, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Accept-Encoding", tt.header)
+			}
+			if got := acceptsEncoding(r, tt.encoding); got != tt.want {
+				t.Errorf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.encoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeJSON(t *testing.T) {
+	data := []byte(`{"items":[` + strings.Repeat(`{"id":1},`, 100) + `{"id":1}]}`)
+	modTime := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/tasks", nil)
+		r.Header = header
+		w := httptest.NewRecorder()
+		ServeJSON(w, r, data, modTime)
+		return w
+	}
+
+	plain := serve(http.Header{})
+	if plain.Code != http.StatusOK || !bytes.Equal(plain.Body.Bytes(), data) {
+		t.Fatalf("unexpected plain response %d: %s", plain.Code, plain.Body)
+	}
+	etag := plain.Header().Get("ETag")
+	if etag == "" || plain.Header().Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Fatalf("expected ETag and Last-Modified headers, got %v", plain.Header())
+	}
+
+	if w := serve(http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the matching ETag, got %d", w.Code)
+	}
+	if w := serve(http.Header{"If-Modified-Since": {modTime.Format(http.TimeFormat)}}); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for unchanged data, got %d", w.Code)
+	}
+
+	compressed := serve(http.Header{"Accept-Encoding": {"zstd, gzip"}})
+	if compressed.Header().Get("Content-Encoding") != "zstd" || compressed.Header().Get("ETag") == etag {
+		t.Fatalf("expected a zstd body with its own ETag, got %v", compressed.Header())
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+	decoded, err := decoder.DecodeAll(compressed.Body.Bytes(), nil)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("failed to decode the zstd body: %v", err)
+	}
+
+	// small bodies are not compressed
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/tasks/1", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	ServeJSON(w, r, []byte(`{"id":1}`), time.Time{})
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Last-Modified") != "" {
+		t.Errorf("expected a small body without encoding and Last-Modified, got %v", w.Header())
+	}
+}
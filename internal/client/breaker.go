@@ -0,0 +1,136 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned for requests rejected by the open circuit breaker.
+var ErrCircuitOpen = errors.New("API circuit breaker is open")
+
+// circuitState is a state of the circuit breaker, its value is exported by CircuitState metric.
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops requests to the unavailable API.
+// It opens after failureThreshold consecutive failed requests and rejects requests for openDuration,
+// then lets a single probe request through (half-open): the probe success closes it, the failure opens it again.
+// The nil breaker is disabled and allows all requests.
+type circuitBreaker struct {
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	// probing is true while the probe request of the half-open breaker is being sent
+	probing bool
+}
+
+// newCircuitBreaker creates a closed breaker, it returns nil (disabled breaker) if failureThreshold is not positive.
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration) *circuitBreaker {
+	CircuitState.Set(float64(circuitClosed))
+	if failureThreshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+	}
+}
+
+// allow checks if a request may be sent, it returns ErrCircuitOpen otherwise.
+// The allowed request must be finished with record or cancel.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return ErrCircuitOpen
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+	case circuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record reports the result of the allowed request, failed is true if the API is unavailable.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		if b.state != circuitClosed {
+			b.setState(circuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.state == circuitClosed && b.failures >= b.failureThreshold {
+		b.openedAt = time.Now()
+		b.setState(circuitOpen)
+	}
+}
+
+// cancel reports the allowed request was aborted before its result is known.
+func (b *circuitBreaker) cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// setState switches the breaker state, the lock must be held.
+func (b *circuitBreaker) setState(state circuitState) {
+	log := logrus.WithField("component", "api_client").WithFields(logrus.Fields{
+		"from": b.state.String(),
+		"to":   state.String(),
+	})
+	switch state {
+	case circuitOpen:
+		log.WithField("open_duration", b.openDuration.String()).Warn("API circuit breaker opened, requests fail fast")
+	default:
+		log.Info("API circuit breaker state changed")
+	}
+
+	b.state = state
+	CircuitState.Set(float64(state))
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+
+	type step struct {
+		// action is allow, success, failure, cancel or wait (for the open duration)
+		action string
+		// wantErr is checked for allow steps
+		wantErr error
+		want    circuitState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "failures below the threshold",
+			steps: []step{
+				{action: "allow", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "allow", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "allow", want: circuitClosed},
+			},
+		},
+		{
+			name: "success resets consecutive failures",
+			steps: []step{
+				{action: "failure", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "success", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "allow", want: circuitClosed},
+			},
+		},
+		{
+			name: "threshold opens the breaker",
+			steps: []step{
+				{action: "failure", want: circuitClosed},
+				{action: "failure", want: circuitClosed},
+				{action: "failure", want: circuitOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, want: circuitOpen},
+			},
+		},
+		{
+			name: "successful probe closes the breaker",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", want: circuitOpen},
+				{action: "wait", want: circuitOpen},
+				{action: "allow", want: circuitHalfOpen},
+				// a single probe at a time
+				{action: "allow", wantErr: ErrCircuitOpen, want: circuitHalfOpen},
+				{action: "success", want: circuitClosed},
+				{action: "allow", want: circuitClosed},
+			},
+		},
+		{
+			name: "failed probe opens the breaker again",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", want: circuitOpen},
+				{action: "wait", want: circuitOpen},
+				{action: "allow", want: circuitHalfOpen},
+				{action: "failure", want: circuitOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, want: circuitOpen},
+			},
+		},
+		{
+			name: "canceled probe lets another one through",
+			steps: []step{
+				{action: "failure"}, {action: "failure"}, {action: "failure", want: circuitOpen},
+				{action: "wait", want: circuitOpen},
+				{action: "allow", want: circuitHalfOpen},
+				{action: "cancel", want: circuitHalfOpen},
+				{action: "allow", want: circuitHalfOpen},
+				{action: "success", want: circuitClosed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(3, openDuration)
+			for i, s := range tt.steps {
+				var err error
+				switch s.action {
+				case "allow":
+					err = b.allow()
+				case "success":
+					b.record(false)
+				case "failure":
+					b.record(true)
+				case "cancel":
+					b.cancel()
+				case "wait":
+					time.Sleep(openDuration)
+				}
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d (%s): got error %v, want %v", i, s.action, err, s.wantErr)
+				}
+				if b.state != s.want {
+					t.Fatalf("step %d (%s): got state %s, want %s", i, s.action, b.state, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	if b != nil {
+		t.Fatal("expected the breaker to be disabled")
+	}
+	for range 10 {
+		b.record(true)
+	}
+	if err := b.allow(); err != nil {
+		t.Errorf("expected the disabled breaker to allow requests, got %v", err)
+	}
+}
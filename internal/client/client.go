@@ -1,12 +1,17 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"regexp"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -17,6 +22,11 @@ import (
 
 const (
 	defaultEndpoint = "https://ping-admin.com"
+
+	// defaultRequestTimeout bounds a single HTTP request to the API, including reading the body
+	defaultRequestTimeout = 30 * time.Second
+	// maxRetryBackoff caps the exponential backoff between retries
+	maxRetryBackoff = time.Minute
 )
 
 var apiKeyMasker = regexp.MustCompile(`(api_key=)(\w+)`)
@@ -28,153 +38,208 @@ type Client struct {
 	endpoint       string
 	requestDelay   time.Duration
 	requestRetries int
+	requestTimeout time.Duration
+	limiter        *rateLimiter
+	breaker        *circuitBreaker
+}
 
-	// Rate limiting: configurable max requests per second
-	maxRequestsPerSecond int
-	rateLimitMu          sync.Mutex
-	lastRequestTimes     []time.Time // Track recent request times
+// Config contains the configuration for the API client.
+type Config struct {
+	APIKey string
+	// Endpoint is a base URL of Ping-Admin API (or its mirror, proxy or fake)
+	Endpoint             string
+	RequestDelay         time.Duration
+	RequestRetries       int
+	RequestTimeout       time.Duration
+	MaxRequestsPerSecond int
+	// Burst is the number of requests allowed at once, 1 if not set
+	Burst int
+	// EndpointLimits are rate limit budgets by 'sa' parameter, on top of MaxRequestsPerSecond
+	EndpointLimits map[string]EndpointLimit
+	// DailyQuota is the maximum number of requests per UTC day, zero means no quota
+	DailyQuota int
+	// CircuitFailureThreshold is the number of consecutive failed requests opening the circuit breaker,
+	// zero disables the breaker
+	CircuitFailureThreshold int
+	// CircuitOpenDuration is the time the open circuit breaker rejects requests before a probe request
+	CircuitOpenDuration time.Duration
 }
 
 // New creates a new API client entity.
-func New(apiKey string, httpClient *http.Client, requestDelay time.Duration, requestRetries int, maxRequestsPerSecond int) *Client {
+// Any transport may be plugged in via httpClient, see NewHTTPClient for the default one.
+func New(conf *Config, httpClient *http.Client) (*Client, error) {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
-	if maxRequestsPerSecond <= 0 {
-		maxRequestsPerSecond = 2
+
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
 	}
-	return &Client{
-		httpClient:           httpClient,
-		apiKey:               apiKey,
-		endpoint:             defaultEndpoint,
-		requestDelay:         requestDelay,
-		requestRetries:       requestRetries,
-		maxRequestsPerSecond: maxRequestsPerSecond,
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API endpoint: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid API endpoint '%s': absolute http(s) URL is expected", endpoint)
 	}
-}
 
-// waitForRateLimit ensures we don't exceed maxRequestsPerSecond requests per second.
-// It waits if necessary before allowing the next request.
-// This method is thread-safe and can be called from multiple goroutines.
-func (c *Client) waitForRateLimit() {
-	c.rateLimitMu.Lock()
-	defer c.rateLimitMu.Unlock()
-
-	now := time.Now()
-	oneSecondAgo := now.Add(-time.Second)
-
-	// Remove request times older than 1 second
-	validRequests := make([]time.Time, 0, c.maxRequestsPerSecond)
-	for _, t := range c.lastRequestTimes {
-		if t.After(oneSecondAgo) {
-			validRequests = append(validRequests, t)
-		}
+	requestTimeout := conf.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
 	}
-	c.lastRequestTimes = validRequests
-
-	// If we have maxRequestsPerSecond requests in the last second, wait until the oldest one expires
-	if len(c.lastRequestTimes) >= c.maxRequestsPerSecond {
-		oldestRequest := c.lastRequestTimes[0]
-		// Wait 1.1 seconds instead of 1 second to add a small buffer and avoid exact 1 second API restriction
-		waitDuration := 1100*time.Millisecond - now.Sub(oldestRequest)
-		if waitDuration > 0 {
-			logrus.WithField("wait_seconds", waitDuration.Seconds()).
-				Debug("Rate limit: waiting before next API request")
-			// Sleep while holding the lock - this ensures other goroutines wait
-			// and see the updated state after we're done
-			time.Sleep(waitDuration)
-			now = time.Now() // Update now after waiting
-
-			// Recalculate valid requests after sleep (time has passed)
-			oneSecondAgo = now.Add(-time.Second)
-			validRequests = make([]time.Time, 0, 2)
-			for _, t := range c.lastRequestTimes {
-				if t.After(oneSecondAgo) {
-					validRequests = append(validRequests, t)
-				}
-			}
-			c.lastRequestTimes = validRequests
+	maxRequestsPerSecond := conf.MaxRequestsPerSecond
+	if maxRequestsPerSecond <= 0 {
+		maxRequestsPerSecond = 2
+	}
+	global := EndpointLimit{RequestsPerSecond: float64(maxRequestsPerSecond), Burst: conf.Burst}
+	for sa, limit := range conf.EndpointLimits {
+		if limit.RequestsPerSecond <= 0 {
+			return nil, fmt.Errorf("invalid rate limit of '%s' endpoint: requests per second must be positive", sa)
 		}
 	}
-	c.lastRequestTimes = append(c.lastRequestTimes, now)
+
+	return &Client{
+		httpClient:     httpClient,
+		apiKey:         conf.APIKey,
+		endpoint:       strings.TrimRight(endpoint, "/"),
+		requestDelay:   conf.RequestDelay,
+		requestRetries: conf.RequestRetries,
+		requestTimeout: requestTimeout,
+		limiter:        newRateLimiter(global, conf.EndpointLimits, conf.DailyQuota),
+		breaker:        newCircuitBreaker(conf.CircuitFailureThreshold, conf.CircuitOpenDuration),
+	}, nil
 }
 
 // getAPI make a request to Ping-Admin API.
 // Request could be delayed to avoid "Server Unavailable" error.
-func (c *Client) getAPI(path string, result interface{}, delayed bool) error {
-	log := logrus.WithField("component", "api_client")
-
-	// Enforce rate limit: max 2 requests per second
-	c.waitForRateLimit()
-
-	req, err := http.NewRequest(http.MethodGet, path, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %s", maskAPIKey(err.Error()))
-	}
-	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", version.Name, version.Version))
-
-	var resp *http.Response
+// Failed requests are retried according to the error class: rate limited requests after the pause
+// requested by the API, transport errors and 5xx responses with randomized exponential backoff.
+// Returned API errors are *APIError, see ErrorType for error classes.
+// Requests fail fast with ErrCircuitOpen while the API is considered unavailable by the circuit breaker.
+// Pauses, rate limit waits, retries and the request itself are aborted once ctx is done.
+func (c *Client) getAPI(ctx context.Context, path string, result interface{}, delayed bool) error {
+	log := logrus.WithField("component", "api_client").WithField("url", maskAPIKey(path))
+	sa := endpointName(path)
+
+	var lastErr *APIError
 	for i := 1; i < c.requestRetries+1; i++ {
 
+		if err := c.breaker.allow(); err != nil {
+			return &APIError{Class: ErrUpstream, SA: sa, Err: err}
+		}
+
 		if delayed {
-			utils.RandomizedPause(c.requestDelay)
+			if err := utils.RandomizedPause(ctx, c.requestDelay); err != nil {
+				c.breaker.cancel()
+				return fmt.Errorf("request aborted: %w", err)
+			}
 		}
-		resp, err = c.httpClient.Do(req)
 
-		log.WithField("url", maskAPIKey(req.URL.String())).Debug("Sending API request")
+		// Enforce global and endpoint rate limits and daily quota
+		if err := c.limiter.wait(ctx, sa); err != nil {
+			c.breaker.cancel()
+			if errors.Is(err, ErrQuotaExhausted) {
+				return err
+			}
+			return fmt.Errorf("request aborted: %w", err)
+		}
+
+		log.Debug("Sending API request")
+		statusCode, header, body, err := c.doRequest(ctx, path, sa)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			c.breaker.cancel()
+			return fmt.Errorf("request aborted: %w", ctxErr)
+		}
 
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"url":   maskAPIKey(req.URL.String()),
-				"error": maskAPIKey(err.Error()),
-			}).Warn("Failed to send API request")
-
-			if i < c.requestRetries {
-				log.WithField("url", maskAPIKey(req.URL.String())).Info("Trying to send this request again..")
-				utils.RandomizedPause(c.requestDelay)
-			} else {
-				return fmt.Errorf("request failed: %s", maskAPIKey(err.Error()))
+			lastErr = &APIError{Class: ErrUpstream, SA: sa, Err: err}
+		} else {
+			lastErr = classifyResponse(sa, statusCode, header, body)
+		}
+		// only unavailability of the API trips the breaker, error payloads mean the API works
+		c.breaker.record(lastErr != nil && errors.Is(lastErr, ErrUpstream) && lastErr.Retryable())
+
+		if lastErr == nil {
+			c.limiter.succeeded()
+			if err := json.Unmarshal(body, result); err != nil {
+				return &APIError{Class: ErrDecode, SA: sa, StatusCode: statusCode, Err: err}
 			}
+			return nil
+		}
 
-		} else {
+		if errors.Is(lastErr, ErrRateLimited) {
+			c.limiter.throttled(lastErr.RetryAfter)
+		}
+
+		log.WithField("error", lastErr.Error()).Warn("Failed to send API request")
+		if !lastErr.Retryable() || i == c.requestRetries {
 			break
 		}
-	}
 
-	if resp == nil {
-		return fmt.Errorf("no response after \"%s\" request", maskAPIKey(req.URL.String()))
+		// the rate limiter pauses rate limited requests itself
+		log.Info("Trying to send this request again..")
+		RetriesTotal.WithLabelValues(sa, ErrorType(lastErr)).Inc()
+		if !errors.Is(lastErr, ErrRateLimited) {
+			if err := utils.RandomizedPause(ctx, retryBackoff(c.requestDelay, i)); err != nil {
+				return fmt.Errorf("request aborted: %w", err)
+			}
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if lastErr == nil {
+		return fmt.Errorf("no response after \"%s\" request", maskAPIKey(path))
 	}
+	return lastErr
+}
 
-	body, err := io.ReadAll(resp.Body)
+// doRequest performs a single HTTP request bounded by the per-request deadline
+// and returns the response status code, headers and body.
+// The request to the sa endpoint is instrumented with API client metrics.
+func (c *Client) doRequest(ctx context.Context, path, sa string) (int, http.Header, []byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	trace := &requestTrace{}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(reqCtx, trace.clientTrace()), http.MethodGet, path, nil)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return 0, nil, nil, fmt.Errorf("failed to create request: %s", maskAPIKey(err.Error()))
 	}
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", version.Name, version.Version))
+
+	RequestsInFlight.WithLabelValues(sa).Inc()
+	defer RequestsInFlight.WithLabelValues(sa).Dec()
+	startTime := time.Now()
 
-	if err := json.Unmarshal(body, result); err != nil {
-		return fmt.Errorf("failed to unmarshal JSON response: %w", err)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		RequestsTotal.WithLabelValues(sa, "error").Inc()
+		RequestDurationSeconds.WithLabelValues(sa).Observe(time.Since(startTime).Seconds())
+		return 0, nil, nil, err
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	err = resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	RequestsTotal.WithLabelValues(sa, strconv.Itoa(resp.StatusCode)).Inc()
+	RequestDurationSeconds.WithLabelValues(sa).Observe(time.Since(startTime).Seconds())
+	ResponseSizeBytes.WithLabelValues(sa).Observe(float64(len(body)))
 	if err != nil {
-		return fmt.Errorf("failed to close response body: %w", err)
+		return 0, nil, nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
-	return nil
+	return resp.StatusCode, resp.Header, body, nil
 }
 
 // GetTaskGraphStat get task statistics using sa=task_graph_stat request.
-func (c *Client) GetTaskGraphStat(taskID int) ([]*MonitoringPointEntry, error) {
+// limit is a number of the latest data points requested for each MP.
+func (c *Client) GetTaskGraphStat(ctx context.Context, taskID int, limit int) ([]*MonitoringPointEntry, error) {
 	u := fmt.Sprintf(
-		"%s/?a=api&sa=task_graph_stat&enc=utf8&api_key=%s&id=%d&notnull=1&limit=1",
-		c.endpoint, c.apiKey, taskID,
+		"%s/?a=api&sa=task_graph_stat&enc=utf8&api_key=%s&id=%d&notnull=1&limit=%d",
+		c.endpoint, c.apiKey, taskID, limit,
 	)
 
 	var resultsRaw []*EntryRaw
-	if err := c.getAPI(u, &resultsRaw, false); err != nil {
+	if err := c.getAPI(ctx, u, &resultsRaw, false); err != nil {
 		return nil, err
 	}
 
@@ -187,19 +252,24 @@ func (c *Client) GetTaskGraphStat(taskID int) ([]*MonitoringPointEntry, error) {
 }
 
 // GetTaskStat get task status using sa=task_stat request.
-func (c *Client) GetTaskStat(taskID int) (*TaskStatEntry, error) {
+func (c *Client) GetTaskStat(ctx context.Context, taskID int) (*TaskStatEntry, error) {
 	u := fmt.Sprintf(
 		"%s/?a=api&sa=task_stat&enc=utf8&api_key=%s&id=%d&limit=100",
 		c.endpoint, c.apiKey, taskID,
 	)
 
 	var resultsRaw []*TaskStatRaw
-	if err := c.getAPI(u, &resultsRaw, false); err != nil {
+	if err := c.getAPI(ctx, u, &resultsRaw, false); err != nil {
 		return nil, err
 	}
 
 	if len(resultsRaw) == 0 {
-		return nil, fmt.Errorf("no task stat entries returned for task %d", taskID)
+		return nil, &APIError{
+			Class:      ErrTaskNotFound,
+			SA:         "task_stat",
+			StatusCode: http.StatusOK,
+			Message:    fmt.Sprintf("no task stat entries returned for task %d", taskID),
+		}
 	}
 
 	processedResult := resultsRaw[0].ProcessTaskEntry()
@@ -208,11 +278,11 @@ func (c *Client) GetTaskStat(taskID int) (*TaskStatEntry, error) {
 }
 
 // GetMPs get monitoring points info by sa=tm request.
-func (c *Client) GetMPs() ([]*MonitoringPointInfo, error) {
+func (c *Client) GetMPs(ctx context.Context) ([]*MonitoringPointInfo, error) {
 	u := fmt.Sprintf("%s/?a=api&sa=tm&enc=utf8&api_key=%s", c.endpoint, c.apiKey)
 
 	var mps []*MonitoringPointRaw
-	if err := c.getAPI(u, &mps, true); err != nil {
+	if err := c.getAPI(ctx, u, &mps, true); err != nil {
 		return nil, err
 	}
 
@@ -225,11 +295,11 @@ func (c *Client) GetMPs() ([]*MonitoringPointInfo, error) {
 }
 
 // GetAllTasks get all tasks list.
-func (c *Client) GetAllTasks() ([]*TaskInfo, error) {
+func (c *Client) GetAllTasks(ctx context.Context) ([]*TaskInfo, error) {
 	u := fmt.Sprintf("%s/?a=api&sa=tasks&enc=utf8&api_key=%s", c.endpoint, c.apiKey)
 
 	var tasks []*TaskRaw
-	if err := c.getAPI(u, &tasks, true); err != nil {
+	if err := c.getAPI(ctx, u, &tasks, true); err != nil {
 		return nil, err
 	}
 
@@ -241,6 +311,25 @@ func (c *Client) GetAllTasks() ([]*TaskInfo, error) {
 	return processedTasks, nil
 }
 
+// retryBackoff returns the pause before the retry after the attempt (starting from 1):
+// the delay is doubled every attempt up to maxRetryBackoff.
+func retryBackoff(delay time.Duration, attempt int) time.Duration {
+	backoff := min(delay, maxRetryBackoff)
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+	return backoff
+}
+
+// endpointName returns 'sa' parameter of the API request URL.
+func endpointName(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("sa")
+}
+
 // maskAPIKey change api_key in string on '***' for safe logging.
 func maskAPIKey(str string) string {
 	return apiKeyMasker.ReplaceAllString(str, "${1}***")
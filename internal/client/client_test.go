@@ -0,0 +1,27 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first attempt", delay: 3 * time.Second, attempt: 1, want: 3 * time.Second},
+		{name: "doubled", delay: 3 * time.Second, attempt: 3, want: 12 * time.Second},
+		{name: "capped", delay: 3 * time.Second, attempt: 6, want: maxRetryBackoff},
+		{name: "many attempts don't overflow", delay: 3 * time.Second, attempt: 100, want: maxRetryBackoff},
+		{name: "delay over the cap", delay: time.Hour, attempt: 2, want: maxRetryBackoff},
+		{name: "zero delay", delay: 0, attempt: 5, want: 0},
+	}
+	for _, tt := range tests {
+		if got := retryBackoff(tt.delay, tt.attempt); got != tt.want {
+			t.Errorf("%s: retryBackoff(%s, %d) = %s, want %s", tt.name, tt.delay, tt.attempt, got, tt.want)
+		}
+	}
+}
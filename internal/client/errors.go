@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// API error classes, APIError unwraps to one of them.
+var (
+	// ErrUnauthorized means the API key is wrong or has no access
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTaskNotFound means the task doesn't exist or belongs to another account
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrRateLimited means the API rejected the request due to rate limiting
+	ErrRateLimited = errors.New("rate limited")
+	// ErrUpstream means the API is unreachable or failed to process the request
+	ErrUpstream = errors.New("upstream error")
+	// ErrDecode means the API response can't be decoded
+	ErrDecode = errors.New("failed to decode response")
+)
+
+// APIError is a failed API request.
+type APIError struct {
+	// Class is one of ErrUnauthorized, ErrTaskNotFound, ErrRateLimited, ErrUpstream and ErrDecode
+	Class error
+	// SA is the 'sa' parameter of the request (endpoint)
+	SA string
+	// StatusCode is zero if no response was received
+	StatusCode int
+	// Message is the error message of the API error payload, if any
+	Message string
+	// RetryAfter is the pause requested by the API for rate limited requests
+	RetryAfter time.Duration
+	// Err is the underlying transport or decoding error, if any
+	Err error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s (sa=%s", e.Class, e.SA)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(", status code %d", e.StatusCode)
+	}
+	msg += ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + maskAPIKey(e.Err.Error())
+	}
+	return msg
+}
+
+// Unwrap returns the error class and the underlying error, so both can be checked with errors.Is.
+func (e *APIError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Class}
+	}
+	return []error{e.Class, e.Err}
+}
+
+// Retryable checks if the request may succeed if it is sent again:
+// rate limited requests, transport errors and 5xx responses are retried.
+func (e *APIError) Retryable() bool {
+	switch e.Class {
+	case ErrRateLimited:
+		return true
+	case ErrUpstream:
+		if errors.Is(e.Err, ErrCircuitOpen) {
+			return false
+		}
+		return e.StatusCode == 0 || e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+// ErrorType returns the error class name for the error_type label of apatit_exporter_errors_total.
+func ErrorType(err error) string {
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, ErrTaskNotFound):
+		return "task_not_found"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrUpstream):
+		return "upstream"
+	case errors.Is(err, ErrDecode):
+		return "decode"
+	case errors.Is(err, ErrQuotaExhausted):
+		return "quota_exhausted"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "aborted"
+	default:
+		return "unknown"
+	}
+}
+
+// classifyResponse returns the error of the API response, or nil if the response is successful.
+// The API reports some errors with HTTP 200 and an error payload instead of the requested data.
+func classifyResponse(sa string, statusCode int, header http.Header, body []byte) *APIError {
+	e := &APIError{SA: sa, StatusCode: statusCode}
+	message, hasPayload := errorPayload(body)
+	e.Message = message
+	lowerMessage := strings.ToLower(message)
+
+	// 503 is rate limiting if the API asks to retry later, an outage otherwise
+	switch {
+	case statusCode == http.StatusTooManyRequests || strings.Contains(lowerMessage, "too many requests") ||
+		statusCode == http.StatusServiceUnavailable && header.Get("Retry-After") != "":
+		e.Class = ErrRateLimited
+		e.RetryAfter = retryAfter(header)
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		e.Class = ErrUnauthorized
+	case statusCode != http.StatusOK:
+		e.Class = ErrUpstream
+	case !hasPayload:
+		return nil
+	case containsAny(lowerMessage, "key", "ключ", "auth", "access", "доступ"):
+		e.Class = ErrUnauthorized
+	case containsAny(lowerMessage, "not found", "не найден"):
+		e.Class = ErrTaskNotFound
+	default:
+		e.Class = ErrUpstream
+	}
+	return e
+}
+
+// errorPayload returns the message of the API error payload like '{"error":"Wrong API key"}'.
+func errorPayload(body []byte) (message string, ok bool) {
+	trimmed := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(trimmed, "{") {
+		return "", false
+	}
+
+	var payload struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &payload); err != nil {
+		return "", false
+	}
+	if payload.Error != "" {
+		return payload.Error, true
+	}
+	return payload.Message, payload.Message != ""
+}
+
+// containsAny checks if s contains any of substrings.
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
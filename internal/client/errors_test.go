@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		body       string
+		// want is nil for successful responses
+		want       error
+		message    string
+		retryAfter time.Duration
+		retryable  bool
+	}{
+		{name: "data", statusCode: 200, body: `[{"id":1}]`},
+		{name: "object without error", statusCode: 200, body: `{"id":1}`},
+		{name: "not JSON", statusCode: 200, body: `OK`},
+		{name: "wrong key payload", statusCode: 200, body: `{"error":"Wrong API key"}`, want: ErrUnauthorized, message: "Wrong API key"},
+		{name: "russian access payload", statusCode: 200, body: `{"error":"Нет доступа"}`, want: ErrUnauthorized, message: "Нет доступа"},
+		{name: "task not found payload", statusCode: 200, body: `{"message":"Task not found"}`, want: ErrTaskNotFound, message: "Task not found"},
+		{name: "russian not found payload", statusCode: 200, body: ` {"error":"Задача не найдена"} `, want: ErrTaskNotFound, message: "Задача не найдена"},
+		{name: "rate limit payload", statusCode: 200, body: `{"error":"Too many requests"}`, want: ErrRateLimited, message: "Too many requests", retryable: true},
+		{name: "other payload", statusCode: 200, body: `{"error":"Internal error"}`, want: ErrUpstream, message: "Internal error"},
+		{name: "401", statusCode: 401, want: ErrUnauthorized},
+		{name: "403 with payload", statusCode: 403, body: `{"error":"Forbidden"}`, want: ErrUnauthorized, message: "Forbidden"},
+		{name: "429 with delay", statusCode: 429, header: http.Header{"Retry-After": {"7"}}, want: ErrRateLimited, retryAfter: 7 * time.Second, retryable: true},
+		{name: "503 with Retry-After", statusCode: 503, header: http.Header{"Retry-After": {"2"}}, want: ErrRateLimited, retryAfter: 2 * time.Second, retryable: true},
+		{name: "503 without Retry-After", statusCode: 503, want: ErrUpstream, retryable: true},
+		{name: "500", statusCode: 500, body: `<html>`, want: ErrUpstream, retryable: true},
+		{name: "404", statusCode: 404, want: ErrUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			got := classifyResponse("test", tt.statusCode, header, []byte(tt.body))
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("expected a successful response, got %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("expected %v, got a successful response", tt.want)
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("got class %v, want %v", got.Class, tt.want)
+			}
+			if got.Message != tt.message {
+				t.Errorf("got message %q, want %q", got.Message, tt.message)
+			}
+			if got.RetryAfter != tt.retryAfter {
+				t.Errorf("got retry after %s, want %s", got.RetryAfter, tt.retryAfter)
+			}
+			if got.Retryable() != tt.retryable {
+				t.Errorf("got retryable %v, want %v", got.Retryable(), tt.retryable)
+			}
+			if got.StatusCode != tt.statusCode || got.SA != "test" {
+				t.Errorf("got status code %d and sa %q", got.StatusCode, got.SA)
+			}
+		})
+	}
+}
+
+func TestErrorPayload(t *testing.T) {
+	tests := []struct {
+		body    string
+		message string
+		ok      bool
+	}{
+		{body: `{"error":"Wrong API key"}`, message: "Wrong API key", ok: true},
+		{body: `{"message":"Task not found"}`, message: "Task not found", ok: true},
+		{body: `{"error":"first","message":"second"}`, message: "first", ok: true},
+		{body: "\n  {\"error\":\"padded\"}\n", message: "padded", ok: true},
+		{body: `{"error":""}`},
+		{body: `{"id":1}`},
+		{body: `[{"error":"in a list"}]`},
+		{body: `{"error":`},
+		{body: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			message, ok := errorPayload([]byte(tt.body))
+			if message != tt.message || ok != tt.ok {
+				t.Errorf("errorPayload(%q) = %q, %v, want %q, %v", tt.body, message, ok, tt.message, tt.ok)
+			}
+		})
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &APIError{Class: ErrUpstream, Err: ErrCircuitOpen}, want: "circuit_open"},
+		{err: fmt.Errorf("request failed: %w", &APIError{Class: ErrUnauthorized}), want: "unauthorized"},
+		{err: &APIError{Class: ErrTaskNotFound}, want: "task_not_found"},
+		{err: &APIError{Class: ErrRateLimited}, want: "rate_limited"},
+		{err: &APIError{Class: ErrUpstream, StatusCode: 502}, want: "upstream"},
+		{err: &APIError{Class: ErrDecode}, want: "decode"},
+		{err: ErrQuotaExhausted, want: "quota_exhausted"},
+		{err: context.Canceled, want: "aborted"},
+		{err: fmt.Errorf("wait: %w", context.DeadlineExceeded), want: "aborted"},
+		{err: errors.New("other"), want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorType(tt.err); got != tt.want {
+			t.Errorf("ErrorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
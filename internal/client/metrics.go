@@ -0,0 +1,131 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace    = "apatit"
+	subsystemAPI = "api"
+)
+
+// API client metrics labels
+const (
+	// LabelSA is the 'sa' parameter of the API request (endpoint)
+	LabelSA = "sa"
+	// LabelCode is the HTTP status code of the response, 'error' if no response was received
+	LabelCode = "code"
+	// LabelErrorType is the error class, see ErrorType
+	LabelErrorType = "error_type"
+	// LabelPhase is the phase of the HTTP request: dns, connect, tls or first_byte
+	LabelPhase = "phase"
+)
+
+var (
+	RequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "requests_total",
+			Help:      "Total number of HTTP requests to the API.",
+		},
+		[]string{LabelSA, LabelCode},
+	)
+
+	RequestDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of HTTP requests to the API, including reading the response body.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{LabelSA},
+	)
+
+	RequestPhaseDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "request_phase_duration_seconds",
+			Help:      "Duration of HTTP request phases: DNS lookup, connection, TLS handshake and time to first response byte.",
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{LabelPhase},
+	)
+
+	ResponseSizeBytes = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "response_size_bytes",
+			Help:      "Size of API response bodies.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		},
+		[]string{LabelSA},
+	)
+
+	RequestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests to the API being sent.",
+		},
+		[]string{LabelSA},
+	)
+
+	RetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "retries_total",
+			Help:      "Total number of retried API requests by the error class of the failed attempt.",
+		},
+		[]string{LabelSA, LabelErrorType},
+	)
+
+	RateLimitWaitSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "ratelimit_wait_seconds",
+			Help:      "Time API requests waited for the rate limiter.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{LabelSA},
+	)
+
+	CircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "circuit_state",
+			Help:      "State of the API circuit breaker (0 = closed, 1 = open, 2 = half-open).",
+		},
+	)
+
+	QuotaRemaining = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemAPI,
+			Name:      "quota_remaining",
+			Help:      "Number of API requests remaining in the daily quota (UTC day), -1 if the quota is not set.",
+		},
+	)
+)
+
+// RegisterMetrics registers API client metrics.
+func RegisterMetrics() {
+	prometheus.MustRegister(
+		RequestsTotal,
+		RequestDurationSeconds,
+		RequestPhaseDurationSeconds,
+		ResponseSizeBytes,
+		RequestsInFlight,
+		RetriesTotal,
+		RateLimitWaitSeconds,
+		QuotaRemaining,
+		CircuitState,
+	)
+}
@@ -7,6 +7,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// apiTimeLayout is a datetime layout used by Ping-Admin API.
+const apiTimeLayout = "2006-01-02 15:04:05"
+
+// apiTimeLocation is a time zone of Ping-Admin API datetimes (Moscow time).
+var apiTimeLocation = time.FixedZone("MSK", 3*60*60)
+
 // --- Raw API Structures (direct JSON parsing) ---
 
 // EntryRaw
@@ -132,7 +138,17 @@ type TaskInfo struct {
 	TaskStatus      int
 	BlackListStatus int
 	VirusStatus     int
-	Timestamp       time.Time
+	Type            string
+	// Checking periods in minutes (default and during error status)
+	Period      int
+	PeriodError int
+	// Availability and unavailability time
+	UptimeW  int
+	UptimeNw int
+	// Datetimes of last check and last service status change
+	LastCheck        time.Time
+	LastStatusChange time.Time
+	Timestamp        time.Time
 }
 
 // MonitoringPointInfo
@@ -178,6 +194,7 @@ type TaskStatEntry struct {
 // is a processed TasksLogsRaw.
 type TaskLog struct {
 	Data        string
+	Timestamp   time.Time
 	Description string
 	Status      int64
 	MPName      string
@@ -201,14 +218,21 @@ func (mp *MonitoringPointRaw) ProcessMonitoringPointInfo() *MonitoringPointInfo
 // converts TaskRaw to TaskInfo.
 func (t *TaskRaw) ProcessTaskInfo() *TaskInfo {
 	return &TaskInfo{
-		EnabledStatus:   t.Status,
-		ID:              t.ID,
-		ServiceName:     t.SName,
-		URL:             t.Address,
-		TaskStatus:      t.TaskStatus,
-		BlackListStatus: t.BlackListStatus,
-		VirusStatus:     t.VirusStatus,
-		Timestamp:       time.Now(),
+		EnabledStatus:    t.Status,
+		ID:               t.ID,
+		ServiceName:      t.SName,
+		URL:              t.Address,
+		TaskStatus:       t.TaskStatus,
+		BlackListStatus:  t.BlackListStatus,
+		VirusStatus:      t.VirusStatus,
+		Type:             t.Tip,
+		Period:           t.Period,
+		PeriodError:      t.PeriodError,
+		UptimeW:          t.UptimeW,
+		UptimeNw:         t.UptimeNw,
+		LastCheck:        parseTime(&t.LastData, "last_data"),
+		LastStatusChange: parseTime(&t.LogData, "log_data"),
+		Timestamp:        time.Now(),
 	}
 }
 
@@ -245,6 +269,7 @@ func (t *TaskStatRaw) ProcessTaskEntry() *TaskStatEntry {
 	for _, resRaw := range t.TasksLogs {
 		TaskStatRes := &TaskLog{
 			Data:        *resRaw.Data,
+			Timestamp:   parseTime(resRaw.Data, "data"),
 			Description: *resRaw.Descr,
 			Status:      int64(*resRaw.Status),
 			MPName:      *resRaw.Tm,
@@ -284,6 +309,20 @@ func parseInt(s *string, fieldName string) int64 {
 	return i
 }
 
+// parseTime safely parse API datetime string to time.Time, zero time is returned if it is absent.
+func parseTime(s *string, fieldName string) time.Time {
+	if s == nil || *s == "" || *s == "0000-00-00 00:00:00" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(apiTimeLayout, *s, apiTimeLocation)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"field": fieldName, "value": *s}).
+			Warn("Failed to parse time value")
+		return time.Time{}
+	}
+	return t
+}
+
 //// Transpose
 //// TransposedTaskLogs
 //// is just a transposed TaskLog structure.
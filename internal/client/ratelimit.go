@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/utils"
+)
+
+const (
+	// rateLimitWindow is slightly longer than 1 second to avoid exact 1 second API restriction
+	rateLimitWindow = 1100 * time.Millisecond
+	// defaultRetryAfter is the pause after a rate limited response without Retry-After header
+	defaultRetryAfter = 5 * time.Second
+	// maxRetryAfter caps the pause requested by Retry-After header
+	maxRetryAfter = 5 * time.Minute
+	// minRateFactor is the lowest share of the global rate the limiter slows down to
+	minRateFactor = 0.125
+	// rateFactorStep is the share of the global rate restored by every successful request
+	rateFactorStep = 0.05
+)
+
+// ErrQuotaExhausted is returned for requests exceeding the daily quota.
+var ErrQuotaExhausted = errors.New("daily API quota is exhausted")
+
+// EndpointLimit is a rate limit budget of the API endpoint.
+type EndpointLimit struct {
+	// RequestsPerSecond is the number of requests per rate limit window (slightly longer than 1 second)
+	RequestsPerSecond float64
+	// Burst is the number of requests allowed at once, 1 if not set
+	Burst int
+}
+
+// tokenBucket is a token bucket, it is not thread-safe.
+type tokenBucket struct {
+	// rate is tokens per second
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket for requestsPerSecond requests per rate limit window.
+func newTokenBucket(limit EndpointLimit, now time.Time) *tokenBucket {
+	burst := float64(max(limit.Burst, 1))
+	return &tokenBucket{
+		rate:   limit.RequestsPerSecond / rateLimitWindow.Seconds(),
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// wait refills the bucket and returns the time until a token is available at rate multiplied by factor.
+func (b *tokenBucket) wait(now time.Time, factor float64) time.Duration {
+	rate := b.rate * factor
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// rateLimiter limits API requests by the global and per-endpoint token buckets and the daily quota.
+// It slows down when the API reports rate limiting and recovers with successful requests.
+// Waiting requests don't block each other, so requests to other endpoints are not delayed by the busy one.
+type rateLimiter struct {
+	mu        sync.Mutex
+	global    *tokenBucket
+	endpoints map[string]*tokenBucket
+
+	// factor is the current share of the global rate
+	factor float64
+	// pausedUntil is the time requests are paused until after a rate limited response
+	pausedUntil time.Time
+
+	dailyQuota int
+	quotaDay   time.Time
+	quotaUsed  int
+}
+
+// newRateLimiter creates a limiter, dailyQuota is zero for no quota.
+func newRateLimiter(global EndpointLimit, endpoints map[string]EndpointLimit, dailyQuota int) *rateLimiter {
+	now := time.Now()
+	l := &rateLimiter{
+		global:     newTokenBucket(global, now),
+		endpoints:  make(map[string]*tokenBucket, len(endpoints)),
+		factor:     1,
+		dailyQuota: dailyQuota,
+		quotaDay:   day(now),
+	}
+	for sa, limit := range endpoints {
+		l.endpoints[sa] = newTokenBucket(limit, now)
+	}
+
+	if dailyQuota > 0 {
+		QuotaRemaining.Set(float64(dailyQuota))
+	} else {
+		QuotaRemaining.Set(-1)
+	}
+	return l
+}
+
+// wait waits until the request to the endpoint is allowed and takes its tokens and quota.
+// It returns ErrQuotaExhausted if the daily quota is used up, or the context error if ctx is done first.
+// This method is thread-safe and can be called from multiple goroutines.
+func (l *rateLimiter) wait(ctx context.Context, sa string) error {
+	started := time.Now()
+	for {
+		l.mu.Lock()
+		now := time.Now()
+
+		if l.dailyQuota > 0 {
+			if today := day(now); today.After(l.quotaDay) {
+				l.quotaDay, l.quotaUsed = today, 0
+			}
+			if l.quotaUsed >= l.dailyQuota {
+				l.mu.Unlock()
+				return ErrQuotaExhausted
+			}
+		}
+
+		waitDuration := l.pausedUntil.Sub(now)
+		waitDuration = max(waitDuration, l.global.wait(now, l.factor))
+		endpoint := l.endpoints[sa]
+		if endpoint != nil {
+			waitDuration = max(waitDuration, endpoint.wait(now, 1))
+		}
+
+		if waitDuration <= 0 {
+			l.global.tokens--
+			if endpoint != nil {
+				endpoint.tokens--
+			}
+			if l.dailyQuota > 0 {
+				l.quotaUsed++
+				QuotaRemaining.Set(float64(l.dailyQuota - l.quotaUsed))
+			}
+			l.mu.Unlock()
+
+			RateLimitWaitSeconds.WithLabelValues(sa).Observe(time.Since(started).Seconds())
+			return nil
+		}
+		l.mu.Unlock()
+
+		logrus.WithField("component", "api_client").WithFields(logrus.Fields{
+			"sa":           sa,
+			"wait_seconds": waitDuration.Seconds(),
+		}).Debug("Rate limit: waiting before next API request")
+		if err := utils.Sleep(ctx, waitDuration); err != nil {
+			return err
+		}
+	}
+}
+
+// throttled pauses all requests for retryAfter (or the default pause if it is zero)
+// and halves the global rate after the API reported rate limiting.
+func (l *rateLimiter) throttled(retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = defaultRetryAfter
+	}
+	retryAfter = min(retryAfter, maxRetryAfter)
+
+	l.mu.Lock()
+	if until := time.Now().Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.factor = max(minRateFactor, l.factor/2)
+	factor := l.factor
+	l.mu.Unlock()
+
+	logrus.WithField("component", "api_client").WithFields(logrus.Fields{
+		"pause_seconds": retryAfter.Seconds(),
+		"rate_factor":   factor,
+	}).Warn("API rate limit reached, slowing down requests")
+}
+
+// succeeded restores the global rate step by step after a successful request.
+func (l *rateLimiter) succeeded() {
+	l.mu.Lock()
+	l.factor = min(1, l.factor+rateFactorStep)
+	l.mu.Unlock()
+}
+
+// day returns the start of the UTC day of t.
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// retryAfter returns the pause requested by Retry-After header, it is zero if the header is absent or invalid.
+func retryAfter(header http.Header) time.Duration {
+	// Retry-After is either delay in seconds or HTTP date
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// 11 requests per 1.1s window is 10 tokens per second
+	limit := EndpointLimit{RequestsPerSecond: 11, Burst: 2}
+
+	tests := []struct {
+		name string
+		// taken is the number of tokens taken at start
+		taken  int
+		after  time.Duration
+		factor float64
+		want   time.Duration
+	}{
+		{name: "full bucket", taken: 0, factor: 1, want: 0},
+		{name: "burst left", taken: 1, factor: 1, want: 0},
+		{name: "empty bucket", taken: 2, factor: 1, want: 100 * time.Millisecond},
+		{name: "partially refilled", taken: 2, after: 40 * time.Millisecond, factor: 1, want: 60 * time.Millisecond},
+		{name: "refilled", taken: 2, after: 100 * time.Millisecond, factor: 1, want: 0},
+		{name: "slowed down", taken: 2, factor: 0.5, want: 200 * time.Millisecond},
+		{name: "slowed down and partially refilled", taken: 2, after: 100 * time.Millisecond, factor: 0.5, want: 100 * time.Millisecond},
+		{name: "clock going backwards", taken: 2, after: -time.Second, factor: 1, want: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(limit, start)
+			b.tokens -= float64(tt.taken)
+			got := b.wait(start.Add(tt.after), tt.factor)
+			if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("got wait %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketBurstCap(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newTokenBucket(EndpointLimit{RequestsPerSecond: 11}, start)
+
+	// a long idle time doesn't accumulate more than the burst (1 if not set)
+	b.wait(start.Add(time.Hour), 1)
+	if b.tokens != 1 {
+		t.Errorf("expected tokens to be capped by the burst, got %v", b.tokens)
+	}
+}
+
+func TestRateLimiterFactor(t *testing.T) {
+	l := newRateLimiter(EndpointLimit{RequestsPerSecond: 1000, Burst: 10}, nil, 0)
+
+	steps := []struct {
+		throttled bool
+		want      float64
+	}{
+		{throttled: true, want: 0.5},
+		{throttled: true, want: 0.25},
+		{throttled: true, want: minRateFactor},
+		{throttled: true, want: minRateFactor},
+		{want: minRateFactor + rateFactorStep},
+	}
+	for i, step := range steps {
+		if step.throttled {
+			l.throttled(time.Millisecond)
+		} else {
+			l.succeeded()
+		}
+		if diff := l.factor - step.want; diff < -1e-9 || diff > 1e-9 {
+			t.Errorf("step %d: got factor %v, want %v", i, l.factor, step.want)
+		}
+	}
+
+	for range 100 {
+		l.succeeded()
+	}
+	if l.factor != 1 {
+		t.Errorf("expected the factor to recover to 1, got %v", l.factor)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("daily quota", func(t *testing.T) {
+		l := newRateLimiter(EndpointLimit{RequestsPerSecond: 1000, Burst: 10}, nil, 2)
+		for i := range 2 {
+			if err := l.wait(ctx, "test"); err != nil {
+				t.Fatalf("request %d: %v", i, err)
+			}
+		}
+		if err := l.wait(ctx, "test"); !errors.Is(err, ErrQuotaExhausted) {
+			t.Errorf("expected the quota to be exhausted, got %v", err)
+		}
+	})
+
+	t.Run("endpoint limit", func(t *testing.T) {
+		l := newRateLimiter(EndpointLimit{RequestsPerSecond: 1000, Burst: 10},
+			map[string]EndpointLimit{"slow": {RequestsPerSecond: 0.011}}, 0)
+		if err := l.wait(ctx, "slow"); err != nil {
+			t.Fatal(err)
+		}
+
+		// other endpoints are not delayed by the exhausted one
+		if err := l.wait(ctx, "fast"); err != nil {
+			t.Fatal(err)
+		}
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := l.wait(timeout, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the endpoint request to wait, got %v", err)
+		}
+	})
+
+	t.Run("pause after rate limiting", func(t *testing.T) {
+		l := newRateLimiter(EndpointLimit{RequestsPerSecond: 1000, Burst: 10}, nil, 0)
+		l.throttled(time.Minute)
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := l.wait(timeout, "test"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected requests to be paused, got %v", err)
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "absent", value: "", want: 0},
+		{name: "seconds", value: "30", want: 30 * time.Second},
+		{name: "negative", value: "-1", want: 0},
+		{name: "invalid", value: "soon", want: 0},
+		{name: "past date", value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			if got := retryAfter(header); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := retryAfter(http.Header{"Retry-After": {future}}); got <= 50*time.Second || got > time.Minute {
+		t.Errorf("got %s for a date in a minute", got)
+	}
+}
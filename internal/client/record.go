@@ -0,0 +1,248 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maskedHeaders are response headers which values are not recorded.
+var maskedHeaders = []string{"Set-Cookie", "Authorization", "Proxy-Authorization"}
+
+// Fixture is a recorded API request and its response (or transport error).
+// The API key is masked, so fixtures may be shared and committed as test data.
+type Fixture struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	// Request is the request key: query parameters without api_key, see fixtureKey
+	Request  string           `json:"request"`
+	Response *FixtureResponse `json:"response,omitempty"`
+	// Error is the transport error message, if no response was received
+	Error string `json:"error,omitempty"`
+}
+
+// FixtureResponse is a recorded API response.
+type FixtureResponse struct {
+	StatusCode int                 `json:"status_code"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Body       string              `json:"body"`
+}
+
+// fixtureKey returns the request key, the same for requests to any endpoint with any API key.
+func fixtureKey(u *url.URL) string {
+	query := u.Query()
+	query.Del("api_key")
+	return query.Encode()
+}
+
+// recordTransport saves every request and response of the next transport to the fixtures directory.
+// Recording stops once the directory has maxFixtures fixtures, so the disk is not filled up.
+type recordTransport struct {
+	next        http.RoundTripper
+	dir         string
+	maxFixtures int64
+	seq         atomic.Int64
+	// fixtures is the number of fixtures in dir, including the ones of previous runs
+	fixtures atomic.Int64
+	full     sync.Once
+}
+
+// NewRecordTransport creates a transport saving masked fixtures of requests sent by next to dir,
+// up to maxFixtures files in dir including the existing ones.
+func NewRecordTransport(next http.RoundTripper, dir string, maxFixtures int) (http.RoundTripper, error) {
+	if maxFixtures <= 0 {
+		return nil, fmt.Errorf("max fixtures must be positive, got %d", maxFixtures)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %w", err)
+	}
+
+	t := &recordTransport{next: next, dir: dir, maxFixtures: int64(maxFixtures)}
+	t.fixtures.Store(int64(len(existing)))
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+// Failing to save a fixture is logged, the response is returned anyway.
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fixture := &Fixture{
+		RecordedAt: time.Now().UTC(),
+		Request:    fixtureKey(req.URL),
+	}
+	apiKey := req.URL.Query().Get("api_key")
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		fixture.Error = maskSecret(err.Error(), apiKey)
+		t.save(fixture, req.URL.Query().Get("sa"))
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	for name, values := range header {
+		for i, value := range values {
+			values[i] = maskSecret(value, apiKey)
+		}
+		header[name] = values
+	}
+	for _, name := range maskedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "***")
+		}
+	}
+	// error payloads and redirects may echo the request, including the API key
+	fixture.Response = &FixtureResponse{
+		StatusCode: resp.StatusCode,
+		Header:     header,
+		Body:       maskSecret(string(body), apiKey),
+	}
+	t.save(fixture, req.URL.Query().Get("sa"))
+	return resp, nil
+}
+
+// save writes the fixture to a new file, files are named in the order of requests.
+// Fixtures over the limit are dropped.
+func (t *recordTransport) save(fixture *Fixture, sa string) {
+	if t.fixtures.Add(1) > t.maxFixtures {
+		t.full.Do(func() {
+			logrus.WithField("component", "api_client").WithFields(logrus.Fields{
+				"dir":          t.dir,
+				"max_fixtures": t.maxFixtures,
+			}).Warn("API fixtures limit is reached, recording is stopped")
+		})
+		return
+	}
+
+	name := fmt.Sprintf("%s-%06d-%s.json", fixture.RecordedAt.Format("20060102T150405.000000"), t.seq.Add(1), sa)
+	path := filepath.Join(t.dir, name)
+
+	// fixtures are meant to be read and edited, so query strings and bodies are not HTML-escaped
+	var content bytes.Buffer
+	encoder := json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(fixture)
+	if err == nil {
+		err = os.WriteFile(path, content.Bytes(), 0o644)
+	}
+	if err != nil {
+		logrus.WithField("component", "api_client").WithField("file", path).
+			Errorf("Failed to save API fixture: %v", err)
+	}
+}
+
+// maskSecret masks the API key in the URLs of s and its raw occurrences, apiKey is empty if unknown.
+func maskSecret(s, apiKey string) string {
+	s = maskAPIKey(s)
+	if apiKey != "" {
+		s = strings.ReplaceAll(s, apiKey, "***")
+	}
+	return s
+}
+
+// replayTransport serves responses from fixtures instead of the network.
+// Fixtures of the same request are served in the recorded order, the last one is repeated once they are over.
+type replayTransport struct {
+	mu       sync.Mutex
+	fixtures map[string][]*Fixture
+	served   map[string]int
+}
+
+// NewReplayTransport creates a transport serving responses from the fixtures saved to dir by NewRecordTransport.
+func NewReplayTransport(dir string) (http.RoundTripper, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fixtures: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures found in '%s'", dir)
+	}
+	sort.Strings(paths)
+
+	t := &replayTransport{
+		fixtures: make(map[string][]*Fixture),
+		served:   make(map[string]int),
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture: %w", err)
+		}
+		fixture := &Fixture{}
+		if err := json.Unmarshal(content, fixture); err != nil {
+			return nil, fmt.Errorf("invalid fixture '%s': %w", path, err)
+		}
+		if fixture.Response == nil && fixture.Error == "" {
+			return nil, fmt.Errorf("invalid fixture '%s': response or error is required", path)
+		}
+		t.fixtures[fixture.Request] = append(t.fixtures[fixture.Request], fixture)
+	}
+
+	logrus.WithField("component", "api_client").WithFields(logrus.Fields{
+		"fixtures": len(paths),
+		"requests": len(t.fixtures),
+	}).Info("Replaying API responses from fixtures")
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	key := fixtureKey(req.URL)
+
+	t.mu.Lock()
+	fixtures := t.fixtures[key]
+	if len(fixtures) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no fixture for request '%s'", key)
+	}
+	i := min(t.served[key], len(fixtures)-1)
+	t.served[key]++
+	t.mu.Unlock()
+
+	fixture := fixtures[i]
+	if fixture.Response == nil {
+		return nil, errors.New(fixture.Error)
+	}
+
+	header := http.Header(fixture.Response.Header).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fixture.Response.Body)),
+		ContentLength: int64(len(fixture.Response.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFixtureClient creates a client sending requests through the transport.
+func newFixtureClient(t *testing.T, endpoint string, transport http.RoundTripper) *Client {
+	t.Helper()
+	c, err := New(&Config{APIKey: "secret-key", Endpoint: endpoint, RequestRetries: 1, MaxRequestsPerSecond: 100},
+		&http.Client{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// TestReplayFixtures replays the API responses saved to testdata by the record mode.
+func TestReplayFixtures(t *testing.T) {
+	transport, err := NewReplayTransport(filepath.Join("testdata", "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newFixtureClient(t, "http://replay.invalid", transport)
+	ctx := context.Background()
+
+	mps, err := c.GetMPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mps) != 2 || mps[0].ID != "1" || mps[0].IP != "192.0.2.1" || mps[1].Status != 0 {
+		t.Errorf("unexpected monitoring points %+v", mps)
+	}
+
+	entries, err := c.GetTaskGraphStat(ctx, 1001, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if res := entries[0].Result[0]; res.Total != 0.25 || res.Speed != 20480 || res.Timestamp != 1767268800 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	// null measurements of an unavailable MP
+	if res := entries[1].Result[0]; res.Total != 0 || res.Timestamp != 1767268800 {
+		t.Errorf("unexpected result of MP without measurements %+v", res)
+	}
+
+	// requests without a fixture fail
+	if _, err := c.GetTaskGraphStat(ctx, 1002, 1); err == nil {
+		t.Error("expected a request without a fixture to fail")
+	}
+}
+
+func TestRecordMasksAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "<"+r.URL.String()+">; rel=self")
+		w.Header().Set("Set-Cookie", "session=1")
+		_, _ = w.Write([]byte(`{"error":"Wrong API key secret-key"}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewRecordTransport(http.DefaultTransport, dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFixtureClient(t, srv.URL, recorder).GetMPs(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected 1 fixture, got %v (%v)", paths, err)
+	}
+	content, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret-key") {
+		t.Errorf("the API key is recorded:\n%s", content)
+	}
+	if strings.Contains(string(content), "session=1") {
+		t.Errorf("the cookie is recorded:\n%s", content)
+	}
+
+	// the masked fixture is replayed with the same error
+	replay, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFixtureClient(t, "http://replay.invalid", replay).GetMPs(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected the replayed unauthorized error, got %v", err)
+	}
+}
+
+func TestRecordMaxFixtures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	// a fixture of the previous run counts too
+	if err := os.WriteFile(filepath.Join(dir, "previous.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := NewRecordTransport(http.DefaultTransport, dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newFixtureClient(t, srv.URL, recorder)
+	for range 5 {
+		// responses are returned after the limit is reached
+		if _, err := c.GetMPs(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 3 {
+		t.Errorf("expected 3 fixtures, got %d", len(paths))
+	}
+}
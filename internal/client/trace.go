@@ -0,0 +1,67 @@
+package client
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// requestTrace observes durations of HTTP request phases in RequestPhaseDurationSeconds.
+// Phases of reused connections (DNS, connect, TLS) are not observed.
+// Connection attempts may run concurrently, so only the first finished one is observed.
+type requestTrace struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+}
+
+// clientTrace returns hooks of the trace for httptrace.WithClientTrace.
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.start(&t.dnsStart) },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.done("dns", &t.dnsStart, info.Err)
+		},
+		ConnectStart: func(string, string) { t.start(&t.connectStart) },
+		ConnectDone: func(_, _ string, err error) {
+			t.done("connect", &t.connectStart, err)
+		},
+		TLSHandshakeStart: func() { t.start(&t.tlsStart) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.done("tls", &t.tlsStart, err)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				t.start(&t.wroteRequest)
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.done("first_byte", &t.wroteRequest, nil)
+		},
+	}
+}
+
+// start records the start of the phase, if it is not started yet.
+func (t *requestTrace) start(started *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if started.IsZero() {
+		*started = time.Now()
+	}
+}
+
+// done observes the successful phase duration once.
+func (t *requestTrace) done(phase string, started *time.Time, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if started.IsZero() {
+		return
+	}
+	if err == nil {
+		RequestPhaseDurationSeconds.WithLabelValues(phase).Observe(time.Since(*started).Seconds())
+	}
+	*started = time.Time{}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportConfig contains the HTTP transport settings used to reach the API.
+type TransportConfig struct {
+	// ProxyURL is an HTTP(S) proxy for API requests.
+	// If empty, HTTPS_PROXY/HTTP_PROXY/NO_PROXY environment variables are used.
+	ProxyURL string
+	// CAFile is a PEM bundle with extra CAs trusted in addition to the system ones
+	CAFile string
+	// Timeout limits the whole HTTP request, zero means no limit
+	Timeout time.Duration
+	// RecordDir is a directory to save fixtures of all API requests to, see NewRecordTransport
+	RecordDir string
+	// RecordMaxFixtures limits the number of fixture files in RecordDir, including the existing ones
+	RecordMaxFixtures int
+	// ReplayDir is a directory with fixtures to serve responses from instead of the network, see NewReplayTransport.
+	// Proxy and CA settings are not used in replay mode.
+	ReplayDir string
+}
+
+// NewHTTPClient creates an HTTP client for the API according to the transport settings.
+func NewHTTPClient(conf *TransportConfig) (*http.Client, error) {
+	if conf.ReplayDir != "" {
+		if conf.RecordDir != "" {
+			return nil, fmt.Errorf("record and replay modes can't be used together")
+		}
+		transport, err := NewReplayTransport(conf.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{
+			Transport: transport,
+			Timeout:   conf.Timeout,
+		}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if conf.ProxyURL != "" {
+		proxyURL, err := url.Parse(conf.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+			return nil, fmt.Errorf("invalid proxy URL '%s': http or https scheme is expected", maskProxyURL(proxyURL))
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA file '%s'", conf.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	if conf.RecordDir == "" {
+		return &http.Client{
+			Transport: transport,
+			Timeout:   conf.Timeout,
+		}, nil
+	}
+
+	recorder, err := NewRecordTransport(transport, conf.RecordDir, conf.RecordMaxFixtures)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: recorder,
+		Timeout:   conf.Timeout,
+	}, nil
+}
+
+// maskProxyURL hides proxy credentials for safe logging.
+func maskProxyURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	masked := *u
+	masked.User = url.User("***")
+	return masked.String()
+}
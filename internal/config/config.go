@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -11,8 +12,21 @@ import (
 
 // Config is exporter's configuration parameters defined by ENV or execution keys.
 type Config struct {
+	ConfigFile               string
 	APIKey                   string
+	APIEndpoint              string
+	APIProxyURL              string
+	APICAFile                string
+	APITimeout               time.Duration
 	TaskIDs                  []int
+	Discovery                bool
+	DiscoveryInterval        time.Duration
+	DiscoveryIncludeIDs      []IDRange
+	DiscoveryExcludeIDs      []IDRange
+	DiscoveryNameRegex       *regexp.Regexp
+	DiscoveryExcludeRegex    *regexp.Regexp
+	DiscoveryTypes           []string
+	DiscoveryEnabledOnly     bool
 	EngMPNames               bool
 	ApiUpdateDelay           time.Duration
 	ApiDataTimeStep          time.Duration
@@ -21,37 +35,168 @@ type Config struct {
 	RequestDelay             time.Duration
 	RequestRetries           int
 	MaxRequestsPerSecond     int
+	APIBurst                 int
+	APIEndpointLimits        map[string]EndpointLimit
+	APIDailyQuota            int
+	APICircuitThreshold      int
+	APICircuitOpenDuration   time.Duration
+	APIRecordDir             string
+	APIRecordMaxFixtures     int
+	APIReplayDir             string
 	ListenAddress            string
+	WebConfigFile            string
 	LocationsFilePath        string
 	LogLevel                 string
+	BackfillWindow           time.Duration
+	BackfillFile             string
+	RemoteWriteURL           string
+	RemoteWriteQueueDir      string
+	RemoteWriteQueueSize     int
+	RemoteWriteTimeout       time.Duration
+	OTLPEndpoint             string
+	OTLPHeaders              map[string]string
+	OTLPAccount              string
+	OTLPInterval             time.Duration
+	OTLPTimeout              time.Duration
+	InfluxDBURL              string
+	InfluxDBVersion          int
+	InfluxDBDatabase         string
+	InfluxDBOrg              string
+	InfluxDBToken            string
+	GraphiteAddress          string
+	GraphitePrefix           string
+	SinkBatchSize            int
+	SinkFlushInterval        time.Duration
+	SinkMaxRetries           int
+	SinkTimeout              time.Duration
+	HistoryDir               string
+	HistoryRetention         time.Duration
+	HistoryMaxPoints         int
+	StateDir                 string
+	ReadinessMaxIntervals    int
+	// Tasks contains per-task overrides from the config file
+	Tasks map[int]*TaskConfig
 }
 
-// New create exporter config.
+// New create exporter config from execution keys, ENV and config file.
 func New() (*Config, error) {
+	return Load(os.Args[1:])
+}
+
+// Load create exporter config from the given execution keys, ENV and config file.
+// Precedence (highest first): execution keys, ENV, config file, defaults.
+func Load(args []string) (*Config, error) {
 	cfg := &Config{}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	fs.StringVar(&cfg.ConfigFile, "config", envString("CONFIG_FILE", ""), "Path to the YAML/JSON config file")
+	fs.StringVar(&cfg.APIKey, "api-key", envString("API_KEY", ""), "API key for Ping-Admin")
+	fs.StringVar(&cfg.APIEndpoint, "api-endpoint", envString("API_ENDPOINT", "https://ping-admin.com"), "Base URL of Ping-Admin API (or its mirror, proxy or fake)")
+	fs.StringVar(&cfg.APIProxyURL, "api-proxy-url", envString("API_PROXY_URL", ""), "HTTP(S) proxy for API requests (HTTPS_PROXY/HTTP_PROXY/NO_PROXY are used if empty)")
+	fs.StringVar(&cfg.APICAFile, "api-ca-file", envString("API_CA_FILE", ""), "Path to a PEM bundle with extra CAs to trust for API requests")
+	fs.DurationVar(&cfg.APITimeout, "api-timeout", envDuration("API_TIMEOUT", 30*time.Second), "Timeout for a single API request")
+	taskIDsStr := fs.String("task-ids", envString("TASK_IDS", ""), "Comma-separated list of task IDs")
+	fs.BoolVar(&cfg.Discovery, "discovery", envBool("DISCOVERY", false), "Export all account tasks matching discovery rules in addition to task IDs")
+	fs.DurationVar(&cfg.DiscoveryInterval, "discovery-interval", envDuration("DISCOVERY_INTERVAL", 10*time.Minute), "Interval between account tasks discovery runs")
+	includeIDsStr := fs.String("discovery-include-ids", envString("DISCOVERY_INCLUDE_IDS", ""), "Comma-separated list of task IDs and ID ranges (e.g. 100-200) to discover, all if empty")
+	excludeIDsStr := fs.String("discovery-exclude-ids", envString("DISCOVERY_EXCLUDE_IDS", ""), "Comma-separated list of task IDs and ID ranges (e.g. 100-200) to skip")
+	nameRegexStr := fs.String("discovery-name-regex", envString("DISCOVERY_NAME_REGEX", ""), "Regular expression task names must match to be discovered")
+	excludeRegexStr := fs.String("discovery-exclude-name-regex", envString("DISCOVERY_EXCLUDE_NAME_REGEX", ""), "Regular expression task names must not match to be discovered")
+	typesStr := fs.String("discovery-types", envString("DISCOVERY_TYPES", ""), "Comma-separated list of task check types to discover, all if empty")
+	fs.BoolVar(&cfg.DiscoveryEnabledOnly, "discovery-enabled-only", envBool("DISCOVERY_ENABLED_ONLY", true), "Discover enabled tasks only")
+	fs.BoolVar(&cfg.EngMPNames, "eng-mp-names", envBool("ENG_MP_NAMES", true), "Translate monitoring points (MP) names to English")
+	fs.DurationVar(&cfg.ApiUpdateDelay, "api-update-delay", envDuration("API_UPDATE_DELAY", 4*time.Minute), "Fixed Ping-Admin API delay for new data update")
+	fs.DurationVar(&cfg.ApiDataTimeStep, "api-data-time-step", envDuration("API_DATA_TIME_STEP", 3*time.Minute), "Fixed Ping-Admin API time between data points")
+	fs.DurationVar(&cfg.RefreshInterval, "refresh-interval", envDuration("REFRESH_INTERVAL", 3*time.Minute), "Exporter's refresh interval")
+	fs.IntVar(&cfg.MaxAllowedStalenessSteps, "max-allowed-staleness-steps", envInt("MAX_ALLOWED_STALENESS_STEPS", 3), "Maximum allowed staleness steps")
+	fs.DurationVar(&cfg.RequestDelay, "request-delay", envDuration("REQUEST_DELAY", 3*time.Second), "Minimum delay before API request (will be set to random between this and doubled values)")
+	fs.IntVar(&cfg.RequestRetries, "request-retries", envInt("REQUEST_RETRIES", 3), "Maximum number of retries for API requests")
+	fs.IntVar(&cfg.MaxRequestsPerSecond, "max-requests-per-second", envInt("MAX_REQUESTS_PER_SECOND", 2), "Maximum number of API requests allowed per second")
+	fs.IntVar(&cfg.APIBurst, "api-burst", envInt("API_BURST", 1), "Number of API requests allowed at once within the per second limit")
+	endpointLimitsStr := fs.String("api-endpoint-limits", envString("API_ENDPOINT_LIMITS", ""), "Comma-separated list of per-endpoint API rate limits 'sa=requests_per_second[:burst]' (e.g. task_graph_stat=0.5,tm=2:2)")
+	fs.IntVar(&cfg.APICircuitThreshold, "api-circuit-failure-threshold", envInt("API_CIRCUIT_FAILURE_THRESHOLD", 5), "Number of consecutive failed API requests after which requests fail fast, circuit breaker is disabled if 0")
+	fs.DurationVar(&cfg.APICircuitOpenDuration, "api-circuit-open-duration", envDuration("API_CIRCUIT_OPEN_DURATION", time.Minute), "Time API requests fail fast before a probe request is sent")
+	fs.StringVar(&cfg.APIRecordDir, "record-dir", envString("RECORD_DIR", ""), "Directory to save masked fixtures of all API requests and responses to")
+	fs.IntVar(&cfg.APIRecordMaxFixtures, "record-max-fixtures", envInt("RECORD_MAX_FIXTURES", 10000), "Maximum number of fixture files in the record directory, recording stops once it is reached")
+	fs.StringVar(&cfg.APIReplayDir, "replay-dir", envString("REPLAY_DIR", ""), "Directory with recorded fixtures to serve API responses from instead of the network")
+	fs.IntVar(&cfg.APIDailyQuota, "api-daily-quota", envInt("API_DAILY_QUOTA", 0), "Maximum number of API requests per UTC day, requests over it fail fast, disabled if 0")
+	fs.StringVar(&cfg.ListenAddress, "listen-address", envString("LISTEN_ADDRESS", ":8080"), "Address to listen on for HTTP requests")
+	fs.StringVar(&cfg.WebConfigFile, "web-config-file", envString("WEB_CONFIG_FILE", ""), "Path to the web config file with TLS and authentication settings (Prometheus exporter-toolkit format)")
+	fs.StringVar(&cfg.LocationsFilePath, "locations-file", envString("LOCATIONS_FILE", "locations.json"), "Path to the locations.json translation file")
+	fs.StringVar(&cfg.LogLevel, "log-level", envString("LOG_LEVEL", "info"), "Log level (e.g., debug, info, warn, error)")
+	fs.DurationVar(&cfg.BackfillWindow, "backfill-window", envDuration("BACKFILL_WINDOW", 0), "Window of MP data history to backfill on startup, disabled if 0")
+	fs.StringVar(&cfg.BackfillFile, "backfill-file", envString("BACKFILL_FILE", ""), "Path to the OpenMetrics file for backfilled history (for promtool tsdb create-blocks-from openmetrics)")
+	fs.StringVar(&cfg.RemoteWriteURL, "remote-write-url", envString("REMOTE_WRITE_URL", ""), "Prometheus remote write endpoint to push MP measurements to, disabled if empty")
+	fs.StringVar(&cfg.RemoteWriteQueueDir, "remote-write-queue-dir", envString("REMOTE_WRITE_QUEUE_DIR", "remote-write-queue"), "Directory of the on-disk queue of remote write batches")
+	fs.IntVar(&cfg.RemoteWriteQueueSize, "remote-write-queue-size", envInt("REMOTE_WRITE_QUEUE_SIZE", 1000), "Maximum number of queued remote write batches, the oldest ones are dropped")
+	fs.DurationVar(&cfg.RemoteWriteTimeout, "remote-write-timeout", envDuration("REMOTE_WRITE_TIMEOUT", 30*time.Second), "Timeout for a single remote write request")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", envString("OTLP_ENDPOINT", ""), "OTLP/HTTP metrics endpoint (e.g. http://collector:4318/v1/metrics), disabled if empty")
+	otlpHeadersStr := fs.String("otlp-headers", envString("OTLP_HEADERS", ""), "Comma-separated list of extra OTLP request headers (e.g. Authorization=Bearer xxx)")
+	fs.StringVar(&cfg.OTLPAccount, "otlp-account", envString("OTLP_ACCOUNT", ""), "Ping-Admin account name added to OTLP resource attributes")
+	fs.DurationVar(&cfg.OTLPInterval, "otlp-interval", envDuration("OTLP_INTERVAL", time.Minute), "Interval between OTLP exports")
+	fs.DurationVar(&cfg.OTLPTimeout, "otlp-timeout", envDuration("OTLP_TIMEOUT", 30*time.Second), "Timeout for a single OTLP export request")
+	fs.StringVar(&cfg.InfluxDBURL, "influxdb-url", envString("INFLUXDB_URL", ""), "InfluxDB base URL to write MP measurements to (e.g. http://influxdb:8086), disabled if empty")
+	fs.IntVar(&cfg.InfluxDBVersion, "influxdb-version", envInt("INFLUXDB_VERSION", 2), "InfluxDB write API version (1 or 2)")
+	fs.StringVar(&cfg.InfluxDBDatabase, "influxdb-database", envString("INFLUXDB_DATABASE", ""), "InfluxDB database (v1) or bucket (v2)")
+	fs.StringVar(&cfg.InfluxDBOrg, "influxdb-org", envString("INFLUXDB_ORG", ""), "InfluxDB organization (v2)")
+	fs.StringVar(&cfg.InfluxDBToken, "influxdb-token", envString("INFLUXDB_TOKEN", ""), "InfluxDB API token (v2) or 'username:password' (v1)")
+	fs.StringVar(&cfg.GraphiteAddress, "graphite-address", envString("GRAPHITE_ADDRESS", ""), "Graphite plaintext protocol address to write MP measurements to (e.g. graphite:2003), disabled if empty")
+	fs.StringVar(&cfg.GraphitePrefix, "graphite-prefix", envString("GRAPHITE_PREFIX", "apatit"), "Prefix of Graphite metric paths")
+	fs.IntVar(&cfg.SinkBatchSize, "sink-batch-size", envInt("SINK_BATCH_SIZE", 1000), "Maximum number of MP samples in a batch written to InfluxDB or Graphite")
+	fs.DurationVar(&cfg.SinkFlushInterval, "sink-flush-interval", envDuration("SINK_FLUSH_INTERVAL", 10*time.Second), "Maximum time MP samples wait for a batch written to InfluxDB or Graphite")
+	fs.IntVar(&cfg.SinkMaxRetries, "sink-max-retries", envInt("SINK_MAX_RETRIES", 3), "Maximum number of retries of a failed batch written to InfluxDB or Graphite")
+	fs.StringVar(&cfg.HistoryDir, "history-dir", envString("HISTORY_DIR", ""), "Directory of the local MP measurements history store, disabled if empty")
+	fs.DurationVar(&cfg.HistoryRetention, "history-retention", envDuration("HISTORY_RETENTION", 7*24*time.Hour), "Retention of the local MP measurements history")
+	fs.IntVar(&cfg.HistoryMaxPoints, "history-max-points", envInt("HISTORY_MAX_POINTS", 10080), "Maximum number of stored points of each task MP")
+	fs.IntVar(&cfg.ReadinessMaxIntervals, "readiness-max-intervals", envInt("READINESS_MAX_INTERVALS", 3), "Number of refresh intervals without a successful cycle after which the exporter is not ready")
+	fs.StringVar(&cfg.StateDir, "state-dir", envString("STATE_DIR", ""), "Directory of the exporter state restored at startup, disabled if empty")
+	fs.DurationVar(&cfg.SinkTimeout, "sink-timeout", envDuration("SINK_TIMEOUT", 30*time.Second), "Timeout for a single batch write to InfluxDB or Graphite")
 
-	flag.StringVar(&cfg.APIKey, "api-key", envString("API_KEY", ""), "API key for Ping-Admin")
-	taskIDsStr := flag.String("task-ids", envString("TASK_IDS", ""), "Comma-separated list of task IDs")
-	flag.BoolVar(&cfg.EngMPNames, "eng-mp-names", envBool("ENG_MP_NAMES", true), "Translate monitoring points (MP) names to English")
-	flag.DurationVar(&cfg.ApiUpdateDelay, "api-update-delay", envDuration("API_UPDATE_DELAY", 4*time.Minute), "Fixed Ping-Admin API delay for new data update")
-	flag.DurationVar(&cfg.ApiDataTimeStep, "api-data-time-step", envDuration("API_DATA_TIME_STEP", 3*time.Minute), "Fixed Ping-Admin API time between data points")
-	flag.DurationVar(&cfg.RefreshInterval, "refresh-interval", envDuration("REFRESH_INTERVAL", 3*time.Minute), "Exporter's refresh interval")
-	flag.IntVar(&cfg.MaxAllowedStalenessSteps, "max-allowed-staleness-steps", envInt("MAX_ALLOWED_STALENESS_STEPS", 3), "Maximum allowed staleness steps")
-	flag.DurationVar(&cfg.RequestDelay, "request-delay", envDuration("REQUEST_DELAY", 3*time.Second), "Minimum delay before API request (will be set to random between this and doubled values)")
-	flag.IntVar(&cfg.RequestRetries, "request-retries", envInt("REQUEST_RETRIES", 3), "Maximum number of retries for API requests")
-	flag.IntVar(&cfg.MaxRequestsPerSecond, "max-requests-per-second", envInt("MAX_REQUESTS_PER_SECOND", 2), "Maximum number of API requests allowed per second")
-	flag.StringVar(&cfg.ListenAddress, "listen-address", envString("LISTEN_ADDRESS", ":8080"), "Address to listen on for HTTP requests")
-	flag.StringVar(&cfg.LocationsFilePath, "locations-file", envString("LOCATIONS_FILE", "locations.json"), "Path to the locations.json translation file")
-	flag.StringVar(&cfg.LogLevel, "log-level", envString("LOG_LEVEL", "info"), "Log level (e.g., debug, info, warn, error)")
-
-	flag.Parse()
-
-	if cfg.APIKey == "" {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if cfg.ConfigFile != "" {
+		file, err := loadFile(cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := file.apply(fs); err != nil {
+			return nil, fmt.Errorf("invalid config file '%s': %w", cfg.ConfigFile, err)
+		}
+		cfg.Tasks = file.tasks
+	}
+
+	if cfg.APIRecordDir != "" && cfg.APIReplayDir != "" {
+		return nil, fmt.Errorf("record dir and replay dir can't be set together")
+	}
+	if cfg.APIRecordMaxFixtures <= 0 {
+		return nil, fmt.Errorf("record max fixtures must be positive, got %d", cfg.APIRecordMaxFixtures)
+	}
+
+	// the API key is masked in fixtures, so any key may be used in replay mode
+	if cfg.APIKey == "" && cfg.APIReplayDir == "" {
 		return nil, fmt.Errorf("API key is required, please set --api-key or API_KEY environment variable")
 	}
 
-	if *taskIDsStr == "" {
-		return nil, fmt.Errorf("task IDs are required, please set --task-ids or TASK_IDS environment variable")
+	if cfg.APITimeout <= 0 {
+		return nil, fmt.Errorf("API timeout must be positive, got %s", cfg.APITimeout)
+	}
+
+	if cfg.RequestDelay < 0 {
+		return nil, fmt.Errorf("request delay must not be negative, got %s", cfg.RequestDelay)
+	}
+
+	if cfg.APIBurst <= 0 || cfg.APIDailyQuota < 0 {
+		return nil, fmt.Errorf("API burst must be positive and daily quota must not be negative, got %d and %d", cfg.APIBurst, cfg.APIDailyQuota)
+	}
+
+	if cfg.APICircuitThreshold < 0 || cfg.APICircuitThreshold > 0 && cfg.APICircuitOpenDuration <= 0 {
+		return nil, fmt.Errorf("API circuit failure threshold must not be negative and open duration must be positive, got %d and %s", cfg.APICircuitThreshold, cfg.APICircuitOpenDuration)
+	}
+
+	if *taskIDsStr == "" && !cfg.Discovery {
+		return nil, fmt.Errorf("task IDs are required, please set --task-ids or TASK_IDS environment variable (or enable --discovery)")
 	}
 
 	var err error
@@ -60,6 +205,59 @@ func New() (*Config, error) {
 		return nil, fmt.Errorf("invalid task IDs format: %w", err)
 	}
 
+	if cfg.Discovery && cfg.DiscoveryInterval <= 0 {
+		return nil, fmt.Errorf("discovery interval must be positive, got %s", cfg.DiscoveryInterval)
+	}
+
+	if cfg.APIEndpointLimits, err = parseEndpointLimits(*endpointLimitsStr); err != nil {
+		return nil, fmt.Errorf("invalid API endpoint limits format: %w", err)
+	}
+
+	if cfg.DiscoveryIncludeIDs, err = parseIDRanges(*includeIDsStr); err != nil {
+		return nil, fmt.Errorf("invalid discovery include IDs format: %w", err)
+	}
+	if cfg.DiscoveryExcludeIDs, err = parseIDRanges(*excludeIDsStr); err != nil {
+		return nil, fmt.Errorf("invalid discovery exclude IDs format: %w", err)
+	}
+	if cfg.DiscoveryNameRegex, err = parseRegex(*nameRegexStr); err != nil {
+		return nil, fmt.Errorf("invalid discovery name regex: %w", err)
+	}
+	if cfg.DiscoveryExcludeRegex, err = parseRegex(*excludeRegexStr); err != nil {
+		return nil, fmt.Errorf("invalid discovery exclude name regex: %w", err)
+	}
+	cfg.DiscoveryTypes = parseList(*typesStr)
+
+	if cfg.BackfillWindow < 0 {
+		return nil, fmt.Errorf("backfill window must not be negative, got %s", cfg.BackfillWindow)
+	}
+	if cfg.BackfillWindow > 0 && cfg.BackfillFile == "" && !cfg.HasSinks() {
+		return nil, fmt.Errorf("backfill file or sink is required, please set --backfill-file, --remote-write-url, --influxdb-url, --graphite-address or --history-dir")
+	}
+
+	if cfg.RemoteWriteURL != "" && cfg.RemoteWriteTimeout <= 0 {
+		return nil, fmt.Errorf("remote write timeout must be positive, got %s", cfg.RemoteWriteTimeout)
+	}
+
+	if (cfg.InfluxDBURL != "" || cfg.GraphiteAddress != "") &&
+		(cfg.SinkBatchSize <= 0 || cfg.SinkFlushInterval <= 0 || cfg.SinkMaxRetries < 0 || cfg.SinkTimeout <= 0) {
+		return nil, fmt.Errorf("sink batch size, flush interval and timeout must be positive, max retries must not be negative")
+	}
+
+	if cfg.HistoryDir != "" && (cfg.HistoryRetention <= 0 || cfg.HistoryMaxPoints <= 0) {
+		return nil, fmt.Errorf("history retention and max points must be positive, got %s and %d", cfg.HistoryRetention, cfg.HistoryMaxPoints)
+	}
+
+	if cfg.OTLPHeaders, err = parseHeaders(*otlpHeadersStr); err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers format: %w", err)
+	}
+	if cfg.OTLPEndpoint != "" && (cfg.OTLPInterval <= 0 || cfg.OTLPTimeout <= 0) {
+		return nil, fmt.Errorf("OTLP interval and timeout must be positive, got %s and %s", cfg.OTLPInterval, cfg.OTLPTimeout)
+	}
+
+	if cfg.ReadinessMaxIntervals <= 0 {
+		return nil, fmt.Errorf("readiness max intervals must be positive, got %d", cfg.ReadinessMaxIntervals)
+	}
+
 	return cfg, nil
 }
 
@@ -84,6 +282,118 @@ func parseTaskIDs(taskIDsStr string) ([]int, error) {
 	return ids, nil
 }
 
+// HasSinks checks if any MP samples sink (remote write, InfluxDB, Graphite, history store) is enabled.
+func (c *Config) HasSinks() bool {
+	return c.RemoteWriteURL != "" || c.InfluxDBURL != "" || c.GraphiteAddress != "" || c.HistoryDir != ""
+}
+
+// TaskConfig returns the config file overrides for the task, or empty overrides if there are none.
+func (c *Config) TaskConfig(taskID int) *TaskConfig {
+	if taskCfg, ok := c.Tasks[taskID]; ok {
+		return taskCfg
+	}
+	return &TaskConfig{ID: taskID}
+}
+
+// IDRange is an inclusive range of task IDs.
+type IDRange struct {
+	From int
+	To   int
+}
+
+// Contains checks if the ID is within the range.
+func (r IDRange) Contains(id int) bool {
+	return id >= r.From && id <= r.To
+}
+
+// parseIDRanges parses comma-separated IDs and ID ranges like '1,5-10'.
+func parseIDRanges(rangesStr string) ([]IDRange, error) {
+	ranges := make([]IDRange, 0)
+	for _, part := range parseList(rangesStr) {
+		fromStr, toStr, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(fromStr))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid integer", fromStr)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(toStr))
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a valid integer", toStr)
+			}
+		}
+		if from > to {
+			return nil, fmt.Errorf("'%s' is not a valid range", part)
+		}
+		ranges = append(ranges, IDRange{From: from, To: to})
+	}
+	return ranges, nil
+}
+
+// EndpointLimit is a rate limit of the API endpoint ('sa' parameter).
+type EndpointLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// parseEndpointLimits parses comma-separated endpoint limits like 'task_graph_stat=0.5,tm=2:2'.
+func parseEndpointLimits(limitsStr string) (map[string]EndpointLimit, error) {
+	limits := make(map[string]EndpointLimit)
+	for _, item := range parseList(limitsStr) {
+		sa, limitStr, ok := strings.Cut(item, "=")
+		if sa = strings.TrimSpace(sa); !ok || sa == "" {
+			return nil, fmt.Errorf("'%s' is not a valid endpoint limit, expected sa=requests_per_second[:burst]", item)
+		}
+		rateStr, burstStr, hasBurst := strings.Cut(limitStr, ":")
+
+		limit := EndpointLimit{Burst: 1}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("'%s' is not a valid requests per second number of '%s' endpoint", rateStr, sa)
+		}
+		limit.RequestsPerSecond = rate
+		if hasBurst {
+			if limit.Burst, err = strconv.Atoi(strings.TrimSpace(burstStr)); err != nil || limit.Burst <= 0 {
+				return nil, fmt.Errorf("'%s' is not a valid burst of '%s' endpoint", burstStr, sa)
+			}
+		}
+		limits[sa] = limit
+	}
+	return limits, nil
+}
+
+// parseRegex compiles a regular expression, empty string means no regex.
+func parseRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// parseList splits comma-separated list and drops empty items.
+func parseList(listStr string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(listStr, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseHeaders parses comma-separated headers like 'Name=value,Other=value'.
+func parseHeaders(headersStr string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, item := range parseList(headersStr) {
+		name, value, ok := strings.Cut(item, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return nil, fmt.Errorf("'%s' is not a valid header, expected Name=value", item)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
 // envString string env variables helper.
 func envString(key, def string) string {
 	if v := os.Getenv(key); v != "" {
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes the config file content to a temporary file and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+api_key: file-key
+task_ids: [1001, 1002]
+refresh_interval: 5m
+request_delay: 1s
+max_requests_per_second: 5
+tasks:
+  - id: 1001
+    api_data_time_step: 5m
+    eng_mp_names: false
+    labels:
+      team: web
+`)
+	t.Setenv("REFRESH_INTERVAL", "7m")
+
+	cfg, err := Load([]string{"--config", path, "--request-delay", "2s"})
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "execution key over config file", got: cfg.RequestDelay, want: 2 * time.Second},
+		{name: "ENV over config file", got: cfg.RefreshInterval, want: 7 * time.Minute},
+		{name: "config file over default", got: cfg.MaxRequestsPerSecond, want: 5},
+		{name: "config file list", got: len(cfg.TaskIDs), want: 2},
+		{name: "default", got: cfg.ApiDataTimeStep, want: 3 * time.Minute},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	taskCfg := cfg.TaskConfig(1001)
+	if taskCfg.ApiDataTimeStep == nil || *taskCfg.ApiDataTimeStep != 5*time.Minute {
+		t.Errorf("expected api_data_time_step override of task 1001, got %v", taskCfg.ApiDataTimeStep)
+	}
+	if taskCfg.EngMPNames == nil || *taskCfg.EngMPNames {
+		t.Errorf("expected eng_mp_names override of task 1001, got %v", taskCfg.EngMPNames)
+	}
+	if taskCfg.Labels["team"] != "web" {
+		t.Errorf("expected labels of task 1001, got %v", taskCfg.Labels)
+	}
+	// tasks without overrides use the global values
+	if taskCfg := cfg.TaskConfig(1002); taskCfg.ID != 1002 || taskCfg.ApiDataTimeStep != nil || taskCfg.Labels != nil {
+		t.Errorf("expected no overrides of task 1002, got %+v", taskCfg)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		file string
+		// err is a part of the expected error message
+		err string
+	}{
+		{name: "missing API key", args: []string{"--task-ids", "1"}, err: "API key is required"},
+		{name: "missing task IDs", args: []string{"--api-key", "x"}, err: "task IDs are required"},
+		{name: "invalid task IDs", args: []string{"--api-key", "x", "--task-ids", "1,a"}, err: "invalid task IDs"},
+		{name: "negative request delay", args: []string{"--api-key", "x", "--task-ids", "1", "--request-delay", "-1s"}, err: "request delay must not be negative"},
+		{name: "unknown file option", file: "api_key: x\ntask_ids: 1\nunknown_option: 1\n", err: "unknown option 'unknown_option'"},
+		{name: "invalid file value", file: "api_key: x\ntask_ids: 1\nrefresh_interval: soon\n", err: "invalid value of 'refresh_interval'"},
+		{name: "invalid label name", file: "api_key: x\ntask_ids: 1\ntasks:\n  - id: 1\n    labels:\n      1team: web\n", err: "not a valid label name"},
+		{name: "reserved label", file: "api_key: x\ntask_ids: 1\ntasks:\n  - id: 1\n    labels:\n      task_id: web\n", err: "label 'task_id' is reserved"},
+		{name: "duplicate task", file: "api_key: x\ntask_ids: 1\ntasks:\n  - id: 1\n  - id: 1\n", err: "more than once"},
+		{name: "invalid task ID", file: "api_key: x\ntask_ids: 1\ntasks:\n  - id: 0\n", err: "task ID must be positive"},
+		{name: "invalid task data time step", file: "api_key: x\ntask_ids: 1\ntasks:\n  - id: 1\n    api_data_time_step: 0s\n", err: "api_data_time_step must be positive"},
+	}
+	// the execution environment must not affect the checks
+	for _, env := range []string{"API_KEY", "TASK_IDS", "CONFIG_FILE", "REQUEST_DELAY", "REFRESH_INTERVAL"} {
+		t.Setenv(env, "")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"--config", writeConfigFile(t, tt.file)}, args...)
+			}
+			_, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// labelNameRe is a valid Prometheus label name
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels can't be used as extra task labels
+var reservedLabels = []string{"task_id", "task_name", "mp_id", "mp_name", "mp_ip", "mp_gps"}
+
+// TaskConfig contains per-task overrides from the config file.
+// Nil fields mean the global value is used.
+type TaskConfig struct {
+	ID                       int            `yaml:"id"`
+	EngMPNames               *bool          `yaml:"eng_mp_names"`
+	ApiUpdateDelay           *time.Duration `yaml:"api_update_delay"`
+	ApiDataTimeStep          *time.Duration `yaml:"api_data_time_step"`
+	MaxAllowedStalenessSteps *int           `yaml:"max_allowed_staleness_steps"`
+	// Labels are extra static labels of the task (team, env, service, etc.)
+	Labels map[string]string `yaml:"labels"`
+}
+
+// file is a parsed config file.
+// Global options are named as ENV without prefix in lower case, e.g. 'refresh_interval: 5m'.
+type file struct {
+	options map[string]string
+	tasks   map[int]*TaskConfig
+}
+
+// loadFile reads the YAML (or JSON) config file.
+func loadFile(path string) (*file, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	var tasksSection struct {
+		Tasks []*TaskConfig `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(content, &tasksSection); err != nil {
+		return nil, fmt.Errorf("failed to parse tasks section of config file: %w", err)
+	}
+
+	f := &file{
+		options: make(map[string]string, len(raw)),
+		tasks:   make(map[int]*TaskConfig, len(tasksSection.Tasks)),
+	}
+
+	for key, value := range raw {
+		if key == "tasks" {
+			continue
+		}
+		f.options[key] = optionString(value)
+	}
+
+	for _, task := range tasksSection.Tasks {
+		if err := task.validate(); err != nil {
+			return nil, fmt.Errorf("invalid config file task %d: %w", task.ID, err)
+		}
+		if _, exists := f.tasks[task.ID]; exists {
+			return nil, fmt.Errorf("task %d is defined in config file more than once", task.ID)
+		}
+		f.tasks[task.ID] = task
+	}
+
+	return f, nil
+}
+
+// apply sets flags from the config file options unless they were set by execution keys or ENV.
+func (f *file) apply(fs *flag.FlagSet) error {
+	setByKeys := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) {
+		setByKeys[fl.Name] = true
+	})
+
+	keys := make([]string, 0, len(f.options))
+	for key := range f.options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flagName := strings.ReplaceAll(key, "_", "-")
+		if flagName == "config" || fs.Lookup(flagName) == nil {
+			return fmt.Errorf("unknown option '%s'", key)
+		}
+		if setByKeys[flagName] || os.Getenv(strings.ToUpper(key)) != "" {
+			continue
+		}
+		if err := fs.Set(flagName, f.options[key]); err != nil {
+			return fmt.Errorf("invalid value of '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// validate checks per-task overrides.
+func (t *TaskConfig) validate() error {
+	if t.ID <= 0 {
+		return fmt.Errorf("task ID must be positive")
+	}
+	if t.ApiDataTimeStep != nil && *t.ApiDataTimeStep <= 0 {
+		return fmt.Errorf("api_data_time_step must be positive")
+	}
+	for name := range t.Labels {
+		if !labelNameRe.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("'%s' is not a valid label name", name)
+		}
+		for _, reserved := range reservedLabels {
+			if name == reserved {
+				return fmt.Errorf("label '%s' is reserved", name)
+			}
+		}
+	}
+	return nil
+}
+
+// optionString converts a config file value to a flag value, lists become comma-separated.
+func optionString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,25 @@
+package config
+
+import "sync/atomic"
+
+// Holder keeps the current configuration, which may be replaced on reload.
+type Holder struct {
+	cfg atomic.Pointer[Config]
+}
+
+// NewHolder creates a holder of the configuration.
+func NewHolder(cfg *Config) *Holder {
+	h := &Holder{}
+	h.cfg.Store(cfg)
+	return h
+}
+
+// Get returns the current configuration, it must not be modified.
+func (h *Holder) Get() *Config {
+	return h.cfg.Load()
+}
+
+// Set replaces the current configuration.
+func (h *Holder) Set(cfg *Config) {
+	h.cfg.Store(cfg)
+}
@@ -0,0 +1,67 @@
+// Package discovery selects Ping-Admin account tasks to be exported.
+package discovery
+
+import (
+	"slices"
+	"sort"
+
+	"apatit/internal/client"
+	"apatit/internal/config"
+)
+
+// SelectTasks returns sorted IDs of tasks to export:
+// configured task IDs plus, if discovery is enabled, all account tasks matching discovery rules.
+func SelectTasks(allTasks []*client.TaskInfo, cfg *config.Config) []int {
+	selected := make(map[int]struct{}, len(cfg.TaskIDs))
+	for _, taskID := range cfg.TaskIDs {
+		selected[taskID] = struct{}{}
+	}
+
+	if cfg.Discovery {
+		for _, task := range allTasks {
+			if Match(task, cfg) {
+				selected[task.ID] = struct{}{}
+			}
+		}
+	}
+
+	taskIDs := make([]int, 0, len(selected))
+	for taskID := range selected {
+		taskIDs = append(taskIDs, taskID)
+	}
+	sort.Ints(taskIDs)
+	return taskIDs
+}
+
+// Match checks if the task matches discovery rules.
+func Match(task *client.TaskInfo, cfg *config.Config) bool {
+	if cfg.DiscoveryEnabledOnly && task.EnabledStatus != 1 {
+		return false
+	}
+	if len(cfg.DiscoveryIncludeIDs) > 0 && !inRanges(task.ID, cfg.DiscoveryIncludeIDs) {
+		return false
+	}
+	if inRanges(task.ID, cfg.DiscoveryExcludeIDs) {
+		return false
+	}
+	if cfg.DiscoveryNameRegex != nil && !cfg.DiscoveryNameRegex.MatchString(task.ServiceName) {
+		return false
+	}
+	if cfg.DiscoveryExcludeRegex != nil && cfg.DiscoveryExcludeRegex.MatchString(task.ServiceName) {
+		return false
+	}
+	if len(cfg.DiscoveryTypes) > 0 && !slices.Contains(cfg.DiscoveryTypes, task.Type) {
+		return false
+	}
+	return true
+}
+
+// inRanges checks if the ID is within any of the ranges.
+func inRanges(id int, ranges []config.IDRange) bool {
+	for _, r := range ranges {
+		if r.Contains(id) {
+			return true
+		}
+	}
+	return false
+}
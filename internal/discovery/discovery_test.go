@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"apatit/internal/client"
+	"apatit/internal/config"
+)
+
+func TestMatch(t *testing.T) {
+	site := &client.TaskInfo{ID: 150, ServiceName: "prod-site", Type: "http", EnabledStatus: 1}
+	disabled := &client.TaskInfo{ID: 151, ServiceName: "prod-old", Type: "http", EnabledStatus: 0}
+
+	tests := []struct {
+		name string
+		task *client.TaskInfo
+		cfg  *config.Config
+		want bool
+	}{
+		{name: "empty rules", task: site, cfg: &config.Config{}, want: true},
+		{name: "empty rules, disabled task", task: disabled, cfg: &config.Config{}, want: true},
+		{name: "enabled only", task: disabled, cfg: &config.Config{DiscoveryEnabledOnly: true}, want: false},
+		{name: "included ID", task: site, cfg: &config.Config{DiscoveryIncludeIDs: []config.IDRange{{From: 100, To: 200}}}, want: true},
+		{name: "not included ID", task: site, cfg: &config.Config{DiscoveryIncludeIDs: []config.IDRange{{From: 1, To: 99}, {From: 300, To: 300}}}, want: false},
+		{
+			name: "exclude ID over include ID",
+			task: site,
+			cfg:  &config.Config{DiscoveryIncludeIDs: []config.IDRange{{From: 100, To: 200}}, DiscoveryExcludeIDs: []config.IDRange{{From: 150, To: 150}}},
+			want: false,
+		},
+		{name: "name regex", task: site, cfg: &config.Config{DiscoveryNameRegex: regexp.MustCompile(`^prod-`)}, want: true},
+		{name: "name regex mismatch", task: site, cfg: &config.Config{DiscoveryNameRegex: regexp.MustCompile(`^stage-`)}, want: false},
+		{
+			name: "exclude name regex over name regex",
+			task: site,
+			cfg:  &config.Config{DiscoveryNameRegex: regexp.MustCompile(`^prod-`), DiscoveryExcludeRegex: regexp.MustCompile(`site$`)},
+			want: false,
+		},
+		{
+			name: "name regex doesn't override not included ID",
+			task: site,
+			cfg:  &config.Config{DiscoveryIncludeIDs: []config.IDRange{{From: 1, To: 99}}, DiscoveryNameRegex: regexp.MustCompile(`^prod-`)},
+			want: false,
+		},
+		{
+			name: "included ID doesn't override name regex mismatch",
+			task: site,
+			cfg:  &config.Config{DiscoveryIncludeIDs: []config.IDRange{{From: 150, To: 150}}, DiscoveryNameRegex: regexp.MustCompile(`^stage-`)},
+			want: false,
+		},
+		{name: "type", task: site, cfg: &config.Config{DiscoveryTypes: []string{"ping", "http"}}, want: true},
+		{name: "type mismatch", task: site, cfg: &config.Config{DiscoveryTypes: []string{"ping"}}, want: false},
+		{
+			name: "type doesn't override excluded ID",
+			task: site,
+			cfg:  &config.Config{DiscoveryTypes: []string{"http"}, DiscoveryExcludeIDs: []config.IDRange{{From: 100, To: 200}}},
+			want: false,
+		},
+		{
+			name: "all rules match",
+			task: site,
+			cfg: &config.Config{
+				DiscoveryEnabledOnly:  true,
+				DiscoveryIncludeIDs:   []config.IDRange{{From: 100, To: 200}},
+				DiscoveryExcludeIDs:   []config.IDRange{{From: 151, To: 199}},
+				DiscoveryNameRegex:    regexp.MustCompile(`^prod-`),
+				DiscoveryExcludeRegex: regexp.MustCompile(`old`),
+				DiscoveryTypes:        []string{"http"},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.task, tt.cfg); got != tt.want {
+			t.Errorf("%s: Match(%d) = %v, want %v", tt.name, tt.task.ID, got, tt.want)
+		}
+	}
+}
+
+func TestSelectTasks(t *testing.T) {
+	tasks := []*client.TaskInfo{
+		{ID: 3, ServiceName: "prod-api", EnabledStatus: 1},
+		{ID: 1, ServiceName: "prod-site", EnabledStatus: 1},
+		{ID: 2, ServiceName: "stage-site", EnabledStatus: 1},
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		want []int
+	}{
+		{name: "no tasks", cfg: &config.Config{}, want: []int{}},
+		{name: "configured tasks only", cfg: &config.Config{TaskIDs: []int{5, 2}}, want: []int{2, 5}},
+		{name: "discovery with empty rules", cfg: &config.Config{Discovery: true}, want: []int{1, 2, 3}},
+		{
+			name: "configured tasks are exported regardless of discovery rules",
+			cfg:  &config.Config{TaskIDs: []int{2}, Discovery: true, DiscoveryNameRegex: regexp.MustCompile(`^prod-`)},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "configured tasks are not duplicated",
+			cfg:  &config.Config{TaskIDs: []int{1}, Discovery: true, DiscoveryExcludeIDs: []config.IDRange{{From: 3, To: 3}}},
+			want: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		if got := SelectTasks(tasks, tt.cfg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector emits MP metrics of all running exporters at scrape time.
+// Metrics are taken from the snapshots made by the latest exporters refresh,
+// so series of absent MPs, removed tasks or renamed labels disappear with the next refresh.
+type Collector struct {
+	registry *Registry
+}
+
+// NewCollector creates a collector of MP metrics of the registry exporters.
+func NewCollector(registry *Registry) *Collector {
+	return &Collector{registry: registry}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- MPStatus
+	ch <- MPDataStatus
+	ch <- MPLastSuccessTimestampSeconds
+	ch <- MPLastSuccessDeltaSeconds
+	ch <- MPDataStalenessSteps
+	ch <- MPUpstreamAvailable
+	for _, m := range Measurements {
+		ch <- m.Desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, e := range c.registry.Exporters() {
+		for _, m := range e.Snapshot() {
+			ch <- m
+		}
+	}
+}
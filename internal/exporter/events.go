@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"apatit/internal/client"
+)
+
+const (
+	// maxEventDescriptions is the max number of distinct event descriptions per task,
+	// the descriptions seen after it is reached are counted as otherEventDescription
+	maxEventDescriptions = 20
+	// maxEventDescriptionLength is the max length of an event description in runes, longer ones are truncated
+	maxEventDescriptionLength = 64
+	otherEventDescription     = "other"
+)
+
+// eventKey identifies a task_stat log entry within a response.
+type eventKey struct {
+	Data   string
+	MPID   string
+	Status int64
+}
+
+// transitionKey identifies the latest MP transition to a status.
+type transitionKey struct {
+	MPID   string
+	Status int64
+}
+
+// processTaskEvents counts new task_stat log entries by description and updates the latest MP transitions timestamps.
+// An entry is new if it is later than the last seen entry of the same MP and status,
+// so entries returned again after a shorter response are not counted twice.
+// Entries without a timestamp can't be deduplicated and are skipped.
+// The first response only seeds the state, because its entries may have been counted before restart.
+func (e *Exporter) processTaskEvents(logs []*client.TaskLog) {
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+
+	taskID := strconv.Itoa(e.taskInfo.ID)
+	current := make(map[eventKey]struct{}, len(logs))
+	latest := make(map[transitionKey]time.Time)
+
+	for _, entry := range logs {
+		if entry.Timestamp.IsZero() {
+			continue
+		}
+		key := eventKey{Data: entry.Data, MPID: entry.MPID, Status: entry.Status}
+		if _, duplicate := current[key]; duplicate {
+			continue
+		}
+		current[key] = struct{}{}
+
+		tKey := transitionKey{MPID: entry.MPID, Status: entry.Status}
+		counter := TaskEventsTotal.WithLabelValues(
+			taskID,
+			e.taskInfo.ServiceName,
+			entry.MPID,
+			strconv.FormatInt(entry.Status, 10),
+			e.eventDescription(entry.Description),
+		)
+		if last, ok := e.lastTransitions[tKey]; e.eventsSeeded && (!ok || entry.Timestamp.After(last)) {
+			counter.Inc()
+		} else {
+			// create the series without counting, so the first real increment is visible to rate()
+			counter.Add(0)
+		}
+
+		if entry.Timestamp.After(latest[tKey]) {
+			latest[tKey] = entry.Timestamp
+		}
+	}
+
+	for tKey, timestamp := range latest {
+		if last, ok := e.lastTransitions[tKey]; ok && !timestamp.After(last) {
+			continue
+		}
+		e.lastTransitions[tKey] = timestamp
+		TaskLastTransitionTimestampSeconds.With(prometheus.Labels{
+			LabelTaskID:   taskID,
+			LabelTaskName: e.taskInfo.ServiceName,
+			LabelMPID:     tKey.MPID,
+			LabelStatus:   strconv.FormatInt(tKey.Status, 10),
+		}).Set(float64(timestamp.Unix()))
+	}
+
+	e.eventsSeeded = true
+}
+
+// eventDescription returns the description label value of an event.
+// The free-text description is normalised (whitespace collapsed, truncated to maxEventDescriptionLength),
+// and only the first maxEventDescriptions distinct descriptions of the task are kept,
+// so the number of series is bounded.
+func (e *Exporter) eventDescription(description string) string {
+	description = strings.Join(strings.Fields(description), " ")
+	if utf8.RuneCountInString(description) > maxEventDescriptionLength {
+		description = strings.TrimSpace(string([]rune(description)[:maxEventDescriptionLength]))
+	}
+
+	if _, ok := e.eventDescriptions[description]; ok {
+		return description
+	}
+	if len(e.eventDescriptions) >= maxEventDescriptions {
+		return otherEventDescription
+	}
+	e.eventDescriptions[description] = struct{}{}
+	return description
+}
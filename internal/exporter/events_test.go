@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"apatit/internal/client"
+)
+
+func TestProcessTaskEvents(t *testing.T) {
+	const taskID = 90002
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	event := func(age time.Duration, mpID string, status int64, description string) *client.TaskLog {
+		ts := base.Add(-age)
+		return &client.TaskLog{Data: ts.Format(time.DateTime), Timestamp: ts, MPID: mpID, Status: status, Description: description}
+	}
+
+	e, err := New(&Config{TaskID: taskID}, nil, []*client.TaskInfo{{ID: taskID, ServiceName: "events"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	responses := []struct {
+		name string
+		logs []*client.TaskLog
+		// want are the expected counter values by MP ID, status and description
+		want map[[3]string]float64
+	}{
+		{
+			name: "first response seeds the state",
+			logs: []*client.TaskLog{
+				event(10*time.Minute, "1", 0, "Connection timed out"),
+				event(20*time.Minute, "1", 1, "OK"),
+				event(30*time.Minute, "1", 0, "HTTP 502"),
+			},
+			want: map[[3]string]float64{{"1", "0", "Connection timed out"}: 0, {"1", "1", "OK"}: 0, {"1", "0", "HTTP 502"}: 0},
+		},
+		{
+			name: "new events are counted, repeated ones are not",
+			logs: []*client.TaskLog{
+				event(1*time.Minute, "1", 1, "OK"),
+				event(2*time.Minute, "1", 0, "HTTP 500"),
+				event(2*time.Minute, "1", 0, "HTTP 500"),
+				event(10*time.Minute, "1", 0, "Connection timed out"),
+			},
+			want: map[[3]string]float64{{"1", "0", "HTTP 500"}: 1, {"1", "0", "Connection timed out"}: 0, {"1", "1", "OK"}: 1},
+		},
+		{
+			name: "shorter response",
+			logs: []*client.TaskLog{
+				event(1*time.Minute, "1", 1, "OK"),
+			},
+			want: map[[3]string]float64{{"1", "0", "HTTP 500"}: 1, {"1", "0", "Connection timed out"}: 0, {"1", "1", "OK"}: 1},
+		},
+		{
+			name: "events returned again after a shorter response are not counted twice",
+			logs: []*client.TaskLog{
+				event(1*time.Minute, "1", 1, "OK"),
+				event(2*time.Minute, "1", 0, "HTTP 500"),
+				event(10*time.Minute, "1", 0, "Connection timed out"),
+			},
+			want: map[[3]string]float64{{"1", "0", "HTTP 500"}: 1, {"1", "0", "Connection timed out"}: 0, {"1", "1", "OK"}: 1},
+		},
+		{
+			name: "events of a new MP are counted",
+			logs: []*client.TaskLog{
+				event(0, "2", 0, "Host unreachable"),
+				event(1*time.Minute, "1", 1, "OK"),
+			},
+			want: map[[3]string]float64{{"1", "0", "HTTP 500"}: 1, {"1", "1", "OK"}: 1, {"2", "0", "Host unreachable"}: 1},
+		},
+	}
+
+	for _, resp := range responses {
+		e.processTaskEvents(resp.logs)
+		for key, want := range resp.want {
+			got := testutil.ToFloat64(TaskEventsTotal.WithLabelValues("90002", "events", key[0], key[1], key[2]))
+			if got != want {
+				t.Errorf("%s: events_total{mp_id=%q, status=%q, description=%q} = %v, want %v", resp.name, key[0], key[1], key[2], got, want)
+			}
+		}
+	}
+
+	if got, want := testutil.ToFloat64(TaskLastTransitionTimestampSeconds.WithLabelValues("90002", "events", "2", "0")), float64(base.Unix()); got != want {
+		t.Errorf("last_transition_timestamp_seconds = %v, want %v", got, want)
+	}
+}
+
+func TestEventDescription(t *testing.T) {
+	e, err := New(&Config{TaskID: 90006}, nil, []*client.TaskInfo{{ID: 90006, ServiceName: "descriptions"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	long := strings.Repeat("a", maxEventDescriptionLength+10)
+	tests := []struct {
+		name        string
+		description string
+		want        string
+	}{
+		{name: "as is", description: "HTTP 502", want: "HTTP 502"},
+		{name: "whitespace is collapsed", description: "  HTTP\t502\n", want: "HTTP 502"},
+		{name: "empty", description: "", want: ""},
+		{name: "long is truncated", description: long, want: long[:maxEventDescriptionLength]},
+		{name: "cyrillic is truncated by runes", description: strings.Repeat("ж", maxEventDescriptionLength+1), want: strings.Repeat("ж", maxEventDescriptionLength)},
+	}
+	for _, tt := range tests {
+		if got := e.eventDescription(tt.description); got != tt.want {
+			t.Errorf("%s: eventDescription(%q) = %q, want %q", tt.name, tt.description, got, tt.want)
+		}
+	}
+
+	for i := len(e.eventDescriptions); i < maxEventDescriptions; i++ {
+		e.eventDescription(fmt.Sprintf("error %d", i))
+	}
+	if got := e.eventDescription("one more error"); got != otherEventDescription {
+		t.Errorf("expected a description over the limit to be %q, got %q", otherEventDescription, got)
+	}
+	if got := e.eventDescription("HTTP 502"); got != "HTTP 502" {
+		t.Errorf("expected a known description to be kept over the limit, got %q", got)
+	}
+}
@@ -1,10 +1,14 @@
 package exporter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,26 +20,50 @@ import (
 
 // Exporter collects metrics for a single task.
 type Exporter struct {
-	Config    *Config
+	config    atomic.Pointer[Config]
 	apiClient *client.Client
 	log       *logrus.Entry
 
-	taskInfo         *client.TaskInfo
-	monitoringPoints []*client.MonitoringPointInfo
+	taskInfo *client.TaskInfo
+
+	// MP metrics of the latest refresh, emitted by Collector
+	snapshotMu sync.RWMutex
+	snapshot   []prometheus.Metric
+	// MP samples which are newer than the ones of the previous refresh, see NewSamples
+	newSamples      []*Sample
+	lastSampleTimes map[string]int64
+	// MP outages of the latest successful refresh, see NewOutages
+	newOutages []*Outage
+	// MP data of the latest successful refresh, saved to the state
+	entries []*client.MonitoringPointEntry
+	// restored is true if the snapshot was restored from the state and wasn't refreshed yet
+	restored atomic.Bool
+	// closed is true once the exporter is removed, see Close and withSeries
+	seriesMu sync.RWMutex
+	closed   bool
+
+	// task_stat events state, see processTaskEvents
+	eventsMu          sync.Mutex
+	eventsSeeded      bool
+	lastTransitions   map[transitionKey]time.Time
+	eventDescriptions map[string]struct{}
 }
 
 // Config contains the configuration for a specific Exporter instance.
 type Config struct {
-	TaskID          int
-	EngMPNames      bool
-	ApiUpdateDelay  time.Duration
-	ApiDataTimeStep time.Duration
+	TaskID                   int
+	EngMPNames               bool
+	ApiUpdateDelay           time.Duration
+	ApiDataTimeStep          time.Duration
+	MaxAllowedStalenessSteps int
+	// Labels are extra static labels of the task, exported with apatit_task_labels metric
+	Labels map[string]string
 }
 
 // New creates a new Exporter instance.
-// Metadata (tasks, monitoring_points) is passed to avoid repeated API requests.
-// allTasks map[string]*client.TaskRaw
-func New(conf *Config, apiClient *client.Client, allTasks []*client.TaskInfo, mps []*client.MonitoringPointInfo) (*Exporter, error) {
+// Tasks metadata is passed to avoid repeated API requests,
+// monitoring points info is provided on every metrics refresh.
+func New(conf *Config, apiClient *client.Client, allTasks []*client.TaskInfo) (*Exporter, error) {
 
 	var taskInfo *client.TaskInfo
 	for _, task := range allTasks {
@@ -56,54 +84,117 @@ func New(conf *Config, apiClient *client.Client, allTasks []*client.TaskInfo, mp
 
 	log.Debug("Exporter instance created")
 
-	return &Exporter{
-		Config:           conf,
-		apiClient:        apiClient,
-		log:              log,
-		taskInfo:         taskInfo,
-		monitoringPoints: mps,
-	}, nil
+	e := &Exporter{
+		apiClient:         apiClient,
+		log:               log,
+		taskInfo:          taskInfo,
+		lastTransitions:   make(map[transitionKey]time.Time),
+		eventDescriptions: make(map[string]struct{}),
+		lastSampleTimes:   make(map[string]int64),
+	}
+	e.config.Store(conf)
+	return e, nil
 }
 
-func (e *Exporter) UpdateAllTasksInfo() ([]*client.TaskInfo, error) {
-	e.log.Info("Updating all tasks info...")
+// Config returns the current exporter configuration, it must not be modified.
+func (e *Exporter) Config() *Config {
+	return e.config.Load()
+}
 
-	allTasks, err := e.apiClient.GetAllTasks()
-	if err != nil {
-		EErrorsTotal.WithLabelValues(
-			"api_client", "get_all_tasks",
-			strconv.Itoa(e.taskInfo.ID),
-			e.taskInfo.ServiceName).Inc()
-		return nil, fmt.Errorf("error getting all tasks info: %w", err)
+// TaskName returns the name of the exported task.
+func (e *Exporter) TaskName() string {
+	return e.taskInfo.ServiceName
+}
+
+// Restored returns true if the MP metrics were restored from the state and weren't refreshed yet.
+func (e *Exporter) Restored() bool {
+	return e.restored.Load()
+}
+
+// Reconfigure replaces the exporter configuration, the task ID must stay the same.
+// It is safe to call while metrics or stats are being refreshed.
+func (e *Exporter) Reconfigure(conf *Config) error {
+	if conf.TaskID != e.taskInfo.ID {
+		return fmt.Errorf("task ID can't be changed from %d to %d", e.taskInfo.ID, conf.TaskID)
 	}
+	e.config.Store(conf)
+	e.log.Debug("Exporter reconfigured")
+	return nil
+}
+
+// Close is called once the exporter is removed: the task series are deleted
+// and refreshes still in flight don't recreate them.
+func (e *Exporter) Close() {
+	e.seriesMu.Lock()
+	defer e.seriesMu.Unlock()
+	e.closed = true
+	DeleteTaskSeries(e.taskInfo.ID)
+}
 
-	return allTasks, nil
+// withSeries runs the update of the task series unless the exporter is closed.
+// Updates hold the read lock, so Close can't delete the series in the middle of an update.
+func (e *Exporter) withSeries(update func()) {
+	e.seriesMu.RLock()
+	defer e.seriesMu.RUnlock()
+	if !e.closed {
+		update()
+	}
+}
+
+// UpdateTaskMetrics updates task metrics from the task info of the 'tasks' API request.
+func (e *Exporter) UpdateTaskMetrics(task *client.TaskInfo) {
+	e.withSeries(func() { e.updateTaskMetrics(task) })
+}
+
+func (e *Exporter) updateTaskMetrics(task *client.TaskInfo) {
+	labels := prometheus.Labels{
+		LabelTaskID:   strconv.Itoa(e.taskInfo.ID),
+		LabelTaskName: e.taskInfo.ServiceName,
+	}
+
+	TaskUp.With(labels).Set(boolToFloat(task.TaskStatus == 1))
+	TaskEnabled.With(labels).Set(boolToFloat(task.EnabledStatus == 1))
+	TaskBlacklisted.With(labels).Set(boolToFloat(task.BlackListStatus != 0))
+	TaskVirusDetected.With(labels).Set(boolToFloat(task.VirusStatus != 0))
+	TaskCheckPeriodSeconds.With(labels).Set((time.Duration(task.Period) * time.Minute).Seconds())
+
+	if total := task.UptimeW + task.UptimeNw; total > 0 {
+		TaskUptimeRatio.With(labels).Set(float64(task.UptimeW) / float64(total))
+	} else {
+		TaskUptimeRatio.Delete(labels)
+	}
+
+	if !task.LastStatusChange.IsZero() {
+		TaskLastStatusChangeTimestampSeconds.With(labels).Set(float64(task.LastStatusChange.Unix()))
+	} else {
+		TaskLastStatusChangeTimestampSeconds.Delete(labels)
+	}
 }
 
 // UpdateTaskStats get task_stat data from the API and converts it to JSON.
-func (e *Exporter) UpdateTaskStats() (*client.TaskStatEntry, error) {
+func (e *Exporter) UpdateTaskStats(ctx context.Context) (*client.TaskStatEntry, error) {
 
 	e.log.Info("Updating task stats...")
 
 	// Get and process task stats
-	taskStatResults, err := e.apiClient.GetTaskStat(e.Config.TaskID)
+	taskStatResults, err := e.apiClient.GetTaskStat(ctx, e.Config().TaskID)
 	if err != nil {
-		EErrorsTotal.WithLabelValues(
-			"api_client", "get_task_stat",
-			strconv.Itoa(e.taskInfo.ID),
-			e.taskInfo.ServiceName).Inc()
+		e.countError("api_client", client.ErrorType(err))
 		return nil, fmt.Errorf("failed to get task stat: %w", err)
 	}
 
 	e.processTaskStatResults(taskStatResults)
+	e.withSeries(func() { e.processTaskEvents(taskStatResults.TaskLogs) })
 	ELoopsTotal.WithLabelValues("stats").Inc()
 
 	return taskStatResults, nil
 }
 
-// RefreshMetrics requests new data from the API, updates Prometheus metrics
-// and returns a list of labels for the processed series.
-func (e *Exporter) RefreshMetrics() ([]prometheus.Labels, error) {
+// RefreshMetrics requests new data from the API and replaces the snapshot of MP metrics.
+// Series absent in the new data disappear from the snapshot, so they don't need to be deleted.
+// Monitoring points info (mps) is shared by all exporters within a metrics cycle.
+// All API requests are aborted once ctx is done.
+func (e *Exporter) RefreshMetrics(ctx context.Context, mps []*client.MonitoringPointInfo) error {
 	startTime := time.Now()
 	e.log.Info("Refreshing metrics...")
 
@@ -111,68 +202,252 @@ func (e *Exporter) RefreshMetrics() ([]prometheus.Labels, error) {
 	defer func() {
 		duration := time.Since(startTime).Seconds()
 		ELoopsTotal.WithLabelValues("metrics").Inc()
-		ERefreshDurationSeconds.WithLabelValues(strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).Set(duration)
+		e.withSeries(func() {
+			ERefreshDurationSeconds.WithLabelValues(strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).Set(duration)
+			ETaskMaxAllowedStalenessSteps.WithLabelValues(strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).
+				Set(float64(e.Config().MaxAllowedStalenessSteps))
+		})
 		e.log.WithField("duration_s", duration).Info("Refresh finished")
 	}()
 
 	// Get and process task graph stats (metrics)
-	taskStatGraphResults, err := e.apiClient.GetTaskGraphStat(e.Config.TaskID)
+	taskStatGraphResults, err := e.apiClient.GetTaskGraphStat(ctx, e.Config().TaskID, 1)
 	if err != nil {
-		EErrorsTotal.WithLabelValues(
-			"api_client",
-			"get_task_graph_stat",
-			strconv.Itoa(e.taskInfo.ID),
-			e.taskInfo.ServiceName).Inc()
-		return nil, fmt.Errorf("failed to get task graph stat: %w", err)
+		e.countError("api_client", client.ErrorType(err))
+		// the previous MP data is kept and becomes stale until the next successful refresh,
+		// an interrupted refresh keeps the previous snapshot as is
+		// and the unavailable API is reported explicitly
+		switch {
+		case errors.Is(err, client.ErrCircuitOpen):
+			e.MarkUpstreamUnavailable(mps)
+		case ctx.Err() == nil:
+			e.MarkStale(mps, startTime)
+		}
+		return fmt.Errorf("failed to get task graph stat: %w", err)
 	}
 
 	if len(taskStatGraphResults) == 0 {
-		EErrorsTotal.WithLabelValues(
-			"api_client",
-			"get_task_graph_stat",
-			strconv.Itoa(e.taskInfo.ID),
-			e.taskInfo.ServiceName).Inc()
+		e.countError("api_client", "no_data")
 		e.log.Error("No MP data from API.")
 	} else {
 		e.log.Debugf("Received %d data items from API", len(taskStatGraphResults))
 	}
 
-	mpsInfo, err := e.apiClient.GetMPs()
-	if err != nil {
-		EErrorsTotal.WithLabelValues(
-			"api_client", "get_mps",
-			strconv.Itoa(e.taskInfo.ID),
-			e.taskInfo.ServiceName).Inc()
-		return nil, fmt.Errorf("failed to get monitoring points info: %w", err)
+	metrics, samples, outages := e.processEntries(taskStatGraphResults, mps, startTime)
+	e.setSnapshot(metrics, samples)
+	e.setOutages(outages)
+	e.setEntries(taskStatGraphResults)
+
+	// restored metrics are replaced with the actual ones
+	if e.restored.CompareAndSwap(true, false) {
+		e.withSeries(func() {
+			EStateRestored.WithLabelValues(strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).Set(0)
+		})
 	}
+	return nil
+}
 
-	processedLabels := make([]prometheus.Labels, 0)
+// RestoreMetrics rebuilds the snapshot of MP metrics from entries saved by a previous run, see Entries.
+// The restored data points are not returned by NewSamples, as they were handled by the previous run.
+// The task is flagged as restored until the next successful refresh.
+func (e *Exporter) RestoreMetrics(entries []*client.MonitoringPointEntry, mps []*client.MonitoringPointInfo) {
+	metrics, samples, _ := e.processEntries(entries, mps, time.Now())
+	e.setSnapshot(metrics, samples)
+	e.setEntries(entries)
+	e.NewSamples()
+
+	e.restored.Store(true)
+	e.withSeries(func() {
+		EStateRestored.WithLabelValues(strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).Set(1)
+	})
+	e.log.WithField("entries", len(entries)).Info("Metrics restored from state")
+}
 
-	for _, item := range taskStatGraphResults {
-		for _, mp := range mpsInfo {
-			if mp.ID == item.ID {
-				item.Status = int(mp.Status)
-				break
-			}
+// MarkUpstreamUnavailable replaces the snapshot of MP metrics while Ping-Admin API is unavailable:
+// MPs of the latest successful refresh are reported with zero upstream availability only.
+// Their status and measurements are unknown, so they are dropped rather than reported as MPs being down.
+// Monitoring points info (mps) is used for the MP labels.
+func (e *Exporter) MarkUpstreamUnavailable(mps []*client.MonitoringPointInfo) {
+	entries := e.Entries()
+	metrics := make([]prometheus.Metric, 0, len(entries))
+	for _, item := range entries {
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(MPUpstreamAvailable, prometheus.GaugeValue, 0, mpLabelValues(e.buildLabels(item, mps))...))
+	}
+	e.setSnapshot(metrics, nil)
+	e.log.WithField("mps", len(entries)).Warn("Ping-Admin API is unavailable, MP metrics are marked")
+}
+
+// MarkStale rebuilds the snapshot of MP metrics from the data of the latest successful refresh,
+// so the series are kept after a failed refresh and their staleness is computed at refresh time (startTime).
+// The measurements keep their original timestamps and the data points are not returned by NewSamples again.
+// Monitoring points info (mps) is used for the MP statuses and labels.
+func (e *Exporter) MarkStale(mps []*client.MonitoringPointInfo, startTime time.Time) {
+	entries := e.Entries()
+	metrics, _, _ := e.processEntries(entries, mps, startTime)
+	e.setSnapshot(metrics, nil)
+	e.log.WithField("mps", len(entries)).Warn("MP data refresh failed, the previous data is kept as stale")
+}
+
+// Entries returns MP data of the latest successful refresh, it must not be modified.
+func (e *Exporter) Entries() []*client.MonitoringPointEntry {
+	e.snapshotMu.RLock()
+	defer e.snapshotMu.RUnlock()
+	return e.entries
+}
+
+// setEntries replaces MP data of the latest successful refresh.
+func (e *Exporter) setEntries(entries []*client.MonitoringPointEntry) {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	e.entries = entries
+}
+
+// processEntries builds MP metrics and samples from the task graph stat data,
+// MPs without a measurement are returned as outages at startTime.
+// The entries may be already published (see Entries), so they are not modified.
+func (e *Exporter) processEntries(entries []*client.MonitoringPointEntry, mps []*client.MonitoringPointInfo, startTime time.Time) ([]prometheus.Metric, []*Sample, []*Outage) {
+	metrics := make([]prometheus.Metric, 0)
+	samples := make([]*Sample, 0)
+	outages := make([]*Outage, 0)
+
+	for _, item := range entries {
+		itemMetrics, sample := e.processTaskStatGraphResultItem(item, e.mpStatus(item, mps), mps, startTime)
+		metrics = append(metrics, itemMetrics...)
+		metrics = append(metrics, e.upstreamAvailable(item, mps))
+		if sample != nil {
+			samples = append(samples, sample)
+		} else {
+			outages = append(outages, &Outage{Labels: e.buildLabels(item, mps), Timestamp: startTime.Unix()})
+		}
+	}
+
+	return metrics, samples, outages
+}
+
+// mpStatus returns the availability status of the MP from the monitoring points info (mps),
+// or the status of the entry if the MP is unknown. An incorrect status is ZERO.
+func (e *Exporter) mpStatus(item *client.MonitoringPointEntry, mps []*client.MonitoringPointInfo) int {
+	status := item.Status
+	for _, mp := range mps {
+		if mp.ID == item.ID {
+			status = int(mp.Status)
+			break
 		}
-		// check monitoring point status and set it as ZERO if it was incorrect
-		if item.Status > 1 || item.Status < 0 {
-			e.log.WithFields(
-				logrus.Fields{
-					"mp_id": item.ID, 
-					"mp_name": item.Name,
-					"status": item.Status,
-				}).Errorf("incorrect monitoring points status: %d", item.Status)
-			item.Status = 0
+	}
+	if status > 1 || status < 0 {
+		e.log.WithFields(
+			logrus.Fields{
+				"mp_id":   item.ID,
+				"mp_name": item.Name,
+				"status":  status,
+			}).Errorf("incorrect monitoring points status: %d", status)
+		return 0
+	}
+	return status
+}
+
+// upstreamAvailable returns MPUpstreamAvailable metric of the MP received from the API.
+func (e *Exporter) upstreamAvailable(item *client.MonitoringPointEntry, mps []*client.MonitoringPointInfo) prometheus.Metric {
+	return prometheus.MustNewConstMetric(MPUpstreamAvailable, prometheus.GaugeValue, 1, mpLabelValues(e.buildLabels(item, mps))...)
+}
+
+// Snapshot returns MP metrics of the latest refresh, it must not be modified.
+func (e *Exporter) Snapshot() []prometheus.Metric {
+	e.snapshotMu.RLock()
+	defer e.snapshotMu.RUnlock()
+	return e.snapshot
+}
+
+// NewSamples returns MP samples of the latest refresh which are newer than the ones of the previous refresh,
+// so every Ping-Admin data point is returned once.
+func (e *Exporter) NewSamples() []*Sample {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	samples := e.newSamples
+	e.newSamples = nil
+	return samples
+}
+
+// NewOutages returns MP outages of the latest successful refresh, so every refresh outage is returned once.
+func (e *Exporter) NewOutages() []*Outage {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	outages := e.newOutages
+	e.newOutages = nil
+	return outages
+}
+
+// setOutages replaces MP outages of the latest refresh.
+func (e *Exporter) setOutages(outages []*Outage) {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	e.newOutages = outages
+}
+
+// setSnapshot replaces MP metrics and samples of the latest refresh.
+func (e *Exporter) setSnapshot(metrics []prometheus.Metric, samples []*Sample) {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	e.snapshot = metrics
+
+	e.newSamples = make([]*Sample, 0, len(samples))
+	for _, sample := range samples {
+		mpID := sample.Labels[LabelMPID]
+		if sample.Result.Timestamp <= e.lastSampleTimes[mpID] {
+			continue
 		}
+		e.lastSampleTimes[mpID] = sample.Result.Timestamp
+		e.newSamples = append(e.newSamples, sample)
+	}
+}
 
-		labels := e.processTaskStatGraphResultItem(item, startTime)
-		if labels != nil {
-			processedLabels = append(processedLabels, labels...)
+// MarkSamplesSent marks MP samples delivered outside of refreshes (e.g. backfilled history) as sent,
+// so NewSamples doesn't return them or older data points of the same MPs again.
+func (e *Exporter) MarkSamplesSent(samples []*Sample) {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	for _, sample := range samples {
+		mpID := sample.Labels[LabelMPID]
+		e.lastSampleTimes[mpID] = max(e.lastSampleTimes[mpID], sample.Result.Timestamp)
+	}
+}
+
+// FetchHistory requests the latest MP data points within the window (at least one point for each MP)
+// and returns them as samples with their original timestamps.
+// Monitoring points info (mps) is used for the MP labels.
+func (e *Exporter) FetchHistory(ctx context.Context, window time.Duration, mps []*client.MonitoringPointInfo) ([]*Sample, error) {
+	conf := e.Config()
+	limit := int(math.Ceil(window.Seconds() / conf.ApiDataTimeStep.Seconds()))
+	if limit < 1 {
+		limit = 1
+	}
+
+	e.log.WithField("limit", limit).Info("Fetching MP data history...")
+	taskStatGraphResults, err := e.apiClient.GetTaskGraphStat(ctx, conf.TaskID, limit)
+	if err != nil {
+		e.countError("api_client", client.ErrorType(err))
+		return nil, fmt.Errorf("failed to get task graph stat history: %w", err)
+	}
+
+	samples := make([]*Sample, 0)
+	for _, item := range taskStatGraphResults {
+		labels := e.buildLabels(item, mps)
+		for _, res := range item.Result {
+			if res.Timestamp <= 0 {
+				continue
+			}
+			samples = append(samples, &Sample{Labels: labels, Result: res})
 		}
 	}
+	return samples, nil
+}
 
-	return processedLabels, nil
+// countError counts the task error in EErrorsTotal.
+func (e *Exporter) countError(module, errorType string) {
+	e.withSeries(func() {
+		EErrorsTotal.WithLabelValues(module, errorType, strconv.Itoa(e.taskInfo.ID), e.taskInfo.ServiceName).Inc()
+	})
 }
 
 func (e *Exporter) processTaskStatResults(taskStatResults *client.TaskStatEntry) {
@@ -187,55 +462,64 @@ func (e *Exporter) processTaskStatResults(taskStatResults *client.TaskStatEntry)
 	}
 }
 
-// processTaskStatGraphResultItem processes one record (monitoring point) and updates metrics.
-func (e *Exporter) processTaskStatGraphResultItem(item *client.MonitoringPointEntry, refreshStartTime time.Time) []prometheus.Labels {
+// processTaskStatGraphResultItem processes one record (monitoring point) and returns its metrics
+// and the measured sample, which is nil if the MP has no actual data.
+func (e *Exporter) processTaskStatGraphResultItem(item *client.MonitoringPointEntry, mpStatus int, mps []*client.MonitoringPointInfo, refreshStartTime time.Time) ([]prometheus.Metric, *Sample) {
 	if len(item.Result) == 0 {
 		locationName := item.Name
-		if e.Config.EngMPNames {
+		if e.Config().EngMPNames {
 			locationName = translator.GetEngLocation(item.Name)
 		}
-		MPDataStatus.WithLabelValues(
-			strconv.Itoa(e.taskInfo.ID), 
-			e.taskInfo.ServiceName,
-			item.ID,
-			locationName,
-			).Set(0)
 
 		e.log.WithFields(
 			logrus.Fields{
-				"mp_id": item.ID, 
+				"mp_id":   item.ID,
 				"mp_name": item.Name}).Warn("No results found for MP")
-		return nil
+		return []prometheus.Metric{
+			prometheus.MustNewConstMetric(MPDataStatus, prometheus.GaugeValue, 0,
+				strconv.Itoa(e.taskInfo.ID),
+				e.taskInfo.ServiceName,
+				item.ID,
+				locationName,
+			),
+		}, nil
 	}
 
-	// Usually there is only one element in the MPResult in the response, but just in case we go through them all.
-	processedLabels := make([]prometheus.Labels, 0, len(item.Result))
-	for _, res := range item.Result {
-		labels := e.buildLabels(item)
-		e.updateMetrics(res, labels, item.Status, refreshStartTime)
-		processedLabels = append(processedLabels, labels)
+	// Usually there is only one element in the MPResult in the response, but just in case we take the latest one,
+	// as a series can't be emitted twice.
+	res := item.Result[0]
+	for _, r := range item.Result[1:] {
+		if r.Timestamp > res.Timestamp {
+			res = r
+		}
 	}
 
-	MPDataStatus.WithLabelValues(
-		strconv.Itoa(e.taskInfo.ID), 
-		e.taskInfo.ServiceName,
-		item.ID,
-		processedLabels[0][LabelMPName],
-		).Set(1)
-
-	return processedLabels
+	labels := e.buildLabels(item, mps)
+	metrics, measured := e.buildMetrics(res, labels, mpStatus, refreshStartTime)
+	metrics = append(metrics, prometheus.MustNewConstMetric(MPDataStatus, prometheus.GaugeValue, 1,
+		labels[LabelTaskID],
+		labels[LabelTaskName],
+		labels[LabelMPID],
+		labels[LabelMPName],
+	))
+
+	if !measured {
+		return metrics, nil
+	}
+	return metrics, &Sample{Labels: labels, Result: res}
 }
 
 // buildLabels creates a set of Prometheus labels for a monitoring point.
-func (e *Exporter) buildLabels(item *client.MonitoringPointEntry) prometheus.Labels {
+// IP and GPS labels are taken from the monitoring points info (mps).
+func (e *Exporter) buildLabels(item *client.MonitoringPointEntry, mps []*client.MonitoringPointInfo) prometheus.Labels {
 	locationName := item.Name
-	if e.Config.EngMPNames {
+	if e.Config().EngMPNames {
 		locationName = translator.GetEngLocation(item.Name)
 	}
 
 	ipAddress := "unknown"
 	gpsCoordinates := "unknown"
-	for _, mp := range e.monitoringPoints {
+	for _, mp := range mps {
 		if mp.ID == item.ID {
 			ipAddress = mp.IP
 			gpsCoordinates = mp.GPS
@@ -253,49 +537,70 @@ func (e *Exporter) buildLabels(item *client.MonitoringPointEntry) prometheus.Lab
 	}
 }
 
-// updateMetrics sets values for all metrics based on data.
-func (e *Exporter) updateMetrics(res *client.MonitoringPointConnectionResult, labels prometheus.Labels, mpStatus int, refreshStartTime time.Time) {
+// buildMetrics creates MP metrics based on data.
+// Measurement metrics get the original data timestamp, the others are computed at refresh time.
+// measured is false if measurement metrics were skipped, because the MP is unavailable or its data is too old.
+func (e *Exporter) buildMetrics(res *client.MonitoringPointConnectionResult, labels prometheus.Labels, mpStatus int, refreshStartTime time.Time) (metrics []prometheus.Metric, measured bool) {
 	ts := time.Unix(res.Timestamp, 0)
 	lastCheckDelta := refreshStartTime.Sub(ts)
 
-	// remove time related metrics and set MPStatus as ZERO if monitoring point was unavailable according to 'mp' API
+	labelValues := mpLabelValues(labels)
+
+	// skip time related metrics and set MPStatus as ZERO if monitoring point was unavailable according to 'mp' API
 	if mpStatus == 0 {
 		e.log.WithFields(logrus.Fields{"mp_id": labels["mp_id"], "mp_name": labels["mp_name"]}).
 			Warn("Monitoring point is unavailable")
-		DeleteSeries(labels)
-		MPStatus.With(labels).Set(0)
-		return
+		return []prometheus.Metric{prometheus.MustNewConstMetric(MPStatus, prometheus.GaugeValue, 0, labelValues...)}, false
 	}
 
-	// remove time related metrics and set MPStatus as ZERO if MP data is older than 24 hours
+	// skip time related metrics and set MPStatus as ZERO if MP data is older than 24 hours
 	if lastCheckDelta >= 24*time.Hour {
 		e.log.WithFields(logrus.Fields{"mp_id": labels["mp_id"], "mp_name": labels["mp_name"]}).
 			Warn("Data for MP is older than 24 hours")
-		DeleteSeries(labels)
-		MPStatus.With(labels).Set(0)
-		return
+		return []prometheus.Metric{prometheus.MustNewConstMetric(MPStatus, prometheus.GaugeValue, 0, labelValues...)}, false
 	}
 
 	// Calculate the latency in "steps" (how many API intervals have passed since the data was received)
 	// This helps us understand how "old" the data is. 0 is the most recent.
 
-	delayInSteps := math.Floor(math.Abs(lastCheckDelta.Seconds()-e.Config.ApiUpdateDelay.Seconds()) / e.Config.ApiDataTimeStep.Seconds())
+	conf := e.Config()
+	delayInSteps := math.Floor(math.Abs(lastCheckDelta.Seconds()-conf.ApiUpdateDelay.Seconds()) / conf.ApiDataTimeStep.Seconds())
 
-	MPConnectSeconds.With(labels).Set(res.Connect)
-	MPDNSLookupSeconds.With(labels).Set(res.DNS)
-	MPServerProcessingSeconds.With(labels).Set(res.Server)
-	MPTotalDurationSeconds.With(labels).Set(res.Total)
-	MPSpeedBytesPerSecond.With(labels).Set(float64(res.Speed))
-	MPLastSuccessTimestampSeconds.With(labels).Set(float64(res.Timestamp))
-	MPLastSuccessDeltaSeconds.With(labels).Set(lastCheckDelta.Seconds())
-	MPDataStalenessSteps.With(labels).Set(delayInSteps)
-	MPStatus.With(labels).Set(1)
+	metrics = make([]prometheus.Metric, 0, len(Measurements)+4)
+	for _, m := range Measurements {
+		metrics = append(metrics, prometheus.NewMetricWithTimestamp(ts,
+			prometheus.MustNewConstMetric(m.Desc, prometheus.GaugeValue, m.Value(res), labelValues...)))
+	}
+	metrics = append(metrics,
+		prometheus.MustNewConstMetric(MPLastSuccessTimestampSeconds, prometheus.GaugeValue, float64(res.Timestamp), labelValues...),
+		prometheus.MustNewConstMetric(MPLastSuccessDeltaSeconds, prometheus.GaugeValue, lastCheckDelta.Seconds(), labelValues...),
+		prometheus.MustNewConstMetric(MPDataStalenessSteps, prometheus.GaugeValue, delayInSteps, labelValues...),
+		prometheus.MustNewConstMetric(MPStatus, prometheus.GaugeValue, 1, labelValues...),
+	)
 
 	e.log.WithFields(logrus.Fields{
 		"mp_id":   labels["mp_id"],
 		"mp_name": labels["mp_name"],
 		"delta":   lastCheckDelta,
 		"steps":   delayInSteps,
-	}).Debug("Metrics updated for MP")
+	}).Debug("Metrics built for MP")
 
+	return metrics, true
+}
+
+// mpLabelValues returns values of MP labels in mpLabels order.
+func mpLabelValues(labels prometheus.Labels) []string {
+	values := make([]string, 0, len(mpLabels))
+	for _, name := range mpLabels {
+		values = append(values, labels[name])
+	}
+	return values
+}
+
+// boolToFloat converts bool to a metric value.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
 }
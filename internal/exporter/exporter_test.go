@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"apatit/internal/client"
+	"apatit/internal/state"
+	"apatit/internal/testing/fakeapi"
+)
+
+// snapshotValues returns values of the snapshot metrics with the description, by MP ID.
+func snapshotValues(t *testing.T, e *Exporter, desc *prometheus.Desc) map[string]float64 {
+	t.Helper()
+	values := make(map[string]float64)
+	for _, m := range e.Snapshot() {
+		if m.Desc() != desc {
+			continue
+		}
+		var metric dto.Metric
+		if err := m.Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == LabelMPID {
+				values[label.GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// newTestExporter creates an exporter of the fake API task and returns it with the monitoring points info.
+func newTestExporter(t *testing.T, taskID int) (*fakeapi.Server, *Exporter, []*client.MonitoringPointInfo) {
+	t.Helper()
+	fake := fakeapi.New(&fakeapi.Scenario{
+		DataStep: fakeapi.Duration(3 * time.Minute),
+		MPs:      []*fakeapi.MP{{ID: "1", Name: "Moscow"}},
+		Tasks: []*fakeapi.Task{{
+			ID: taskID, Name: "stale", Enabled: true, Up: true, Period: 3,
+			Graph: fakeapi.Graph{Total: 0.2, Age: fakeapi.Duration(4 * time.Minute)},
+		}},
+	})
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	apiClient, err := client.New(&client.Config{Endpoint: srv.URL, RequestRetries: 1, MaxRequestsPerSecond: 100}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tasks, err := apiClient.GetAllTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mps, err := apiClient.GetMPs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(&Config{
+		TaskID:                   taskID,
+		ApiUpdateDelay:           4 * time.Minute,
+		ApiDataTimeStep:          3 * time.Minute,
+		MaxAllowedStalenessSteps: 3,
+	}, apiClient, tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	return fake, e, mps
+}
+
+// TestRefreshMetricsFailureKeepsStaleData checks that a failed refresh keeps the MP series of the previous one.
+func TestRefreshMetricsFailureKeepsStaleData(t *testing.T) {
+	ctx := context.Background()
+	fake, e, mps := newTestExporter(t, 90003)
+
+	if err := e.RefreshMetrics(ctx, mps); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if got := snapshotValues(t, e, MPStatus); got["1"] != 1 {
+		t.Fatalf("expected MP status 1 after refresh, got %v", got)
+	}
+	delta := snapshotValues(t, e, MPLastSuccessDeltaSeconds)["1"]
+
+	fake.SetErrorRate(1)
+	time.Sleep(10 * time.Millisecond)
+	if err := e.RefreshMetrics(ctx, mps); err == nil {
+		t.Fatal("expected refresh to fail")
+	}
+	if got := snapshotValues(t, e, MPStatus); got["1"] != 1 {
+		t.Errorf("expected MP series to be kept after a failed refresh, got %v", got)
+	}
+	if got := snapshotValues(t, e, MPLastSuccessDeltaSeconds)["1"]; got <= delta {
+		t.Errorf("expected last success delta to grow after a failed refresh, got %v then %v", delta, got)
+	}
+	if samples := e.NewSamples(); len(samples) != 0 {
+		t.Errorf("expected no new samples after a failed refresh, got %d", len(samples))
+	}
+}
+
+// TestMarkUpstreamUnavailable checks that MPs are not reported as down while the API is unavailable.
+func TestMarkUpstreamUnavailable(t *testing.T) {
+	_, e, mps := newTestExporter(t, 90004)
+	if err := e.RefreshMetrics(context.Background(), mps); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	e.MarkUpstreamUnavailable(mps)
+	if got := snapshotValues(t, e, MPUpstreamAvailable); len(got) != 1 || got["1"] != 0 {
+		t.Errorf("expected MP upstream availability 0, got %v", got)
+	}
+	for _, desc := range []*prometheus.Desc{MPStatus, Measurements[0].Desc} {
+		if got := snapshotValues(t, e, desc); len(got) != 0 {
+			t.Errorf("expected no %s series while the API is unavailable, got %v", desc, got)
+		}
+	}
+}
+
+// TestMarkStaleWhileSavingState checks that rebuilding the stale snapshot doesn't modify the published entries,
+// which are saved by the state store concurrently. It is meant to be run with -race.
+func TestMarkStaleWhileSavingState(t *testing.T) {
+	_, e, mps := newTestExporter(t, 90005)
+	if err := e.RefreshMetrics(context.Background(), mps); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	store, err := state.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			e.MarkStale(mps, time.Now())
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		err := store.Update(func(st *state.State) {
+			st.Entries = map[int][]*client.MonitoringPointEntry{e.Config().TaskID: e.Entries()}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
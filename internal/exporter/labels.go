@@ -13,4 +13,7 @@ const (
 	LabelMPName       = "mp_name"
 	LabelMPIP         = "mp_ip"
 	LabelMPGPS        = "mp_gps"
+	LabelStatus       = "status"
+	LabelDescription  = "description"
+	LabelResult       = "result"
 )
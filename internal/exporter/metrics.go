@@ -1,17 +1,29 @@
 package exporter
 
 import (
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
 
+	"apatit/internal/client"
 	"apatit/internal/version"
 )
 
 const (
 	namespace         = "apatit"
 	subsystemExporter = "exporter"
+	subsystemTask     = "task"
 	subsystemMP       = "mp"
 )
 
+// Task metrics labels
+var (
+	taskLabels = []string{
+		LabelTaskID,
+		LabelTaskName,
+	}
+)
+
 // Monitoring Point metrics labels
 var (
 	mpLabels = []string{
@@ -26,6 +38,7 @@ var (
 
 // Metrics starts with "A" are related to "APATIT" itself
 // Metrics starts with "E" are related to "Exporter"
+// Metrics starts with "Task" are related to "Task"
 // Metrics starts with "MP" are related to "Monitoring Point"
 var (
 	AServiceInfo = prometheus.NewGauge(
@@ -62,6 +75,17 @@ var (
 		},
 	)
 
+	ETaskMaxAllowedStalenessSteps = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: subsystemExporter,
+			Name:      "task_max_allowed_staleness_steps",
+			Help: "Configured staleness threshold in steps for a specific task " +
+				"(differs from `apatit_exporter_max_allowed_staleness_steps` if it is overridden for the task).",
+		},
+		[]string{LabelTaskID, LabelTaskName},
+	)
+
 	ERefreshDurationSeconds = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
@@ -92,104 +116,163 @@ var (
 		[]string{LabelErrorModule, LabelErrorType, LabelTaskID, LabelTaskName},
 	)
 
-	MPStatus = prometheus.NewGaugeVec(
+	EStateRestored = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "status",
-			Help:      "Status of the monitoring point (1 = up/processed, 0 = stale/down).",
+			Subsystem: subsystemExporter,
+			Name:      "state_restored",
+			Help:      "Whether the task metrics were restored from the saved state and weren't refreshed yet (1 = stale restored data).",
+		},
+		taskLabels,
+	)
+
+	ERemoteWriteBatchesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemExporter,
+			Name:      "remote_write_batches_total",
+			Help:      "Total number of remote write batches by result (sent, rejected, dropped).",
 		},
-		mpLabels,
+		[]string{LabelResult},
 	)
 
-	MPDataStatus = prometheus.NewGaugeVec(
+	ERemoteWriteQueueBatches = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "data_status",
-			Help:      "Status of the data for the monitoring point (1 = has data, 0 = no data).",
+			Subsystem: subsystemExporter,
+			Name:      "remote_write_queue_batches",
+			Help:      "Number of remote write batches waiting in the queue.",
 		},
-		[]string{LabelTaskID, LabelTaskName, LabelMPID, LabelMPName},
 	)
 
-	MPConnectSeconds = prometheus.NewGaugeVec(
+	TaskUp = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "connect_seconds",
-			Help:      "Time spent establishing a connection.",
+			Subsystem: subsystemTask,
+			Name:      "up",
+			Help:      "Status of the task service according to Ping-Admin (1 = works, 0 = doesn't work).",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPDNSLookupSeconds = prometheus.NewGaugeVec(
+	TaskEnabled = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "dns_lookup_seconds",
-			Help:      "Time spent on DNS lookup.",
+			Subsystem: subsystemTask,
+			Name:      "enabled",
+			Help:      "Whether the task is enabled in Ping-Admin console (1 = enabled, 0 = disabled).",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPServerProcessingSeconds = prometheus.NewGaugeVec(
+	TaskBlacklisted = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "server_processing_seconds",
-			Help:      "Time the server spent processing the request.",
+			Subsystem: subsystemTask,
+			Name:      "blacklisted",
+			Help:      "Whether the task address was found in blacklists (RKN, Spamhaus, etc.) (1 = found, 0 = not found).",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPTotalDurationSeconds = prometheus.NewGaugeVec(
+	TaskVirusDetected = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "total_duration_seconds",
-			Help:      "Total request time.",
+			Subsystem: subsystemTask,
+			Name:      "virus_detected",
+			Help:      "Whether a virus was detected on the task service (1 = detected, 0 = not detected).",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPSpeedBytesPerSecond = prometheus.NewGaugeVec(
+	TaskUptimeRatio = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "speed_bytes_per_second",
-			Help:      "Download speed in bytes per second.",
+			Subsystem: subsystemTask,
+			Name:      "uptime_ratio",
+			Help:      "Share of time the task service was available according to Ping-Admin (0..1).",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPLastSuccessTimestampSeconds = prometheus.NewGaugeVec(
+	TaskCheckPeriodSeconds = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "last_success_timestamp_seconds",
-			Help:      "Timestamp of the last successful data point from the API.",
+			Subsystem: subsystemTask,
+			Name:      "check_period_seconds",
+			Help:      "Configured checking period of the task.",
 		},
-		mpLabels,
+		taskLabels,
 	)
 
-	MPLastSuccessDeltaSeconds = prometheus.NewGaugeVec(
+	TaskLastStatusChangeTimestampSeconds = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "last_success_delta_seconds",
-			Help:      "Time since the last successful data point was received.",
+			Subsystem: subsystemTask,
+			Name:      "last_status_change_timestamp_seconds",
+			Help:      "Timestamp of the last task service status change.",
+		},
+		taskLabels,
+	)
+
+	TaskEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystemTask,
+			Name:      "events_total",
+			Help:      "Total number of task events (status changes) reported by monitoring points in task_stat logs.",
 		},
-		mpLabels,
+		[]string{LabelTaskID, LabelTaskName, LabelMPID, LabelStatus, LabelDescription},
 	)
 
-	MPDataStalenessSteps = prometheus.NewGaugeVec(
+	TaskLastTransitionTimestampSeconds = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Subsystem: subsystemMP,
-			Name:      "data_staleness_steps",
-			Help:      "How many API data steps have been missed for this MP. 0 means the data is fresh.",
+			Subsystem: subsystemTask,
+			Name:      "last_transition_timestamp_seconds",
+			Help:      "Timestamp of the latest task transition to the status reported by the monitoring point.",
 		},
-		mpLabels,
+		[]string{LabelTaskID, LabelTaskName, LabelMPID, LabelStatus},
+	)
+)
+
+// Monitoring Point metrics are emitted by Collector from exporters snapshots,
+// so only their descriptions are defined here. See also Measurements.
+var (
+	MPStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "status"),
+		"Status of the monitoring point (1 = up/processed, 0 = stale/down).",
+		mpLabels, nil,
+	)
+
+	MPDataStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "data_status"),
+		"Status of the data for the monitoring point (1 = has data, 0 = no data).",
+		[]string{LabelTaskID, LabelTaskName, LabelMPID, LabelMPName}, nil,
+	)
+
+	MPLastSuccessTimestampSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "last_success_timestamp_seconds"),
+		"Timestamp of the last successful data point from the API.",
+		mpLabels, nil,
+	)
+
+	MPLastSuccessDeltaSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "last_success_delta_seconds"),
+		"Time since the last successful data point was received.",
+		mpLabels, nil,
+	)
+
+	MPDataStalenessSteps = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "data_staleness_steps"),
+		"How many API data steps have been missed for this MP. 0 means the data is fresh.",
+		mpLabels, nil,
+	)
+
+	MPUpstreamAvailable = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystemMP, "upstream_available"),
+		"Whether Ping-Admin API was available at the latest refresh (0 = API circuit breaker is open, MP data is unknown).",
+		mpLabels, nil,
 	)
 )
 
@@ -198,32 +281,92 @@ func RegisterMetrics() {
 		AServiceInfo,
 		ERefreshIntervalSeconds,
 		EMaxAllowedStalenessSteps,
+		ETaskMaxAllowedStalenessSteps,
 		ERefreshDurationSeconds,
 		ELoopsTotal,
 		EErrorsTotal,
-		MPStatus,
-		MPDataStatus,
-		MPConnectSeconds,
-		MPDNSLookupSeconds,
-		MPServerProcessingSeconds,
-		MPTotalDurationSeconds,
-		MPSpeedBytesPerSecond,
-		MPLastSuccessTimestampSeconds,
-		MPLastSuccessDeltaSeconds,
-		MPDataStalenessSteps,
+		EStateRestored,
+		ERemoteWriteBatchesTotal,
+		ERemoteWriteQueueBatches,
+		TaskUp,
+		TaskEnabled,
+		TaskBlacklisted,
+		TaskVirusDetected,
+		TaskUptimeRatio,
+		TaskCheckPeriodSeconds,
+		TaskLastStatusChangeTimestampSeconds,
+		TaskEventsTotal,
+		TaskLastTransitionTimestampSeconds,
 	)
 }
 
-// DeleteSeries deletes "Monitoring Point" related metrics
-func DeleteSeries(labels prometheus.Labels) {
-	MPStatus.Delete(labels)
-	MPDataStatus.Delete(labels)
-	MPConnectSeconds.Delete(labels)
-	MPDNSLookupSeconds.Delete(labels)
-	MPServerProcessingSeconds.Delete(labels)
-	MPTotalDurationSeconds.Delete(labels)
-	MPSpeedBytesPerSecond.Delete(labels)
-	MPLastSuccessTimestampSeconds.Delete(labels)
-	MPLastSuccessDeltaSeconds.Delete(labels)
-	MPDataStalenessSteps.Delete(labels)
+// DeleteTaskSeries deletes all series related to the task.
+// MP series are not deleted, as they are emitted from the exporter snapshot.
+func DeleteTaskSeries(taskID int) {
+	labels := prometheus.Labels{LabelTaskID: strconv.Itoa(taskID)}
+
+	ERefreshDurationSeconds.DeletePartialMatch(labels)
+	ETaskMaxAllowedStalenessSteps.DeletePartialMatch(labels)
+	EStateRestored.DeletePartialMatch(labels)
+	EErrorsTotal.DeletePartialMatch(labels)
+	TaskUp.DeletePartialMatch(labels)
+	TaskEnabled.DeletePartialMatch(labels)
+	TaskBlacklisted.DeletePartialMatch(labels)
+	TaskVirusDetected.DeletePartialMatch(labels)
+	TaskUptimeRatio.DeletePartialMatch(labels)
+	TaskCheckPeriodSeconds.DeletePartialMatch(labels)
+	TaskLastStatusChangeTimestampSeconds.DeletePartialMatch(labels)
+	TaskEventsTotal.DeletePartialMatch(labels)
+	TaskLastTransitionTimestampSeconds.DeletePartialMatch(labels)
+}
+
+// Sample is a single MP measurement with the MP labels.
+// Its timestamp is the original Ping-Admin data timestamp.
+type Sample struct {
+	Labels prometheus.Labels
+	Result *client.MonitoringPointConnectionResult
+}
+
+// Outage is an MP without a measurement at refresh time, because it is unavailable or its data is too old.
+type Outage struct {
+	Labels prometheus.Labels
+	// Timestamp is the refresh time in seconds
+	Timestamp int64
+}
+
+// Measurement describes an MP measurement metric.
+type Measurement struct {
+	// Name is a full metric name
+	Name string
+	// Field is a short metric name without namespace and subsystem, e.g. connect_seconds
+	Field string
+	Help  string
+	Desc  *prometheus.Desc
+	Value func(res *client.MonitoringPointConnectionResult) float64
+}
+
+// newMeasurement creates an MP measurement metric with MP labels.
+func newMeasurement(name, help string, value func(res *client.MonitoringPointConnectionResult) float64) Measurement {
+	fqName := prometheus.BuildFQName(namespace, subsystemMP, name)
+	return Measurement{
+		Name:  fqName,
+		Field: name,
+		Help:  help,
+		Desc:  prometheus.NewDesc(fqName, help, mpLabels, nil),
+		Value: value,
+	}
+}
+
+// Measurements are MP measurement metrics, which have the original data timestamp.
+var Measurements = []Measurement{
+	newMeasurement("connect_seconds", "Time spent establishing a connection.",
+		func(res *client.MonitoringPointConnectionResult) float64 { return res.Connect }),
+	newMeasurement("dns_lookup_seconds", "Time spent on DNS lookup.",
+		func(res *client.MonitoringPointConnectionResult) float64 { return res.DNS }),
+	newMeasurement("server_processing_seconds", "Time the server spent processing the request.",
+		func(res *client.MonitoringPointConnectionResult) float64 { return res.Server }),
+	newMeasurement("total_duration_seconds", "Total request time.",
+		func(res *client.MonitoringPointConnectionResult) float64 { return res.Total }),
+	newMeasurement("speed_bytes_per_second", "Download speed in bytes per second.",
+		func(res *client.MonitoringPointConnectionResult) float64 { return float64(res.Speed) }),
 }
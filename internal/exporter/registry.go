@@ -0,0 +1,194 @@
+package exporter
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/client"
+)
+
+// Registry is a thread-safe set of running exporters, one per task.
+type Registry struct {
+	mu        sync.RWMutex
+	apiClient *client.Client
+	configFor func(taskID int) *Config
+	exporters map[int]*Exporter
+	log       *logrus.Entry
+}
+
+// taskLabelsHelp is a help of the task extra labels info metric
+const taskLabelsHelp = "Extra static labels of the task from the config file, always 1. " +
+	"Join it with other metrics on task_id to get the labels."
+
+// NewRegistry creates an empty exporters registry.
+// configFor builds the configuration for a task exporter.
+func NewRegistry(apiClient *client.Client, configFor func(taskID int) *Config) *Registry {
+	return &Registry{
+		apiClient: apiClient,
+		configFor: configFor,
+		exporters: make(map[int]*Exporter),
+		log:       logrus.WithField("component", "registry"),
+	}
+}
+
+// Exporters returns running exporters ordered by task ID.
+func (r *Registry) Exporters() []*Exporter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exporters := make([]*Exporter, 0, len(r.exporters))
+	for _, e := range r.exporters {
+		exporters = append(exporters, e)
+	}
+	sort.Slice(exporters, func(i, j int) bool {
+		return exporters[i].Config().TaskID < exporters[j].Config().TaskID
+	})
+	return exporters
+}
+
+// Get returns the running exporter of the task.
+func (r *Registry) Get(taskID int) (*Exporter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.exporters[taskID]
+	return e, ok
+}
+
+// SetConfigFor replaces the function building exporters configuration.
+// Running exporters are reconfigured on the next Sync or Reconfigure.
+func (r *Registry) SetConfigFor(configFor func(taskID int) *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configFor = configFor
+}
+
+// Reconfigure applies the current configuration to running exporters without changing the set of tasks.
+func (r *Registry) Reconfigure() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.exporters {
+		r.reconfigure(e)
+	}
+}
+
+// reconfigure applies the current configuration to the exporter if it has changed, r.mu must be locked.
+func (r *Registry) reconfigure(e *Exporter) {
+	conf := r.configFor(e.taskInfo.ID)
+	if reflect.DeepEqual(conf, e.Config()) {
+		return
+	}
+	if err := e.Reconfigure(conf); err != nil {
+		r.log.Errorf("Unable to reconfigure exporter for TaskID %d: %v", e.taskInfo.ID, err)
+	}
+}
+
+// Len returns the number of running exporters.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.exporters)
+}
+
+// Sync makes the set of running exporters match taskIDs.
+// Exporters are created for new tasks and closed (with all their series deleted) for absent ones,
+// refreshes of the closed exporters still in flight don't recreate the series.
+// Exporters of renamed tasks are recreated, so their series get the new task name.
+// Other running exporters are reconfigured in place, keeping their series.
+// allTasks is the account tasks metadata used to create exporters.
+func (r *Registry) Sync(taskIDs []int, allTasks []*client.TaskInfo) (added, removed []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tasksByID := make(map[int]*client.TaskInfo, len(allTasks))
+	for _, task := range allTasks {
+		tasksByID[task.ID] = task
+	}
+
+	wanted := make(map[int]struct{}, len(taskIDs))
+	for _, taskID := range taskIDs {
+		wanted[taskID] = struct{}{}
+	}
+
+	for taskID, e := range r.exporters {
+		_, isWanted := wanted[taskID]
+		task, exists := tasksByID[taskID]
+		if isWanted && exists && task.ServiceName == e.taskInfo.ServiceName {
+			continue
+		}
+		delete(r.exporters, taskID)
+		e.Close()
+		removed = append(removed, taskID)
+		r.log.WithField("task_id", taskID).Info("Exporter removed")
+	}
+
+	for _, taskID := range taskIDs {
+		if e, exists := r.exporters[taskID]; exists {
+			r.reconfigure(e)
+			continue
+		}
+
+		exp, err := New(r.configFor(taskID), r.apiClient, allTasks)
+		if err != nil {
+			r.log.Errorf("Unable to create exporter for TaskID %d: %v", taskID, err)
+			continue
+		}
+		r.exporters[taskID] = exp
+		added = append(added, taskID)
+		r.log.WithField("task_id", taskID).Info("Exporter added")
+	}
+
+	return added, removed
+}
+
+// Describe implements prometheus.Collector.
+// Nothing is described, because the label names of the task labels info metric depend on the configured labels.
+func (r *Registry) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+// It emits apatit_task_labels info metric for each exporter with extra task labels.
+// All series have the same label names, the union of the labels of all tasks:
+// labels which a task doesn't have are empty.
+func (r *Registry) Collect(ch chan<- prometheus.Metric) {
+	// the config may be replaced on reload, so the labels are taken once
+	type taskLabels struct {
+		exporter *Exporter
+		labels   map[string]string
+	}
+	tasks := make([]taskLabels, 0)
+	union := make(map[string]struct{})
+	for _, e := range r.Exporters() {
+		labels := e.Config().Labels
+		if len(labels) == 0 {
+			continue
+		}
+		tasks = append(tasks, taskLabels{exporter: e, labels: labels})
+		for name := range labels {
+			union[name] = struct{}{}
+		}
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(union)+2)
+	for name := range union {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append([]string{LabelTaskID, LabelTaskName}, names...)
+	desc := prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystemTask, "labels"), taskLabelsHelp, names, nil)
+
+	for _, task := range tasks {
+		values := make([]string, 0, len(names))
+		values = append(values, strconv.Itoa(task.exporter.taskInfo.ID), task.exporter.taskInfo.ServiceName)
+		for _, name := range names[2:] {
+			values = append(values, task.labels[name])
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+	}
+}
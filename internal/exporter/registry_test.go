@@ -0,0 +1,68 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"apatit/internal/client"
+)
+
+// TestSyncRemovedExporterDoesNotRecreateSeries checks that a refresh finishing after the exporter
+// was removed doesn't leave orphaned task series.
+func TestSyncRemovedExporterDoesNotRecreateSeries(t *testing.T) {
+	const taskID = 90001
+	tasks := []*client.TaskInfo{{ID: taskID, ServiceName: "removed", TaskStatus: 1, EnabledStatus: 1}}
+
+	registry := NewRegistry(nil, func(taskID int) *Config { return &Config{TaskID: taskID} })
+	registry.Sync([]int{taskID}, tasks)
+	e, ok := registry.Get(taskID)
+	if !ok {
+		t.Fatal("exporter was not created")
+	}
+	e.UpdateTaskMetrics(tasks[0])
+	e.countError("api_client", "upstream")
+	if n := testutil.CollectAndCount(TaskUp); n != 1 {
+		t.Fatalf("expected 1 task_up series, got %d", n)
+	}
+
+	if _, removed := registry.Sync(nil, tasks); len(removed) != 1 {
+		t.Fatalf("expected the exporter to be removed, got %v", removed)
+	}
+	// late writes of the refresh in flight
+	e.UpdateTaskMetrics(tasks[0])
+	e.countError("api_client", "upstream")
+
+	if n := testutil.CollectAndCount(TaskUp); n != 0 {
+		t.Errorf("expected no task_up series after removal, got %d", n)
+	}
+	if n := testutil.CollectAndCount(EErrorsTotal); n != 0 {
+		t.Errorf("expected no errors_total series after removal, got %d", n)
+	}
+}
+
+// TestTaskLabelsGather checks that tasks with different extra labels are gathered as one consistent metric family.
+func TestTaskLabelsGather(t *testing.T) {
+	tasks := []*client.TaskInfo{{ID: 90101, ServiceName: "site"}, {ID: 90102, ServiceName: "api"}, {ID: 90103, ServiceName: "plain"}}
+	labels := map[int]map[string]string{
+		90101: {"team": "web", "env": "prod"},
+		90102: {"team": "backend", "service": "api"},
+	}
+	registry := NewRegistry(nil, func(taskID int) *Config { return &Config{TaskID: taskID, Labels: labels[taskID]} })
+	registry.Sync([]int{90101, 90102, 90103}, tasks)
+	defer registry.Sync(nil, tasks)
+
+	promRegistry := prometheus.NewPedanticRegistry()
+	promRegistry.MustRegister(registry)
+	expected := `
+# HELP apatit_task_labels ` + taskLabelsHelp + `
+# TYPE apatit_task_labels gauge
+apatit_task_labels{env="",service="api",task_id="90102",task_name="api",team="backend"} 1
+apatit_task_labels{env="prod",service="",task_id="90101",task_name="site",team="web"} 1
+`
+	if err := testutil.GatherAndCompare(promRegistry, strings.NewReader(expected), "apatit_task_labels"); err != nil {
+		t.Error(err)
+	}
+}
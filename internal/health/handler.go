@@ -0,0 +1,93 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/config"
+	"apatit/internal/exporter"
+)
+
+// ExporterStatus is the status of a task exporter.
+type ExporterStatus struct {
+	TaskID   int    `json:"task_id"`
+	TaskName string `json:"task_name"`
+	// Restored is true if the task metrics were restored from the saved state and weren't refreshed yet
+	Restored bool      `json:"restored"`
+	Metrics  RunStatus `json:"metrics"`
+	Stats    RunStatus `json:"stats"`
+}
+
+// Status is a '/status' response.
+type Status struct {
+	StartedAt time.Time `json:"started_at"`
+	Ready     bool      `json:"ready"`
+	// NotReadyReason is empty if the exporter is ready
+	NotReadyReason string               `json:"not_ready_reason,omitempty"`
+	API            RunStatus            `json:"api"`
+	Schedulers     map[string]RunStatus `json:"schedulers"`
+	Exporters      []*ExporterStatus    `json:"exporters"`
+}
+
+// readyMaxAge is the maximum age of the last successful cycles of a ready exporter.
+func readyMaxAge(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.ReadinessMaxIntervals) * cfg.RefreshInterval
+}
+
+// LiveHandler handles '/healthz' requests, it answers OK while the process is alive.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("OK\n"))
+	})
+}
+
+// ReadyHandler handles '/readyz' requests, it answers OK if the API key is accepted
+// and metrics and stats cycles have succeeded within the configured number of refresh intervals, see Tracker.Ready.
+func ReadyHandler(tracker *Tracker, cfgs *config.Holder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := tracker.Ready(readyMaxAge(cfgs.Get())); err != nil {
+			http.Error(w, "Not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OK\n"))
+	})
+}
+
+// StatusHandler handles '/status' requests with the detailed state of schedulers and running exporters.
+func StatusHandler(tracker *Tracker, registry *exporter.Registry, cfgs *config.Holder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := &Status{
+			StartedAt: tracker.StartedAt(),
+			Ready:     true,
+			API:       tracker.API(),
+			Schedulers: map[string]RunStatus{
+				SchedulerMetrics: tracker.Cycle(SchedulerMetrics),
+				SchedulerStats:   tracker.Cycle(SchedulerStats),
+			},
+			Exporters: make([]*ExporterStatus, 0),
+		}
+		if err := tracker.Ready(readyMaxAge(cfgs.Get())); err != nil {
+			status.Ready = false
+			status.NotReadyReason = err.Error()
+		}
+
+		for _, e := range registry.Exporters() {
+			taskID := e.Config().TaskID
+			status.Exporters = append(status.Exporters, &ExporterStatus{
+				TaskID:   taskID,
+				TaskName: e.TaskName(),
+				Restored: e.Restored(),
+				Metrics:  tracker.Task(SchedulerMetrics, taskID),
+				Stats:    tracker.Task(SchedulerStats, taskID),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			logrus.Errorf("Failed to write response: %v", err)
+		}
+	})
+}
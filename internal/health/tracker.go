@@ -0,0 +1,188 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"apatit/internal/client"
+)
+
+// Scheduler names of the tracked cycles.
+const (
+	SchedulerMetrics = "metrics"
+	SchedulerStats   = "stats"
+)
+
+// RunStatus is the outcome history of repeated runs: of a scheduler cycle or a task refresh.
+type RunStatus struct {
+	LastRun             time.Time `json:"last_run,omitzero"`
+	LastSuccess         time.Time `json:"last_success,omitzero"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorTime       time.Time `json:"last_error_time,omitzero"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	NextRun             time.Time `json:"next_run,omitzero"`
+}
+
+// observe records the outcome of a run finished now.
+func (s *RunStatus) observe(err error) {
+	now := time.Now()
+	s.LastRun = now
+	if err != nil {
+		s.LastError = err.Error()
+		s.LastErrorTime = now
+		s.ConsecutiveFailures++
+		return
+	}
+	s.LastSuccess = now
+	s.ConsecutiveFailures = 0
+}
+
+// Tracker keeps the state of schedulers and task refreshes for health endpoints.
+type Tracker struct {
+	mu        sync.RWMutex
+	startedAt time.Time
+	cycles    map[string]*RunStatus
+	// tasks refreshes by task ID and scheduler name
+	tasks map[int]map[string]*RunStatus
+	// api is the status of account API requests (tasks or MPs info)
+	api RunStatus
+	// apiUnauthorized is true if the latest account API request was rejected as unauthorized
+	apiUnauthorized bool
+}
+
+// NewTracker creates a tracker with no runs.
+func NewTracker() *Tracker {
+	return &Tracker{
+		startedAt: time.Now(),
+		cycles:    make(map[string]*RunStatus),
+		tasks:     make(map[int]map[string]*RunStatus),
+	}
+}
+
+// CycleStarted records the start of a scheduler cycle and the time of the next one.
+func (t *Tracker) CycleStarted(scheduler string, next time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycle(scheduler).NextRun = next
+}
+
+// ObserveCycle records the outcome of a scheduler cycle, err is nil if the cycle succeeded.
+func (t *Tracker) ObserveCycle(scheduler string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycle(scheduler).observe(err)
+}
+
+// ObserveTask records the outcome of a task refresh by the scheduler.
+// The next run of the task is the next cycle of the scheduler.
+func (t *Tracker) ObserveTask(scheduler string, taskID int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	runs, ok := t.tasks[taskID]
+	if !ok {
+		runs = make(map[string]*RunStatus)
+		t.tasks[taskID] = runs
+	}
+	status, ok := runs[scheduler]
+	if !ok {
+		status = &RunStatus{}
+		runs[scheduler] = status
+	}
+	status.observe(err)
+	status.NextRun = t.cycle(scheduler).NextRun
+}
+
+// ObserveAPI records the outcome of an account API request (tasks or MPs info).
+// A successful one means the API key is valid, an unauthorized one means it was revoked.
+func (t *Tracker) ObserveAPI(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.api.observe(err)
+	t.apiUnauthorized = errors.Is(err, client.ErrUnauthorized)
+}
+
+// cycle returns the status of the scheduler cycles, t.mu must be locked.
+func (t *Tracker) cycle(scheduler string) *RunStatus {
+	status, ok := t.cycles[scheduler]
+	if !ok {
+		status = &RunStatus{}
+		t.cycles[scheduler] = status
+	}
+	return status
+}
+
+// Cycle returns a copy of the status of the scheduler cycles.
+func (t *Tracker) Cycle(scheduler string) RunStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if status, ok := t.cycles[scheduler]; ok {
+		return *status
+	}
+	return RunStatus{}
+}
+
+// Task returns a copy of the status of the task refreshes by the scheduler.
+func (t *Tracker) Task(scheduler string, taskID int) RunStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if status, ok := t.tasks[taskID][scheduler]; ok {
+		return *status
+	}
+	return RunStatus{}
+}
+
+// API returns a copy of the status of account API requests.
+func (t *Tracker) API() RunStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.api
+}
+
+// Ready returns nil if the API key is accepted and the first full cycles of both metrics and stats schedulers
+// have completed, with a successful cycle of each within maxAge, otherwise the reason of unreadiness.
+// A cycle is successful unless it failed as a whole, e.g. if all its task refreshes failed.
+func (t *Tracker) Ready(maxAge time.Duration) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.apiUnauthorized {
+		return fmt.Errorf("API key is rejected: %s", t.api.LastError)
+	}
+	if t.api.LastSuccess.IsZero() {
+		return fmt.Errorf("API key is not validated yet")
+	}
+	for _, scheduler := range []string{SchedulerMetrics, SchedulerStats} {
+		status, ok := t.cycles[scheduler]
+		if !ok || status.LastSuccess.IsZero() {
+			return fmt.Errorf("first %s cycle has not completed yet", scheduler)
+		}
+		if age := time.Since(status.LastSuccess); age > maxAge {
+			return fmt.Errorf("no successful %s cycle within %s", scheduler, maxAge)
+		}
+	}
+	return nil
+}
+
+// StartedAt returns the time the tracker was created at.
+func (t *Tracker) StartedAt() time.Time {
+	return t.startedAt
+}
+
+// Forget drops the status of the removed tasks, keeping the listed ones only.
+func (t *Tracker) Forget(keepTaskIDs []int) {
+	keep := make(map[int]struct{}, len(keepTaskIDs))
+	for _, id := range keepTaskIDs {
+		keep[id] = struct{}{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.tasks {
+		if _, ok := keep[id]; !ok {
+			delete(t.tasks, id)
+		}
+	}
+}
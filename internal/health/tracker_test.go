@@ -0,0 +1,138 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"apatit/internal/client"
+)
+
+func TestTrackerReady(t *testing.T) {
+	errRefresh := errors.New("refresh failed")
+	errUnauthorized := &client.APIError{Class: client.ErrUnauthorized, StatusCode: 401}
+
+	tests := []struct {
+		name    string
+		observe func(tr *Tracker)
+		ready   bool
+	}{
+		{
+			name:    "API key is not validated",
+			observe: func(tr *Tracker) {},
+		},
+		{
+			name: "no cycles yet",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+			},
+		},
+		{
+			name: "first cycles are running, a task of each scheduler is refreshed",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveTask(SchedulerMetrics, 1, nil)
+				tr.ObserveTask(SchedulerStats, 1, nil)
+			},
+		},
+		{
+			name: "only the first metrics cycle has completed",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveTask(SchedulerStats, 1, nil)
+			},
+		},
+		{
+			name: "first cycles have completed",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveTask(SchedulerMetrics, 1, nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveTask(SchedulerStats, 1, nil)
+				tr.ObserveCycle(SchedulerStats, nil)
+			},
+			ready: true,
+		},
+		{
+			name: "some tasks fail",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveTask(SchedulerMetrics, 1, errRefresh)
+				tr.ObserveTask(SchedulerMetrics, 2, nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveTask(SchedulerStats, 1, nil)
+				tr.ObserveTask(SchedulerStats, 2, errRefresh)
+				tr.ObserveCycle(SchedulerStats, nil)
+			},
+			ready: true,
+		},
+		{
+			name: "first stats cycle failed",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveTask(SchedulerStats, 1, errRefresh)
+				tr.ObserveCycle(SchedulerStats, fmt.Errorf("all 1 task refreshes failed"))
+			},
+		},
+		{
+			name: "API key is rejected after the first cycles",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveCycle(SchedulerStats, nil)
+				tr.ObserveAPI(errUnauthorized)
+			},
+		},
+		{
+			name: "API is unavailable after the first cycles",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveCycle(SchedulerStats, nil)
+				tr.ObserveAPI(&client.APIError{Class: client.ErrUpstream, StatusCode: 502})
+			},
+			ready: true,
+		},
+		{
+			name: "API key is accepted again",
+			observe: func(tr *Tracker) {
+				tr.ObserveAPI(errUnauthorized)
+				tr.ObserveAPI(nil)
+				tr.ObserveCycle(SchedulerMetrics, nil)
+				tr.ObserveCycle(SchedulerStats, nil)
+			},
+			ready: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker()
+			tt.observe(tr)
+			err := tr.Ready(time.Minute)
+			if ready := err == nil; ready != tt.ready {
+				t.Errorf("got ready %v (%v), want %v", ready, err, tt.ready)
+			}
+		})
+	}
+}
+
+func TestTrackerReadyMaxAge(t *testing.T) {
+	tr := NewTracker()
+	tr.ObserveAPI(nil)
+	tr.ObserveCycle(SchedulerMetrics, nil)
+	tr.ObserveCycle(SchedulerStats, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	tr.ObserveTask(SchedulerMetrics, 1, nil)
+	tr.ObserveTask(SchedulerStats, 1, nil)
+	if err := tr.Ready(10 * time.Millisecond); err == nil {
+		t.Error("expected the tracker to be unready without recent successful cycles")
+	}
+	if err := tr.Ready(time.Minute); err != nil {
+		t.Errorf("expected the tracker to be ready, got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/cache"
+)
+
+const (
+	// defaultQueryRange is used if 'from' parameter is absent
+	defaultQueryRange = time.Hour
+	// maxBuckets limits the number of points of a series in the response
+	maxBuckets = 10000
+)
+
+// Aggregate is an aggregation of values within a bucket.
+type Aggregate struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+	P95 float64 `json:"p95"`
+}
+
+// Bucket is an aggregated series point.
+type Bucket struct {
+	// Timestamp is the bucket start for downsampled points, or the data timestamp for raw ones
+	Timestamp int64                `json:"timestamp"`
+	Count     int                  `json:"count"`
+	Values    map[string]Aggregate `json:"values"`
+}
+
+// Series is a history of a single MP.
+type Series struct {
+	MPID   string    `json:"mp_id"`
+	Points []*Bucket `json:"points"`
+}
+
+// Response is a history query response.
+type Response struct {
+	TaskID int       `json:"task_id"`
+	From   int64     `json:"from"`
+	To     int64     `json:"to"`
+	Step   int64     `json:"step"`
+	Series []*Series `json:"series"`
+}
+
+// Handler handles '/api/v1/history?task_id=&mp_id=&from=&to=&step=' requests.
+// from and to are unix timestamps or RFC 3339 times, the last hour is returned by default.
+// step is a duration (e.g. 5m) or seconds, points are downsampled into step buckets with min, avg, max and p95
+// of every value. Raw points are returned if step is absent. All task MPs are returned if mp_id is absent.
+func Handler(store *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		taskID, err := strconv.Atoi(query.Get("task_id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid or missing 'task_id' parameter")
+			return
+		}
+
+		to := time.Now()
+		if v := query.Get("to"); v != "" {
+			if to, err = parseTime(v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid 'to' parameter: "+err.Error())
+				return
+			}
+		}
+		from := to.Add(-defaultQueryRange)
+		if v := query.Get("from"); v != "" {
+			if from, err = parseTime(v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid 'from' parameter: "+err.Error())
+				return
+			}
+		}
+		if from.After(to) {
+			writeError(w, http.StatusBadRequest, "'from' must not be after 'to'")
+			return
+		}
+
+		var step time.Duration
+		if v := query.Get("step"); v != "" {
+			if step, err = parseStep(v); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid 'step' parameter: "+err.Error())
+				return
+			}
+			if to.Sub(from)/step > maxBuckets {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("too many points, 'step' must be at least %s", to.Sub(from)/maxBuckets))
+				return
+			}
+		}
+
+		pointsByMP, err := store.Query(taskID, query.Get("mp_id"), from, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		resp := &Response{
+			TaskID: taskID,
+			From:   from.Unix(),
+			To:     to.Unix(),
+			Step:   int64(step.Seconds()),
+			Series: make([]*Series, 0, len(pointsByMP)),
+		}
+		for mpID, points := range pointsByMP {
+			resp.Series = append(resp.Series, &Series{
+				MPID:   mpID,
+				Points: downsample(points, store.Fields(), from.Unix(), resp.Step),
+			})
+		}
+		sort.Slice(resp.Series, func(i, j int) bool { return resp.Series[i].MPID < resp.Series[j].MPID })
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(resp); err != nil {
+			logrus.Errorf("Failed to encode response: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to encode response")
+			return
+		}
+		cache.ServeJSON(w, r, buf.Bytes(), time.Time{})
+	})
+}
+
+// downsample aggregates points ordered by timestamp into step buckets starting at from.
+// Every point is a separate bucket if step is 0. Empty buckets are skipped, as well as values
+// unknown within a bucket, e.g. measurements of a bucket of MP outages only.
+func downsample(points []point, fields []string, from, step int64) []*Bucket {
+	buckets := make([]*Bucket, 0)
+	for start := 0; start < len(points); {
+		bucketStart := points[start].timestamp
+		if step > 0 {
+			bucketStart = from + (points[start].timestamp-from)/step*step
+		}
+
+		end := start + 1
+		for step > 0 && end < len(points) && points[end].timestamp < bucketStart+step {
+			end++
+		}
+
+		bucket := &Bucket{
+			Timestamp: bucketStart,
+			Count:     end - start,
+			Values:    make(map[string]Aggregate, len(fields)),
+		}
+		for i, field := range fields {
+			values := make([]float64, 0, end-start)
+			for _, p := range points[start:end] {
+				// measurements of MP outages are unknown
+				if !math.IsNaN(p.values[i]) {
+					values = append(values, p.values[i])
+				}
+			}
+			if len(values) > 0 {
+				bucket.Values[field] = aggregate(values)
+			}
+		}
+		buckets = append(buckets, bucket)
+		start = end
+	}
+	return buckets
+}
+
+// aggregate calculates min, avg, max and nearest-rank p95 of the values.
+func aggregate(values []float64) Aggregate {
+	sort.Float64s(values)
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+
+	return Aggregate{
+		Min: values[0],
+		Avg: sum / float64(len(values)),
+		Max: values[len(values)-1],
+		P95: values[max(rank, 0)],
+	}
+}
+
+// parseTime parses unix timestamp or RFC 3339 time.
+func parseTime(s string) (time.Time, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseStep parses duration or seconds, it must be positive.
+func parseStep(s string) (time.Duration, error) {
+	step, err := time.ParseDuration(s)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(s)
+		if convErr != nil {
+			return 0, err
+		}
+		step = time.Duration(seconds) * time.Second
+	}
+	if step < time.Second {
+		return 0, fmt.Errorf("must be at least 1s")
+	}
+	return step, nil
+}
+
+// writeError writes JSON error response.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,117 @@
+package history
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+	fields := []string{"total_duration_seconds", statusField}
+	nan := math.NaN()
+	points := []point{
+		{timestamp: 100, values: []float64{0.2, 1}},
+		{timestamp: 130, values: []float64{0.4, 1}},
+		{timestamp: 170, values: []float64{nan, 0}},
+		// the second bucket has outages only
+		{timestamp: 200, values: []float64{nan, 0}},
+		// the third bucket is empty
+		{timestamp: 330, values: []float64{0.1, 1}},
+	}
+
+	tests := []struct {
+		name string
+		step int64
+		want []*Bucket
+	}{
+		{
+			name: "raw points",
+			step: 0,
+			want: []*Bucket{
+				{Timestamp: 100, Count: 1, Values: map[string]Aggregate{
+					"total_duration_seconds": {Min: 0.2, Avg: 0.2, Max: 0.2, P95: 0.2},
+					statusField:              {Min: 1, Avg: 1, Max: 1, P95: 1},
+				}},
+				{Timestamp: 130, Count: 1, Values: map[string]Aggregate{
+					"total_duration_seconds": {Min: 0.4, Avg: 0.4, Max: 0.4, P95: 0.4},
+					statusField:              {Min: 1, Avg: 1, Max: 1, P95: 1},
+				}},
+				{Timestamp: 170, Count: 1, Values: map[string]Aggregate{statusField: {}}},
+				{Timestamp: 200, Count: 1, Values: map[string]Aggregate{statusField: {}}},
+				{Timestamp: 330, Count: 1, Values: map[string]Aggregate{
+					"total_duration_seconds": {Min: 0.1, Avg: 0.1, Max: 0.1, P95: 0.1},
+					statusField:              {Min: 1, Avg: 1, Max: 1, P95: 1},
+				}},
+			},
+		},
+		{
+			name: "buckets",
+			step: 100,
+			want: []*Bucket{
+				{Timestamp: 100, Count: 3, Values: map[string]Aggregate{
+					"total_duration_seconds": {Min: 0.2, Avg: 0.30000000000000004, Max: 0.4, P95: 0.4},
+					statusField:              {Min: 0, Avg: 2.0 / 3, Max: 1, P95: 1},
+				}},
+				{Timestamp: 200, Count: 1, Values: map[string]Aggregate{statusField: {}}},
+				{Timestamp: 300, Count: 1, Values: map[string]Aggregate{
+					"total_duration_seconds": {Min: 0.1, Avg: 0.1, Max: 0.1, P95: 0.1},
+					statusField:              {Min: 1, Avg: 1, Max: 1, P95: 1},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := downsample(points, fields, 100, tt.step)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d buckets, got %d", len(tt.want), len(got))
+			}
+			for i, want := range tt.want {
+				if got[i].Timestamp != want.Timestamp || got[i].Count != want.Count {
+					t.Errorf("bucket %d: got timestamp %d and count %d, want %d and %d",
+						i, got[i].Timestamp, got[i].Count, want.Timestamp, want.Count)
+				}
+				if len(got[i].Values) != len(want.Values) {
+					t.Errorf("bucket %d: got values %v, want %v", i, got[i].Values, want.Values)
+					continue
+				}
+				for field, agg := range want.Values {
+					if got[i].Values[field] != agg {
+						t.Errorf("bucket %d: got %s %+v, want %+v", i, field, got[i].Values[field], agg)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateP95(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   float64
+	}{
+		{name: "single value", values: []float64{5}, want: 5},
+		{name: "nearest rank of 20 values", values: seq(20), want: 19},
+		{name: "nearest rank of 21 values", values: seq(21), want: 20},
+		{name: "nearest rank of 100 values", values: seq(100), want: 95},
+		{name: "unordered values", values: []float64{3, 1, 2}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aggregate(tt.values).P95; got != tt.want {
+				t.Errorf("got p95 %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// seq returns values from 1 to n in the reverse order.
+func seq(n int) []float64 {
+	values := make([]float64, 0, n)
+	for i := n; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+	return values
+}
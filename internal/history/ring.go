@@ -0,0 +1,195 @@
+package history
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// ringMagic identifies history ring files and their format version
+const ringMagic = "APHIST01"
+
+// ringHeaderSize is the size of the header: magic, capacity, next record, records count, values per record
+const ringHeaderSize = 8 + 4*8
+
+// point is a stored MP data point.
+type point struct {
+	// timestamp is the original data timestamp in seconds, or the refresh time of an outage
+	timestamp int64
+	// values are in the fields order, measurements of an outage are NaN
+	values []float64
+}
+
+// ring is a fixed size file of points, the oldest points are overwritten once it is full.
+type ring struct {
+	file     *os.File
+	capacity uint64
+	next     uint64
+	count    uint64
+	fields   uint64
+}
+
+// recordSize returns the size of a point record.
+func (r *ring) recordSize() int64 {
+	return int64(8 + 8*r.fields)
+}
+
+// openRing opens the ring file, creating it if needed.
+// A file of another format is recreated, a file of another capacity is resized keeping the latest points.
+func openRing(path string, capacity, fields int) (*ring, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ring{file: file, capacity: uint64(capacity), fields: uint64(fields)}
+	existing, err := r.readHeader()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if existing == nil || existing.fields != r.fields {
+		// new or incompatible file
+		if err := r.reset(nil); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+
+	if existing.capacity != r.capacity {
+		existing.file = file
+		points, err := existing.readAll()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := r.reset(points); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+
+	r.next, r.count = existing.next, existing.count
+	return r, nil
+}
+
+// readHeader reads the file header, nil is returned for an empty or foreign file.
+func (r *ring) readHeader() (*ring, error) {
+	header := make([]byte, ringHeaderSize)
+	if _, err := r.file.ReadAt(header, 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if string(header[:8]) != ringMagic {
+		return nil, nil
+	}
+
+	h := &ring{
+		capacity: binary.LittleEndian.Uint64(header[8:]),
+		next:     binary.LittleEndian.Uint64(header[16:]),
+		count:    binary.LittleEndian.Uint64(header[24:]),
+		fields:   binary.LittleEndian.Uint64(header[32:]),
+	}
+	if h.capacity == 0 || h.next >= h.capacity || h.count > h.capacity {
+		return nil, nil
+	}
+	return h, nil
+}
+
+// writeHeader writes the file header.
+func (r *ring) writeHeader() error {
+	header := make([]byte, ringHeaderSize)
+	copy(header, ringMagic)
+	binary.LittleEndian.PutUint64(header[8:], r.capacity)
+	binary.LittleEndian.PutUint64(header[16:], r.next)
+	binary.LittleEndian.PutUint64(header[24:], r.count)
+	binary.LittleEndian.PutUint64(header[32:], r.fields)
+	_, err := r.file.WriteAt(header, 0)
+	return err
+}
+
+// reset truncates the file and writes the latest points.
+func (r *ring) reset(points []point) error {
+	if err := r.file.Truncate(0); err != nil {
+		return err
+	}
+	r.next, r.count = 0, 0
+	if uint64(len(points)) > r.capacity {
+		points = points[uint64(len(points))-r.capacity:]
+	}
+	for _, p := range points {
+		if err := r.append(p); err != nil {
+			return err
+		}
+	}
+	return r.writeHeader()
+}
+
+// append writes the point, overwriting the oldest one if the ring is full.
+func (r *ring) append(p point) error {
+	if uint64(len(p.values)) != r.fields {
+		return fmt.Errorf("point has %d values, expected %d", len(p.values), r.fields)
+	}
+
+	record := make([]byte, r.recordSize())
+	binary.LittleEndian.PutUint64(record, uint64(p.timestamp))
+	for i, v := range p.values {
+		binary.LittleEndian.PutUint64(record[8+8*i:], math.Float64bits(v))
+	}
+	if _, err := r.file.WriteAt(record, ringHeaderSize+int64(r.next)*r.recordSize()); err != nil {
+		return err
+	}
+
+	r.next = (r.next + 1) % r.capacity
+	r.count = min(r.count+1, r.capacity)
+	return r.writeHeader()
+}
+
+// readAll reads all points ordered by timestamp, points with the same timestamp are deduplicated.
+func (r *ring) readAll() ([]point, error) {
+	data := make([]byte, int64(r.count)*r.recordSize())
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if _, err := r.file.ReadAt(data, ringHeaderSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	points := make([]point, 0, r.count)
+	for i := uint64(0); i < r.count; i++ {
+		record := data[int64(i)*r.recordSize():]
+		p := point{
+			timestamp: int64(binary.LittleEndian.Uint64(record)),
+			values:    make([]float64, r.fields),
+		}
+		for j := range p.values {
+			p.values[j] = math.Float64frombits(binary.LittleEndian.Uint64(record[8+8*j:]))
+		}
+		points = append(points, p)
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].timestamp < points[j].timestamp })
+	deduped := points[:0]
+	for _, p := range points {
+		if len(deduped) > 0 && deduped[len(deduped)-1].timestamp == p.timestamp {
+			deduped[len(deduped)-1] = p
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped, nil
+}
+
+// close closes the ring file.
+func (r *ring) close() error {
+	return r.file.Close()
+}
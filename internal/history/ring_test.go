@@ -0,0 +1,120 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// timestamps returns timestamps of the points.
+func timestamps(points []point) []int64 {
+	result := make([]int64, 0, len(points))
+	for _, p := range points {
+		result = append(result, p.timestamp)
+	}
+	return result
+}
+
+func equalTimestamps(got, want []int64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRingWrapAround(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1.ring")
+	r, err := openRing(path, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(1); ts <= 5; ts++ {
+		if err := r.append(point{timestamp: ts, values: []float64{float64(ts), 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	points, err := r.readAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := timestamps(points), []int64{3, 4, 5}; !equalTimestamps(got, want) {
+		t.Fatalf("got points %v, want %v", got, want)
+	}
+	if points[0].values[0] != 3 {
+		t.Errorf("expected values of the point to be kept, got %v", points[0].values)
+	}
+
+	// the position of the next point survives reopening
+	r.close()
+	if r, err = openRing(path, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	defer r.close()
+	if err := r.append(point{timestamp: 6, values: []float64{6, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if points, err = r.readAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := timestamps(points), []int64{4, 5, 6}; !equalTimestamps(got, want) {
+		t.Errorf("got points %v after reopening, want %v", got, want)
+	}
+}
+
+func TestRingReopen(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		fields   int
+		want     []int64
+	}{
+		{name: "same capacity", capacity: 4, fields: 2, want: []int64{2, 3, 4, 5}},
+		{name: "smaller capacity keeps the latest points", capacity: 2, fields: 2, want: []int64{4, 5}},
+		{name: "larger capacity keeps all points", capacity: 10, fields: 2, want: []int64{2, 3, 4, 5}},
+		{name: "other fields count resets the file", capacity: 4, fields: 3, want: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "1.ring")
+			r, err := openRing(path, 4, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ts := int64(1); ts <= 5; ts++ {
+				if err := r.append(point{timestamp: ts, values: []float64{float64(ts), 1}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.close()
+
+			if r, err = openRing(path, tt.capacity, tt.fields); err != nil {
+				t.Fatal(err)
+			}
+			defer r.close()
+			points, err := r.readAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := timestamps(points); !equalTimestamps(got, tt.want) {
+				t.Fatalf("got points %v, want %v", got, tt.want)
+			}
+
+			// the resized ring wraps around at the new capacity
+			if err := r.append(point{timestamp: 6, values: make([]float64, tt.fields)}); err != nil {
+				t.Fatal(err)
+			}
+			if points, err = r.readAll(); err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != min(len(tt.want)+1, tt.capacity) || points[len(points)-1].timestamp != 6 {
+				t.Errorf("got points %v after append", timestamps(points))
+			}
+		})
+	}
+}
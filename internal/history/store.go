@@ -0,0 +1,272 @@
+// Package history is an embedded file-backed store of MP measurements for quick investigations without Prometheus.
+package history
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/exporter"
+)
+
+const (
+	ringExt = ".ring"
+	// cleanupInterval is the interval between removals of series without points within the retention
+	cleanupInterval = time.Hour
+)
+
+// statusField is the name of the MP status value, stored after the measurements
+const statusField = "status"
+
+// validID checks task and MP IDs, which are used as file names
+var validID = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// Config is the history store configuration.
+type Config struct {
+	// Dir is the directory of the ring files, one per task MP
+	Dir string
+	// Retention is the maximum age of the points
+	Retention time.Duration
+	// MaxPoints is the capacity of each ring, the oldest points are overwritten once it is full
+	MaxPoints int
+}
+
+// Store keeps MP measurements and status of every task MP in a bounded ring file.
+// It is a sink, so it gets every new MP data point once, and every MP outage at refresh time.
+type Store struct {
+	conf   *Config
+	fields []string
+	log    *logrus.Entry
+
+	mu    sync.Mutex
+	rings map[string]*ring
+}
+
+// Open opens the history store, points stored by the previous run are kept.
+func Open(conf *Config) (*Store, error) {
+	if conf.Retention <= 0 || conf.MaxPoints <= 0 {
+		return nil, fmt.Errorf("history retention and max points must be positive")
+	}
+	if err := os.MkdirAll(conf.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	fields := make([]string, 0, len(exporter.Measurements)+1)
+	for _, m := range exporter.Measurements {
+		fields = append(fields, m.Field)
+	}
+	fields = append(fields, statusField)
+
+	s := &Store{
+		conf:   conf,
+		fields: fields,
+		log:    logrus.WithField("component", "history"),
+		rings:  make(map[string]*ring),
+	}
+	s.cleanup()
+	return s, nil
+}
+
+// Fields returns names of the stored values.
+func (s *Store) Fields() []string {
+	return s.fields
+}
+
+// Push implements sink.Sink, points are written synchronously.
+// Every sample is a successful measurement, so its status is 1.
+func (s *Store) Push(samples []*exporter.Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sample := range samples {
+		values := make([]float64, 0, len(s.fields))
+		for _, m := range exporter.Measurements {
+			values = append(values, m.Value(sample.Result))
+		}
+		values = append(values, 1)
+
+		if err := s.write(sample.Labels, point{timestamp: sample.Result.Timestamp, values: values}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PushOutages implements sink.OutageSink, points are written synchronously.
+// An outage has status 0 and no measurements, they are stored as NaN.
+func (s *Store) PushOutages(outages []*exporter.Outage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, outage := range outages {
+		values := make([]float64, 0, len(s.fields))
+		for range exporter.Measurements {
+			values = append(values, math.NaN())
+		}
+		values = append(values, 0)
+
+		if err := s.write(outage.Labels, point{timestamp: outage.Timestamp, values: values}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the point to the ring of the MP, it must be called with the lock held.
+func (s *Store) write(labels prometheus.Labels, p point) error {
+	r, err := s.ring(labels[exporter.LabelTaskID], labels[exporter.LabelMPID], true)
+	if err != nil {
+		exporter.EErrorsTotal.WithLabelValues("history", "write", labels[exporter.LabelTaskID], labels[exporter.LabelTaskName]).Inc()
+		return err
+	}
+	if err := r.append(p); err != nil {
+		exporter.EErrorsTotal.WithLabelValues("history", "write", labels[exporter.LabelTaskID], labels[exporter.LabelTaskName]).Inc()
+		return fmt.Errorf("failed to write history point: %w", err)
+	}
+	return nil
+}
+
+// Run implements sink.Sink. It removes outdated series until ctx is done, then closes the files.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanup()
+		case <-ctx.Done():
+			s.log.Info("Closing history store...")
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for key, r := range s.rings {
+				r.close()
+				delete(s.rings, key)
+			}
+			return
+		}
+	}
+}
+
+// Query returns points of the task MPs within [from, to] by MP ID, all task MPs are returned if mpID is empty.
+func (s *Store) Query(taskID int, mpID string, from, to time.Time) (map[string][]point, error) {
+	if mpID != "" && !validID.MatchString(mpID) {
+		return nil, fmt.Errorf("invalid MP ID '%s'", mpID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taskIDStr := strconv.Itoa(taskID)
+	mpIDs := []string{mpID}
+	if mpID == "" {
+		entries, err := os.ReadDir(filepath.Join(s.conf.Dir, taskIDStr))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		mpIDs = make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if id, ok := strings.CutSuffix(entry.Name(), ringExt); ok && validID.MatchString(id) {
+				mpIDs = append(mpIDs, id)
+			}
+		}
+	}
+
+	// points older than the retention are not returned, even if they were not overwritten yet
+	if minFrom := time.Now().Add(-s.conf.Retention); from.Before(minFrom) {
+		from = minFrom
+	}
+
+	result := make(map[string][]point, len(mpIDs))
+	for _, id := range mpIDs {
+		r, err := s.ring(taskIDStr, id, false)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			continue
+		}
+
+		points, err := r.readAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of MP %s: %w", id, err)
+		}
+		selected := make([]point, 0, len(points))
+		for _, p := range points {
+			if p.timestamp >= from.Unix() && p.timestamp <= to.Unix() {
+				selected = append(selected, p)
+			}
+		}
+		result[id] = selected
+	}
+	return result, nil
+}
+
+// ring returns the opened ring of the task MP, a missing ring is created only if create is true.
+// It must be called with the lock held.
+func (s *Store) ring(taskID, mpID string, create bool) (*ring, error) {
+	if !validID.MatchString(taskID) || !validID.MatchString(mpID) {
+		return nil, fmt.Errorf("invalid task ID '%s' or MP ID '%s'", taskID, mpID)
+	}
+
+	key := taskID + "/" + mpID
+	if r, ok := s.rings[key]; ok {
+		return r, nil
+	}
+
+	path := filepath.Join(s.conf.Dir, taskID, mpID+ringExt)
+	if _, err := os.Stat(path); os.IsNotExist(err) && !create {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	r, err := openRing(path, s.conf.MaxPoints, len(s.fields))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file '%s': %w", path, err)
+	}
+	s.rings[key] = r
+	return r, nil
+}
+
+// cleanup removes ring files which were not written within the retention, e.g. of removed tasks.
+func (s *Store) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outdated := time.Now().Add(-s.conf.Retention)
+	paths, err := filepath.Glob(filepath.Join(s.conf.Dir, "*", "*"+ringExt))
+	if err != nil {
+		s.log.Errorf("Failed to list history files: %v", err)
+		return
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(outdated) {
+			continue
+		}
+
+		key := filepath.Base(filepath.Dir(path)) + "/" + strings.TrimSuffix(filepath.Base(path), ringExt)
+		if r, ok := s.rings[key]; ok {
+			r.close()
+			delete(s.rings, key)
+		}
+		if err := os.Remove(path); err != nil {
+			s.log.Errorf("Failed to remove outdated history file: %v", err)
+			continue
+		}
+		s.log.WithField("series", key).Info("Outdated history removed")
+	}
+}
@@ -0,0 +1,63 @@
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+)
+
+func TestStoreOutages(t *testing.T) {
+	store, err := Open(&Config{Dir: t.TempDir(), Retention: time.Hour, MaxPoints: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := prometheus.Labels{exporter.LabelTaskID: "1001", exporter.LabelTaskName: "Main site", exporter.LabelMPID: "1"}
+	now := time.Now().Unix()
+	if err := store.Push([]*exporter.Sample{{
+		Labels: labels,
+		Result: &client.MonitoringPointConnectionResult{Total: 0.3, Timestamp: now - 120},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PushOutages([]*exporter.Outage{{Labels: labels, Timestamp: now - 60}}); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(Handler(store))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "?task_id=1001&mp_id=1&from=" + strconv.FormatInt(now-300, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	var result Response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Series) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(result.Series))
+	}
+	points := result.Series[0].Points
+	if len(points) != 2 {
+		t.Fatalf("expected the measurement and the outage, got %d points", len(points))
+	}
+	if got := points[0].Values; got[statusField].Avg != 1 || got["total_duration_seconds"].Avg != 0.3 {
+		t.Errorf("unexpected measurement point %+v", got)
+	}
+	if got := points[1].Values; got[statusField].Avg != 0 || len(got) != 1 {
+		t.Errorf("expected the outage point to have status 0 only, got %+v", got)
+	}
+}
@@ -10,6 +10,13 @@ func Init(level string) {
 		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
 	})
 
+	SetLevel(level)
+
+	logrus.Info("Logger initialized")
+}
+
+// SetLevel sets log level, 'info' is used if the level is invalid
+func SetLevel(level string) {
 	logLevel, err := logrus.ParseLevel(level)
 	if err != nil {
 		logrus.WithError(err).Warnf("Invalid log level '%s', defaulting to 'info'", level)
@@ -17,6 +24,4 @@ func Init(level string) {
 	} else {
 		logrus.SetLevel(logLevel)
 	}
-
-	logrus.Info("Logger initialized")
 }
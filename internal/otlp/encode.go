@@ -0,0 +1,222 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE of OTLP
+const aggregationTemporalityCumulative = 2
+
+// Field numbers of OTLP messages (opentelemetry/proto/metrics/v1/metrics.proto)
+const (
+	// ExportMetricsServiceRequest
+	fieldRequestResourceMetrics protowire.Number = 1
+	// ResourceMetrics
+	fieldResourceMetricsResource     protowire.Number = 1
+	fieldResourceMetricsScopeMetrics protowire.Number = 2
+	// Resource
+	fieldResourceAttributes protowire.Number = 1
+	// ScopeMetrics
+	fieldScopeMetricsScope   protowire.Number = 1
+	fieldScopeMetricsMetrics protowire.Number = 2
+	// InstrumentationScope
+	fieldScopeName    protowire.Number = 1
+	fieldScopeVersion protowire.Number = 2
+	// KeyValue and AnyValue
+	fieldKeyValueKey    protowire.Number = 1
+	fieldKeyValueValue  protowire.Number = 2
+	fieldAnyValueString protowire.Number = 1
+	// Metric
+	fieldMetricName        protowire.Number = 1
+	fieldMetricDescription protowire.Number = 2
+	fieldMetricGauge       protowire.Number = 5
+	fieldMetricSum         protowire.Number = 7
+	fieldMetricHistogram   protowire.Number = 9
+	// Gauge, Sum and Histogram
+	fieldDataPoints             protowire.Number = 1
+	fieldAggregationTemporality protowire.Number = 2
+	fieldSumIsMonotonic         protowire.Number = 3
+	// NumberDataPoint
+	fieldNumberStartTime  protowire.Number = 2
+	fieldNumberTime       protowire.Number = 3
+	fieldNumberAsDouble   protowire.Number = 4
+	fieldNumberAttributes protowire.Number = 7
+	// HistogramDataPoint
+	fieldHistogramStartTime      protowire.Number = 2
+	fieldHistogramTime           protowire.Number = 3
+	fieldHistogramCount          protowire.Number = 4
+	fieldHistogramSum            protowire.Number = 5
+	fieldHistogramBucketCounts   protowire.Number = 6
+	fieldHistogramExplicitBounds protowire.Number = 7
+	fieldHistogramAttributes     protowire.Number = 9
+)
+
+// encodeRequest encodes an ExportMetricsServiceRequest message with a single resource and scope.
+// Gauges and untyped metrics are mapped to OTLP gauges, counters to cumulative monotonic sums
+// and histograms to cumulative histograms. Summaries are skipped.
+// Metrics timestamps are kept, metrics without them get now.
+func encodeRequest(families []*dto.MetricFamily, resource map[string]string, scopeName, scopeVersion string, start, now time.Time) []byte {
+	var scope []byte
+	scope = appendString(scope, fieldScopeName, scopeName)
+	scope = appendString(scope, fieldScopeVersion, scopeVersion)
+
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, fieldScopeMetricsScope, scope)
+	for _, family := range families {
+		if metric := encodeMetric(family, start, now); metric != nil {
+			scopeMetrics = appendMessage(scopeMetrics, fieldScopeMetricsMetrics, metric)
+		}
+	}
+
+	var res []byte
+	for _, key := range sortedKeys(resource) {
+		res = appendMessage(res, fieldResourceAttributes, encodeKeyValue(key, resource[key]))
+	}
+
+	var resourceMetrics []byte
+	resourceMetrics = appendMessage(resourceMetrics, fieldResourceMetricsResource, res)
+	resourceMetrics = appendMessage(resourceMetrics, fieldResourceMetricsScopeMetrics, scopeMetrics)
+
+	return appendMessage(nil, fieldRequestResourceMetrics, resourceMetrics)
+}
+
+// encodeMetric encodes a Metric message, nil is returned for unsupported metric types.
+func encodeMetric(family *dto.MetricFamily, start, now time.Time) []byte {
+	var data []byte
+	var dataField protowire.Number
+
+	switch family.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		dataField = fieldMetricGauge
+		for _, m := range family.GetMetric() {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			data = appendMessage(data, fieldDataPoints, encodeNumberDataPoint(m, value, time.Time{}, now))
+		}
+	case dto.MetricType_COUNTER:
+		dataField = fieldMetricSum
+		for _, m := range family.GetMetric() {
+			data = appendMessage(data, fieldDataPoints, encodeNumberDataPoint(m, m.GetCounter().GetValue(), start, now))
+		}
+		data = protowire.AppendTag(data, fieldAggregationTemporality, protowire.VarintType)
+		data = protowire.AppendVarint(data, aggregationTemporalityCumulative)
+		data = protowire.AppendTag(data, fieldSumIsMonotonic, protowire.VarintType)
+		data = protowire.AppendVarint(data, 1)
+	case dto.MetricType_HISTOGRAM:
+		dataField = fieldMetricHistogram
+		for _, m := range family.GetMetric() {
+			data = appendMessage(data, fieldDataPoints, encodeHistogramDataPoint(m, start, now))
+		}
+		data = protowire.AppendTag(data, fieldAggregationTemporality, protowire.VarintType)
+		data = protowire.AppendVarint(data, aggregationTemporalityCumulative)
+	default:
+		return nil
+	}
+
+	var metric []byte
+	metric = appendString(metric, fieldMetricName, family.GetName())
+	metric = appendString(metric, fieldMetricDescription, family.GetHelp())
+	return appendMessage(metric, dataField, data)
+}
+
+// encodeNumberDataPoint encodes a NumberDataPoint message, zero start time is omitted.
+func encodeNumberDataPoint(m *dto.Metric, value float64, start, now time.Time) []byte {
+	var dp []byte
+	for _, l := range m.GetLabel() {
+		dp = appendMessage(dp, fieldNumberAttributes, encodeKeyValue(l.GetName(), l.GetValue()))
+	}
+	if !start.IsZero() {
+		dp = appendTime(dp, fieldNumberStartTime, start)
+	}
+	dp = appendTime(dp, fieldNumberTime, metricTime(m, now))
+	dp = protowire.AppendTag(dp, fieldNumberAsDouble, protowire.Fixed64Type)
+	return protowire.AppendFixed64(dp, math.Float64bits(value))
+}
+
+// encodeHistogramDataPoint encodes a HistogramDataPoint message.
+// Prometheus buckets are cumulative, while OTLP bucket counts are not and include +Inf bucket.
+func encodeHistogramDataPoint(m *dto.Metric, start, now time.Time) []byte {
+	h := m.GetHistogram()
+
+	bounds := make([]float64, 0, len(h.GetBucket()))
+	counts := make([]uint64, 0, len(h.GetBucket())+1)
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		bounds = append(bounds, b.GetUpperBound())
+		counts = append(counts, b.GetCumulativeCount()-prev)
+		prev = b.GetCumulativeCount()
+	}
+	counts = append(counts, h.GetSampleCount()-prev)
+
+	var dp []byte
+	for _, l := range m.GetLabel() {
+		dp = appendMessage(dp, fieldHistogramAttributes, encodeKeyValue(l.GetName(), l.GetValue()))
+	}
+	dp = appendTime(dp, fieldHistogramStartTime, start)
+	dp = appendTime(dp, fieldHistogramTime, metricTime(m, now))
+	dp = protowire.AppendTag(dp, fieldHistogramCount, protowire.Fixed64Type)
+	dp = protowire.AppendFixed64(dp, h.GetSampleCount())
+	dp = protowire.AppendTag(dp, fieldHistogramSum, protowire.Fixed64Type)
+	dp = protowire.AppendFixed64(dp, math.Float64bits(h.GetSampleSum()))
+
+	var packed []byte
+	for _, c := range counts {
+		packed = protowire.AppendFixed64(packed, c)
+	}
+	dp = appendMessage(dp, fieldHistogramBucketCounts, packed)
+
+	packed = nil
+	for _, b := range bounds {
+		packed = protowire.AppendFixed64(packed, math.Float64bits(b))
+	}
+	return appendMessage(dp, fieldHistogramExplicitBounds, packed)
+}
+
+// encodeKeyValue encodes a KeyValue message with a string value.
+func encodeKeyValue(key, value string) []byte {
+	var kv []byte
+	kv = appendString(kv, fieldKeyValueKey, key)
+	return appendMessage(kv, fieldKeyValueValue, appendString(nil, fieldAnyValueString, value))
+}
+
+// metricTime returns the metric timestamp, or now if it has none.
+func metricTime(m *dto.Metric, now time.Time) time.Time {
+	if m.TimestampMs != nil {
+		return time.UnixMilli(m.GetTimestampMs())
+	}
+	return now
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, uint64(t.UnixNano()))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,203 @@
+package otlp
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeRequest decodes an ExportMetricsServiceRequest, which has the same wire format as MetricsData.
+func decodeRequest(t *testing.T, body []byte) *metricspb.ResourceMetrics {
+	t.Helper()
+	data := &metricspb.MetricsData{}
+	if err := proto.Unmarshal(body, data); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if len(data.ResourceMetrics) != 1 || len(data.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("expected a single resource and scope, got %v", data)
+	}
+	return data.ResourceMetrics[0]
+}
+
+// attributes returns string attributes as a map.
+func attributes(kvs []*commonpb.KeyValue) map[string]string {
+	attrs := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	return attrs
+}
+
+func label(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)}
+}
+
+func TestEncodeRequest(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := time.Unix(1700000600, 0)
+	dataTime := time.UnixMilli(1700000420123)
+
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("apatit_mp_total_duration_seconds"),
+			Help: proto.String("Total duration."),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Label:       []*dto.LabelPair{label("mp_id", "1"), label("task_id", "1001")},
+				Gauge:       &dto.Gauge{Value: proto.Float64(0.231)},
+				TimestampMs: proto.Int64(dataTime.UnixMilli()),
+			}},
+		},
+		{
+			Name: proto.String("apatit_exporter_up"),
+			Type: dto.MetricType_UNTYPED.Enum(),
+			Metric: []*dto.Metric{{
+				Untyped: &dto.Untyped{Value: proto.Float64(1)},
+			}},
+		},
+		{
+			Name: proto.String("apatit_api_requests_total"),
+			Help: proto.String("Total API requests."),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label:   []*dto.LabelPair{label("sa", "tm")},
+				Counter: &dto.Counter{Value: proto.Float64(42)},
+			}},
+		},
+		{
+			Name: proto.String("apatit_api_request_duration_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(10),
+					SampleSum:   proto.Float64(4.5),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(2)},
+						{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(5)},
+						{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(9)},
+					},
+				},
+			}},
+		},
+		{
+			Name: proto.String("apatit_histogram_with_inf"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(3),
+					SampleSum:   proto.Float64(7),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)},
+						{UpperBound: proto.Float64(math.Inf(1)), CumulativeCount: proto.Uint64(3)},
+					},
+				},
+			}},
+		},
+		{
+			Name: proto.String("apatit_summary"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Summary: &dto.Summary{SampleCount: proto.Uint64(1), SampleSum: proto.Float64(1)},
+			}},
+		},
+	}
+	resource := map[string]string{"service.name": "apatit", "service.version": "1.2.3", "pingadmin.account": "acme"}
+
+	rm := decodeRequest(t, encodeRequest(families, resource, "apatit", "1.2.3", start, now))
+
+	if got := attributes(rm.Resource.Attributes); !reflect.DeepEqual(got, resource) {
+		t.Errorf("resource attributes = %v, want %v", got, resource)
+	}
+	sm := rm.ScopeMetrics[0]
+	if sm.Scope.Name != "apatit" || sm.Scope.Version != "1.2.3" {
+		t.Errorf("scope = %s %s, want apatit 1.2.3", sm.Scope.Name, sm.Scope.Version)
+	}
+
+	metrics := make(map[string]*metricspb.Metric)
+	for _, m := range sm.Metrics {
+		metrics[m.Name] = m
+	}
+	if len(metrics) != 5 {
+		t.Fatalf("expected 5 metrics without the summary, got %d", len(metrics))
+	}
+
+	t.Run("gauge keeps the metric timestamp", func(t *testing.T) {
+		m := metrics["apatit_mp_total_duration_seconds"]
+		if m.Description != "Total duration." {
+			t.Errorf("description = %q", m.Description)
+		}
+		dps := m.GetGauge().GetDataPoints()
+		if len(dps) != 1 {
+			t.Fatalf("expected a gauge data point, got %v", m)
+		}
+		dp := dps[0]
+		if dp.GetAsDouble() != 0.231 || dp.TimeUnixNano != uint64(dataTime.UnixNano()) || dp.StartTimeUnixNano != 0 {
+			t.Errorf("data point = %v", dp)
+		}
+		if got, want := attributes(dp.Attributes), map[string]string{"mp_id": "1", "task_id": "1001"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("attributes = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("untyped is a gauge", func(t *testing.T) {
+		dps := metrics["apatit_exporter_up"].GetGauge().GetDataPoints()
+		if len(dps) != 1 || dps[0].GetAsDouble() != 1 || dps[0].TimeUnixNano != uint64(now.UnixNano()) {
+			t.Errorf("data points = %v", dps)
+		}
+	})
+
+	t.Run("counter is a cumulative monotonic sum with start time", func(t *testing.T) {
+		sum := metrics["apatit_api_requests_total"].GetSum()
+		if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+			t.Fatalf("sum = %v", sum)
+		}
+		dp := sum.DataPoints[0]
+		if dp.GetAsDouble() != 42 || dp.StartTimeUnixNano != uint64(start.UnixNano()) || dp.TimeUnixNano != uint64(now.UnixNano()) {
+			t.Errorf("data point = %v", dp)
+		}
+		if got := attributes(dp.Attributes); got["sa"] != "tm" {
+			t.Errorf("attributes = %v", got)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		bounds []float64
+		counts []uint64
+	}{
+		// the +Inf bucket is implicit in Prometheus histograms without it
+		{name: "apatit_api_request_duration_seconds", bounds: []float64{0.1, 0.5, 1}, counts: []uint64{2, 3, 4, 1}},
+		{name: "apatit_histogram_with_inf", bounds: []float64{1}, counts: []uint64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run("histogram "+tt.name, func(t *testing.T) {
+			h := metrics[tt.name].GetHistogram()
+			if h == nil || h.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+				t.Fatalf("histogram = %v", h)
+			}
+			dp := h.DataPoints[0]
+			if !reflect.DeepEqual(dp.ExplicitBounds, tt.bounds) {
+				t.Errorf("bounds = %v, want %v", dp.ExplicitBounds, tt.bounds)
+			}
+			if !reflect.DeepEqual(dp.BucketCounts, tt.counts) {
+				t.Errorf("bucket counts = %v, want %v", dp.BucketCounts, tt.counts)
+			}
+			var total uint64
+			for _, c := range dp.BucketCounts {
+				total += c
+			}
+			if total != dp.Count {
+				t.Errorf("bucket counts sum %d != count %d", total, dp.Count)
+			}
+			if dp.StartTimeUnixNano != uint64(start.UnixNano()) || dp.TimeUnixNano != uint64(now.UnixNano()) {
+				t.Errorf("data point times = %d, %d", dp.StartTimeUnixNano, dp.TimeUnixNano)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package otlp periodically pushes APATIT metrics to an OpenTelemetry collector with OTLP/HTTP.
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/exporter"
+	"apatit/internal/version"
+)
+
+// metricsPrefix selects APATIT metrics, Go runtime and process metrics are not exported
+const metricsPrefix = "apatit_"
+
+// Config is the OTLP exporter configuration.
+type Config struct {
+	// Endpoint is the OTLP/HTTP metrics URL, e.g. http://collector:4318/v1/metrics
+	Endpoint string
+	// Headers are extra HTTP headers of the requests, e.g. for authentication
+	Headers map[string]string
+	// Account is the Ping-Admin account name added to the resource attributes, omitted if empty
+	Account  string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Exporter pushes metrics gathered from the Prometheus registry to the OTLP endpoint.
+// Metrics keep their names, labels become datapoint attributes.
+type Exporter struct {
+	conf       *Config
+	gatherer   prometheus.Gatherer
+	httpClient *http.Client
+	resource   map[string]string
+	start      time.Time
+	log        *logrus.Entry
+}
+
+// New creates an OTLP exporter of the metrics of the gatherer.
+func New(conf *Config, gatherer prometheus.Gatherer) (*Exporter, error) {
+	u, err := url.Parse(conf.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': must be an absolute http(s) URL", conf.Endpoint)
+	}
+	if conf.Interval <= 0 {
+		return nil, fmt.Errorf("OTLP export interval must be positive, got %s", conf.Interval)
+	}
+
+	resource := map[string]string{
+		"service.name":    version.Name,
+		"service.version": version.Version,
+	}
+	if conf.Account != "" {
+		resource["pingadmin.account"] = conf.Account
+	}
+
+	return &Exporter{
+		conf:       conf,
+		gatherer:   gatherer,
+		httpClient: &http.Client{Timeout: conf.Timeout},
+		resource:   resource,
+		start:      time.Now(),
+		log:        logrus.WithField("component", "otlp"),
+	}, nil
+}
+
+// Run exports metrics every interval until ctx is done.
+// Failed exports are not retried, the next export sends the current values.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.export(ctx); err != nil {
+				exporter.EErrorsTotal.WithLabelValues("otlp", "export", "", "").Inc()
+				e.log.Errorf("Failed to export metrics: %v", err)
+			}
+		case <-ctx.Done():
+			e.log.Info("Stopping OTLP exporter...")
+			return
+		}
+	}
+}
+
+// export gathers and sends APATIT metrics.
+func (e *Exporter) export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		// partial result is still exported
+		e.log.Warnf("Some metrics were not gathered: %v", err)
+	}
+
+	selected := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), metricsPrefix) {
+			selected = append(selected, family)
+		}
+	}
+
+	body := encodeRequest(selected, e.resource, version.Name, version.Version, e.start, time.Now())
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.conf.Endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	for name, value := range e.conf.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", version.Name, version.Version))
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	e.log.WithField("metrics", len(selected)).Debug("Metrics exported")
+	return nil
+}
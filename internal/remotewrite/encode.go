@@ -0,0 +1,115 @@
+package remotewrite
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"apatit/internal/exporter"
+)
+
+// label is a prometheus.Label message of the remote write protocol.
+type label struct {
+	name  string
+	value string
+}
+
+// sample is a prometheus.Sample message of the remote write protocol.
+type sample struct {
+	value float64
+	// timestamp is in milliseconds
+	timestamp int64
+}
+
+// timeSeries is a prometheus.TimeSeries message of the remote write protocol.
+type timeSeries struct {
+	labels  []label
+	samples []sample
+}
+
+// buildTimeSeries converts MP samples to a time series for each measurement metric.
+// Samples of the same series are grouped and ordered by timestamp.
+func buildTimeSeries(samples []*exporter.Sample) []*timeSeries {
+	seriesByKey := make(map[string]*timeSeries)
+	keys := make([]string, 0)
+
+	for _, s := range samples {
+		for _, m := range exporter.Measurements {
+			labels := make([]label, 0, len(s.Labels)+1)
+			labels = append(labels, label{name: "__name__", value: m.Name})
+			for name, value := range s.Labels {
+				labels = append(labels, label{name: name, value: value})
+			}
+			// labels must be sorted by name
+			sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+			key := seriesKey(labels)
+			ts, ok := seriesByKey[key]
+			if !ok {
+				ts = &timeSeries{labels: labels}
+				seriesByKey[key] = ts
+				keys = append(keys, key)
+			}
+			ts.samples = append(ts.samples, sample{value: m.Value(s.Result), timestamp: s.Result.Timestamp * 1000})
+		}
+	}
+
+	series := make([]*timeSeries, 0, len(keys))
+	for _, key := range keys {
+		ts := seriesByKey[key]
+		sort.Slice(ts.samples, func(i, j int) bool { return ts.samples[i].timestamp < ts.samples[j].timestamp })
+		series = append(series, ts)
+	}
+	return series
+}
+
+// seriesKey joins sorted labels to a unique series key.
+func seriesKey(labels []label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.name)
+		b.WriteByte(0xff)
+		b.WriteString(l.value)
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest message and compresses it with snappy block format.
+func encodeWriteRequest(series []*timeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, encodeTimeSeries(ts))
+	}
+	return snappy.Encode(nil, req)
+}
+
+// encodeTimeSeries encodes a prometheus.TimeSeries message.
+func encodeTimeSeries(ts *timeSeries) []byte {
+	var b []byte
+	for _, l := range ts.labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	for _, s := range ts.samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.timestamp))
+
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
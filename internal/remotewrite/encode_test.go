@@ -0,0 +1,98 @@
+package remotewrite
+
+import (
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+)
+
+func testSample(mpID string, timestamp int64, total float64) *exporter.Sample {
+	return &exporter.Sample{
+		Labels: prometheus.Labels{
+			exporter.LabelTaskID:   "1001",
+			exporter.LabelTaskName: "Main site",
+			exporter.LabelMPID:     mpID,
+			exporter.LabelMPName:   "Moscow",
+			exporter.LabelMPIP:     "192.0.2.1",
+			exporter.LabelMPGPS:    "55.7558,37.6173",
+		},
+		Result: &client.MonitoringPointConnectionResult{
+			Connect: 0.01, DNS: 0.002, Server: 0.1, Total: total, Speed: 1024, Timestamp: timestamp,
+		},
+	}
+}
+
+// decodeWriteRequest decodes the request with the reference protobuf definitions.
+func decodeWriteRequest(t *testing.T, data []byte) *prompb.WriteRequest {
+	t.Helper()
+	raw, err := snappy.Decode(nil, data)
+	if err != nil {
+		t.Fatalf("failed to decompress write request: %v", err)
+	}
+	var req prompb.WriteRequest
+	if err := req.Unmarshal(raw); err != nil {
+		t.Fatalf("failed to decode write request: %v", err)
+	}
+	return &req
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	samples := []*exporter.Sample{
+		testSample("1", 1700000180, 0.3),
+		testSample("2", 1700000000, 0.5),
+		// out of order sample of the first MP series
+		testSample("1", 1700000000, 0.2),
+	}
+
+	req := decodeWriteRequest(t, encodeWriteRequest(buildTimeSeries(samples)))
+
+	// a series per measurement and MP
+	if want := 2 * len(exporter.Measurements); len(req.Timeseries) != want {
+		t.Fatalf("expected %d time series, got %d", want, len(req.Timeseries))
+	}
+
+	var total *prompb.TimeSeries
+	for i, ts := range req.Timeseries {
+		for j := 1; j < len(ts.Labels); j++ {
+			if ts.Labels[j-1].Name >= ts.Labels[j].Name {
+				t.Errorf("labels of series %d are not sorted: %v", i, ts.Labels)
+			}
+		}
+		var name, mpID string
+		for _, l := range ts.Labels {
+			switch l.Name {
+			case "__name__":
+				name = l.Value
+			case exporter.LabelMPID:
+				mpID = l.Value
+			}
+		}
+		if name == "apatit_mp_total_duration_seconds" && mpID == "1" {
+			total = &req.Timeseries[i]
+		}
+	}
+	if total == nil {
+		t.Fatal("total duration series of MP 1 was not found")
+	}
+
+	want := []prompb.Sample{
+		{Value: 0.2, Timestamp: 1700000000000},
+		{Value: 0.3, Timestamp: 1700000180000},
+	}
+	if len(total.Samples) != len(want) {
+		t.Fatalf("expected %d samples, got %v", len(want), total.Samples)
+	}
+	for i := range want {
+		if total.Samples[i].Value != want[i].Value || total.Samples[i].Timestamp != want[i].Timestamp {
+			t.Errorf("sample %d: got %v, want %v", i, total.Samples[i], want[i])
+		}
+	}
+	if len(total.Labels) != 7 {
+		t.Errorf("expected __name__ and 6 MP labels, got %v", total.Labels)
+	}
+}
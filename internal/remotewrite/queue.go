@@ -0,0 +1,139 @@
+package remotewrite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// batchExt is an extension of the queued batch files
+const batchExt = ".batch"
+
+// queue is a bounded on-disk FIFO queue of encoded write requests.
+// Every batch is stored in a separate file named by its sequence number,
+// so the queue survives restarts. Once full, the oldest batches are dropped.
+type queue struct {
+	mu         sync.Mutex
+	dir        string
+	maxBatches int
+	batches    []uint64
+	nextSeq    uint64
+	// notify is signaled when a batch is pushed
+	notify chan struct{}
+}
+
+// openQueue opens the queue in the directory, creating it if needed.
+func openQueue(dir string, maxBatches int) (*queue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	q := &queue{
+		dir:        dir,
+		maxBatches: maxBatches,
+		batches:    make([]uint64, 0),
+		notify:     make(chan struct{}, 1),
+	}
+	for _, entry := range entries {
+		// a batch was being written when the process stopped
+		if strings.HasSuffix(entry.Name(), batchExt+".tmp") {
+			os.Remove(filepath.Join(dir, entry.Name()))
+			continue
+		}
+		seqStr, ok := strings.CutSuffix(entry.Name(), batchExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		q.batches = append(q.batches, seq)
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(q.batches, func(i, j int) bool { return q.batches[i] < q.batches[j] })
+
+	return q, nil
+}
+
+// path returns the file path of the batch.
+func (q *queue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, batchExt))
+}
+
+// push stores the batch and returns the number of the oldest batches dropped to fit it.
+func (q *queue) push(data []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seq := q.nextSeq
+	tmp := q.path(seq) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, q.path(seq)); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	q.nextSeq++
+	q.batches = append(q.batches, seq)
+
+	dropped := 0
+	for len(q.batches) > q.maxBatches {
+		os.Remove(q.path(q.batches[0]))
+		q.batches = q.batches[1:]
+		dropped++
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return dropped, nil
+}
+
+// peek returns the oldest batch, ok is false if the queue is empty.
+func (q *queue) peek() (seq uint64, data []byte, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.batches) == 0 {
+		return 0, nil, false, nil
+	}
+	seq = q.batches[0]
+	data, err = os.ReadFile(q.path(seq))
+	return seq, data, true, err
+}
+
+// remove deletes the batch, if it is still queued.
+func (q *queue) remove(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, s := range q.batches {
+		if s == seq {
+			os.Remove(q.path(seq))
+			q.batches = append(q.batches[:i], q.batches[i+1:]...)
+			return
+		}
+	}
+}
+
+// len returns the number of queued batches.
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.batches)
+}
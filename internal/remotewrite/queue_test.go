@@ -0,0 +1,83 @@
+package remotewrite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := openQueue(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range []string{"first", "second"} {
+		if _, err := q.push([]byte(batch)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a batch being written when the process stopped
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000009"+batchExt+".tmp"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = openQueue(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.len() != 2 {
+		t.Fatalf("expected 2 batches after reopening, got %d", q.len())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000009"+batchExt+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial batch to be removed, got %v", err)
+	}
+
+	// new batches are queued after the restored ones
+	if _, err := q.push([]byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"first", "second", "third"} {
+		seq, data, ok, err := q.peek()
+		if err != nil || !ok {
+			t.Fatalf("peek: ok=%v, err=%v", ok, err)
+		}
+		if string(data) != want {
+			t.Errorf("got batch %q, want %q", data, want)
+		}
+		q.remove(seq)
+	}
+	if _, _, ok, _ := q.peek(); ok {
+		t.Error("expected the queue to be empty")
+	}
+}
+
+func TestQueueDropsOldest(t *testing.T) {
+	q, err := openQueue(t.TempDir(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, batch := range []string{"first", "second", "third", "fourth"} {
+		dropped, err := q.push([]byte(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if i >= 2 {
+			want = 1
+		}
+		if dropped != want {
+			t.Errorf("push %q: dropped %d batches, want %d", batch, dropped, want)
+		}
+	}
+
+	if q.len() != 2 {
+		t.Fatalf("expected 2 batches, got %d", q.len())
+	}
+	_, data, _, _ := q.peek()
+	if string(data) != "third" {
+		t.Errorf("expected the oldest kept batch to be %q, got %q", "third", data)
+	}
+}
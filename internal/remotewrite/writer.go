@@ -0,0 +1,177 @@
+// Package remotewrite pushes MP measurements with their original timestamps
+// to a Prometheus remote write endpoint (Prometheus, Mimir, VictoriaMetrics, etc.).
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/exporter"
+	"apatit/internal/utils"
+	"apatit/internal/version"
+)
+
+const (
+	minRetryBackoff = 1 * time.Second
+	maxRetryBackoff = 1 * time.Minute
+)
+
+// Config is the remote write configuration.
+type Config struct {
+	// URL is the remote write endpoint
+	URL string
+	// QueueDir is a directory of the on-disk queue of batches waiting to be sent
+	QueueDir string
+	// QueueSize is the maximum number of queued batches, the oldest ones are dropped once it is exceeded
+	QueueSize int
+	// Timeout is a timeout of a single remote write request
+	Timeout time.Duration
+}
+
+// Writer queues MP samples and sends them to the remote write endpoint.
+type Writer struct {
+	url        string
+	httpClient *http.Client
+	queue      *queue
+	log        *logrus.Entry
+}
+
+// errPermanent is returned for requests which must not be retried.
+var errPermanent = errors.New("permanent error")
+
+// New creates a remote writer, batches left in the queue by the previous run will be sent too.
+func New(conf *Config) (*Writer, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid remote write URL '%s': must be an absolute http(s) URL", conf.URL)
+	}
+	if conf.QueueSize <= 0 {
+		return nil, fmt.Errorf("remote write queue size must be positive, got %d", conf.QueueSize)
+	}
+
+	q, err := openQueue(conf.QueueDir, conf.QueueSize)
+	if err != nil {
+		return nil, err
+	}
+	exporter.ERemoteWriteQueueBatches.Set(float64(q.len()))
+
+	return &Writer{
+		url:        conf.URL,
+		httpClient: &http.Client{Timeout: conf.Timeout},
+		queue:      q,
+		log:        logrus.WithField("component", "remote_write"),
+	}, nil
+}
+
+// Push encodes samples into a batch and puts it into the queue.
+func (w *Writer) Push(samples []*exporter.Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	dropped, err := w.queue.push(encodeWriteRequest(buildTimeSeries(samples)))
+	if err != nil {
+		exporter.EErrorsTotal.WithLabelValues("remote_write", "queue", "", "").Inc()
+		return fmt.Errorf("failed to queue remote write batch: %w", err)
+	}
+	if dropped > 0 {
+		exporter.ERemoteWriteBatchesTotal.WithLabelValues("dropped").Add(float64(dropped))
+		w.log.Warnf("Remote write queue is full, %d oldest batches were dropped", dropped)
+	}
+	exporter.ERemoteWriteQueueBatches.Set(float64(w.queue.len()))
+
+	w.log.WithField("samples", len(samples)).Debug("Remote write batch queued")
+	return nil
+}
+
+// Run sends queued batches in order until ctx is done.
+// Failed requests are retried with exponential backoff, batches rejected by the endpoint are dropped.
+func (w *Writer) Run(ctx context.Context) {
+	backoff := minRetryBackoff
+
+	for {
+		seq, data, ok, err := w.queue.peek()
+		if err != nil {
+			exporter.EErrorsTotal.WithLabelValues("remote_write", "queue", "", "").Inc()
+			w.log.Errorf("Failed to read queued batch, dropping it: %v", err)
+			w.queue.remove(seq)
+			exporter.ERemoteWriteBatchesTotal.WithLabelValues("dropped").Inc()
+			continue
+		}
+
+		if !ok {
+			select {
+			case <-w.queue.notify:
+				continue
+			case <-ctx.Done():
+				w.log.Info("Stopping remote writer...")
+				return
+			}
+		}
+
+		err = w.send(ctx, data)
+		switch {
+		case err == nil:
+			w.queue.remove(seq)
+			exporter.ERemoteWriteBatchesTotal.WithLabelValues("sent").Inc()
+			backoff = minRetryBackoff
+		case errors.Is(err, errPermanent):
+			w.queue.remove(seq)
+			exporter.ERemoteWriteBatchesTotal.WithLabelValues("rejected").Inc()
+			exporter.EErrorsTotal.WithLabelValues("remote_write", "send", "", "").Inc()
+			w.log.Errorf("Remote write batch was rejected, dropping it: %v", err)
+		default:
+			if ctx.Err() != nil {
+				w.log.Info("Stopping remote writer...")
+				return
+			}
+			exporter.EErrorsTotal.WithLabelValues("remote_write", "send", "", "").Inc()
+			w.log.WithField("retry_in", backoff.String()).Warnf("Remote write request failed: %v", err)
+			if err := utils.Sleep(ctx, backoff); err != nil {
+				w.log.Info("Stopping remote writer...")
+				return
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+		}
+		exporter.ERemoteWriteQueueBatches.Set(float64(w.queue.len()))
+	}
+}
+
+// send sends the encoded write request.
+// 4xx responses (except 429) are returned as errPermanent, as retrying them doesn't help.
+func (w *Writer) send(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", version.Name, version.Version))
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"apatit/internal/exporter"
+)
+
+// TestWriterRetriesAndDrops checks that failed requests are retried and batches rejected with 4xx are dropped.
+func TestWriterRetriesAndDrops(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	// responses to the requests in order, 204 once they are over
+	statuses := []int{http.StatusServiceUnavailable, http.StatusNoContent, http.StatusBadRequest}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		status := http.StatusNoContent
+		if len(bodies) < len(statuses) {
+			status = statuses[len(bodies)]
+		}
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w, err := New(&Config{URL: srv.URL, QueueDir: t.TempDir(), QueueSize: 10, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Push([]*exporter.Sample{testSample("1", 1700000000, 0.2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Push([]*exporter.Sample{testSample("2", 1700000000, 0.5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for w.queue.len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue was not drained, %d batches left", w.queue.len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// the rejected batch must not be retried
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 3 {
+		t.Fatalf("expected 3 requests (failed, retried and rejected), got %d", len(bodies))
+	}
+	if string(bodies[0]) != string(bodies[1]) {
+		t.Error("expected the failed batch to be retried")
+	}
+	if string(bodies[1]) == string(bodies[2]) {
+		t.Error("expected the second batch to be sent after the retried one")
+	}
+	for i, body := range bodies {
+		req := decodeWriteRequest(t, body)
+		if len(req.Timeseries) != len(exporter.Measurements) {
+			t.Errorf("request %d: expected %d time series, got %d", i, len(exporter.Measurements), len(req.Timeseries))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/client"
+	"apatit/internal/config"
+	"apatit/internal/discovery"
+	"apatit/internal/exporter"
+)
+
+// RunDiscoveryScheduler starts a loop that periodically discovers account tasks
+// and adds or removes exporters, so tasks created or deleted in Ping-Admin appear or disappear at runtime.
+// It returns once ctx is done.
+func RunDiscoveryScheduler(ctx context.Context, apiClient *client.Client, registry *exporter.Registry, cfgs *config.Holder) {
+	discoveryLog := logrus.WithField("component", "discovery_scheduler")
+
+	runCycle := func() {
+		// the config may be replaced on reload, so the cycle uses the current one
+		cfg := cfgs.Get()
+
+		cycleCtx, cancel := context.WithTimeout(ctx, cfg.DiscoveryInterval)
+		defer cancel()
+
+		discoveryLog.Info("Starting new tasks discovery cycle...")
+
+		allTasks, err := apiClient.GetAllTasks(cycleCtx)
+		if err != nil {
+			exporter.EErrorsTotal.WithLabelValues("api_client", client.ErrorType(err), "", "").Inc()
+			discoveryLog.WithField("error", err).Error("Tasks discovery failed")
+			return
+		}
+
+		added, removed := registry.Sync(discovery.SelectTasks(allTasks, cfg), allTasks)
+		exporter.ELoopsTotal.WithLabelValues("discovery").Inc()
+		discoveryLog.WithFields(logrus.Fields{
+			"added":     added,
+			"removed":   removed,
+			"exporters": registry.Len(),
+		}).Info("Tasks discovery finished")
+	}
+
+	// the interval is not reloadable
+	ticker := time.NewTicker(cfgs.Get().DiscoveryInterval)
+	defer ticker.Stop()
+
+	// the first discovery is done at startup, so the loop starts with ticker
+	for {
+		select {
+		case <-ticker.C:
+			runCycle()
+		case <-ctx.Done():
+			logrus.Infof("Stopping discovery scheduler...")
+			return
+		}
+	}
+}
@@ -1,73 +1,156 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+
+	"apatit/internal/cache"
+	"apatit/internal/client"
 	"apatit/internal/config"
 	"apatit/internal/exporter"
+	"apatit/internal/health"
+	"apatit/internal/sink"
+	"apatit/internal/state"
 	"apatit/internal/utils"
 )
 
-// runMetricsScheduler starts a loop that periodically updates metrics and clears old ones.
-func RunMetricsScheduler(exporters []*exporter.Exporter, cfg *config.Config, stop <-chan struct{}) {
-	var lastRunMPSeries = make(map[string]prometheus.Labels)
-
+// RunMetricsScheduler starts a loop that periodically refreshes exporters metrics.
+// Monitoring points info is requested once per cycle and shared by all exporters.
+// New MP samples are pushed to all sinks, data of complete cycles is saved to the state store (nil if disabled).
+// Cycles and task refreshes are reported to the health tracker.
+// Cycles are not limited by the refresh interval, as with many tasks the request pauses alone may exceed it:
+// a cycle is aborted on shutdown only, and the ticks it overruns are skipped.
+// It returns once ctx is done and the current cycle has been aborted.
+func RunMetricsScheduler(ctx context.Context, apiClient *client.Client, registry *exporter.Registry, cfgs *config.Holder,
+	sinks []sink.Sink, store *state.Store, tracker *health.Tracker) {
 	runCycle := func() {
-		currentRunMPSeries := make(map[string]prometheus.Labels)
-		var mu sync.Mutex
+		// the config may be replaced on reload, so the cycle uses the current one
+		cfg := cfgs.Get()
+
 		var wg sync.WaitGroup
 
 		metricsLog := logrus.WithField("component", "scheduler")
 		cycleStartTime := time.Now()
 		metricsLog.Info("Starting new metrics refresh cycle...")
+		tracker.CycleStarted(health.SchedulerMetrics, cycleStartTime.Add(cfg.RefreshInterval))
 		exporter.ERefreshIntervalSeconds.Set(cfg.RefreshInterval.Seconds())
 		exporter.EMaxAllowedStalenessSteps.Set(float64(cfg.MaxAllowedStalenessSteps))
 
-		wg.Add(len(exporters))
+		// get all available monitoring points once for the whole cycle
+		mps, err := apiClient.GetMPs(ctx)
+		tracker.ObserveAPI(err)
+		if err != nil {
+			exporter.EErrorsTotal.WithLabelValues("api_client", client.ErrorType(err), "", "").Inc()
+			metricsLog.WithField("error", err).Error("Failed to get monitoring points info, skipping cycle")
+			// the last MP metrics are not kept silently while the API is unavailable,
+			// they are marked using monitoring points info of the previous cycle,
+			// an interrupted cycle keeps the snapshots as is
+			cachedMPs, _ := cache.Data.MPs()
+			for _, e := range registry.Exporters() {
+				switch {
+				case errors.Is(err, client.ErrCircuitOpen):
+					e.MarkUpstreamUnavailable(cachedMPs)
+				case ctx.Err() == nil:
+					e.MarkStale(cachedMPs, cycleStartTime)
+				}
+			}
+			tracker.ObserveCycle(health.SchedulerMetrics, fmt.Errorf("failed to get monitoring points info: %w", err))
+			return
+		}
+		cache.Data.SetMPs(mps)
+
+		exporters := registry.Exporters()
+		var failed atomic.Int32
+
 		for _, exp := range exporters {
 
-			utils.RandomizedPause(cfg.RequestDelay)
+			if err := utils.RandomizedPause(ctx, cfg.RequestDelay); err != nil {
+				break
+			}
 
+			wg.Add(1)
 			go func(e *exporter.Exporter) {
 				defer wg.Done()
 
-				processedLabels, err := e.RefreshMetrics()
+				err := e.RefreshMetrics(ctx, mps)
+				tracker.ObserveTask(health.SchedulerMetrics, e.Config().TaskID, err)
 				if err != nil {
+					failed.Add(1)
 					metricsLog.WithFields(logrus.Fields{
-						"task_id": e.Config.TaskID,
+						"task_id": e.Config().TaskID,
 						"error":   err,
 					}).Error("Exporter refresh failed")
 					return
 				}
 
-				mu.Lock()
-				for _, labels := range processedLabels {
-					seriesKey := fmt.Sprintf("%s:%s", labels["task_id"], labels["mp_id"])
-					currentRunMPSeries[seriesKey] = labels
+				samples := e.NewSamples()
+				outages := e.NewOutages()
+				for _, s := range sinks {
+					if err := s.Push(samples); err != nil {
+						metricsLog.WithFields(logrus.Fields{
+							"task_id": e.Config().TaskID,
+							"error":   err,
+						}).Error("Failed to push new samples")
+					}
+					if outageSink, ok := s.(sink.OutageSink); ok && len(outages) > 0 {
+						if err := outageSink.PushOutages(outages); err != nil {
+							metricsLog.WithFields(logrus.Fields{
+								"task_id": e.Config().TaskID,
+								"error":   err,
+							}).Error("Failed to push MP outages")
+						}
+					}
 				}
-				mu.Unlock()
 			}(exp)
 		}
 
 		wg.Wait()
-		metricsLog.Infof("All exporters finished refresh cycle in %s.", time.Since(cycleStartTime))
 
-		// cleaning up absent metrics: comparing series from the previous run with the current ones
-		for seriesKey, labels := range lastRunMPSeries {
-			if _, exists := currentRunMPSeries[seriesKey]; !exists {
-				metricsLog.WithField("series", seriesKey).Info("Deleting stale series")
-				exporter.DeleteSeries(labels)
+		if err := ctx.Err(); err != nil {
+			metricsLog.WithField("error", err).Warn("Metrics refresh cycle was interrupted.")
+			tracker.ObserveCycle(health.SchedulerMetrics, fmt.Errorf("cycle was interrupted: %w", err))
+			return
+		}
+
+		// statuses of removed tasks aren't needed anymore
+		taskIDs := make([]int, 0, len(exporters))
+		for _, e := range exporters {
+			taskIDs = append(taskIDs, e.Config().TaskID)
+		}
+		tracker.Forget(taskIDs)
+		if n := int(failed.Load()); n > 0 && n == len(exporters) {
+			tracker.ObserveCycle(health.SchedulerMetrics, fmt.Errorf("all %d task refreshes failed", n))
+		} else {
+			tracker.ObserveCycle(health.SchedulerMetrics, nil)
+		}
+		metricsLog.Infof("All exporters finished refresh cycle in %s. Waiting for the next cycle.", time.Since(cycleStartTime))
+
+		if store != nil {
+			// entries of removed tasks are dropped, as only the registered exporters are saved
+			err := store.Update(func(st *state.State) {
+				st.MPs = mps
+				st.Entries = make(map[int][]*client.MonitoringPointEntry)
+				for _, e := range registry.Exporters() {
+					if entries := e.Entries(); entries != nil {
+						st.Entries[e.Config().TaskID] = entries
+					}
+				}
+			})
+			if err != nil {
+				exporter.EErrorsTotal.WithLabelValues("state", "save", "", "").Inc()
+				metricsLog.WithField("error", err).Error("Failed to save state")
 			}
 		}
-		lastRunMPSeries = currentRunMPSeries
-		metricsLog.Info("Metrics cleanup finished. Waiting for the next cycle.")
 	}
 
-	ticker := time.NewTicker(cfg.RefreshInterval)
+	// the interval is not reloadable
+	ticker := time.NewTicker(cfgs.Get().RefreshInterval)
 	defer ticker.Stop()
 
 	runCycle() // first run starts without ticker
@@ -76,7 +159,8 @@ func RunMetricsScheduler(exporters []*exporter.Exporter, cfg *config.Config, sto
 		select {
 		case <-ticker.C:
 			runCycle()
-		case <-stop:
+			skipOverrunTick(ticker, logrus.WithField("component", "scheduler"))
+		case <-ctx.Done():
 			logrus.Infof("Stopping metrics scheduler...")
 			return
 		}
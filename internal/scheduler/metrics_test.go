@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"apatit/internal/client"
+	"apatit/internal/config"
+	"apatit/internal/exporter"
+	"apatit/internal/health"
+	"apatit/internal/testing/fakeapi"
+)
+
+func testScenario() *fakeapi.Scenario {
+	return &fakeapi.Scenario{
+		DataStep: fakeapi.Duration(3 * time.Minute),
+		MPs: []*fakeapi.MP{
+			{ID: "1", Name: "Moscow", IP: "192.0.2.1"},
+			{ID: "2", Name: "Frankfurt", IP: "192.0.2.2", Down: true},
+		},
+		Tasks: []*fakeapi.Task{{
+			ID:      1001,
+			Name:    "Main site",
+			Address: "https://example.com",
+			Type:    "http",
+			Enabled: true,
+			Up:      true,
+			Period:  3,
+			Uptime:  0.99,
+			Graph: fakeapi.Graph{
+				Connect: 0.012, DNS: 0.004, Server: 0.145, Total: 0.231, Speed: 524288,
+				Age: fakeapi.Duration(4 * time.Minute),
+			},
+		}},
+	}
+}
+
+// TestMetricsSchedulerEndToEnd runs a metrics cycle against the fake API and scrapes the exported metrics.
+func TestMetricsSchedulerEndToEnd(t *testing.T) {
+	fake := fakeapi.New(testScenario())
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	apiClient, err := client.New(&client.Config{
+		APIKey:               "test",
+		Endpoint:             srv.URL,
+		RequestRetries:       1,
+		MaxRequestsPerSecond: 100,
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("failed to create API client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tasks, err := apiClient.GetAllTasks(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tasks: %v", err)
+	}
+	registry := exporter.NewRegistry(apiClient, func(taskID int) *exporter.Config {
+		return &exporter.Config{
+			TaskID:                   taskID,
+			EngMPNames:               true,
+			ApiUpdateDelay:           4 * time.Minute,
+			ApiDataTimeStep:          3 * time.Minute,
+			MaxAllowedStalenessSteps: 3,
+		}
+	})
+	if added, _ := registry.Sync([]int{1001}, tasks); len(added) != 1 {
+		t.Fatalf("expected 1 exporter, got %d", len(added))
+	}
+
+	cfgs := config.NewHolder(&config.Config{
+		RefreshInterval:          time.Hour,
+		RequestDelay:             time.Millisecond,
+		MaxAllowedStalenessSteps: 3,
+	})
+	tracker := health.NewTracker()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunMetricsScheduler(ctx, apiClient, registry, cfgs, nil, nil, tracker)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for tracker.Cycle(health.SchedulerMetrics).LastRun.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("metrics cycle was not finished in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := tracker.Cycle(health.SchedulerMetrics); status.LastError != "" {
+		t.Fatalf("metrics cycle failed: %s", status.LastError)
+	}
+
+	promRegistry := prometheus.NewRegistry()
+	promRegistry.MustRegister(registry, exporter.NewCollector(registry))
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	metrics := string(body)
+
+	for _, want := range []string{
+		`apatit_mp_status{`,
+		`apatit_mp_total_duration_seconds{`,
+		`mp_id="1"`,
+		`task_id="1001"`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("scraped metrics don't contain %s:\n%s", want, metrics)
+		}
+	}
+	if n := fake.Requests("task_graph_stat"); n != 1 {
+		t.Errorf("expected 1 task_graph_stat request, got %d", n)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metrics scheduler didn't stop after cancellation")
+	}
+}
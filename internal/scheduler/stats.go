@@ -1,7 +1,9 @@
 package scheduler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,54 +13,82 @@ import (
 	"apatit/internal/client"
 	"apatit/internal/config"
 	"apatit/internal/exporter"
+	"apatit/internal/health"
+	"apatit/internal/state"
 	"apatit/internal/utils"
 )
 
-// runStatsScheduler starts a loop that periodically updates task stats and publish them
-func RunStatsScheduler(exporters []*exporter.Exporter, cfg *config.Config, stop <-chan struct{}) {
+// RunStatsScheduler starts a loop that periodically updates task stats and publish them.
+// Data of complete cycles is saved to the state store (nil if disabled).
+// Cycles and task refreshes are reported to the health tracker.
+// Cycles are not limited by the refresh interval, as with many tasks the request pauses alone may exceed it:
+// a cycle is aborted on shutdown only, and the ticks it overruns are skipped.
+// It returns once ctx is done and the current cycle has been aborted.
+func RunStatsScheduler(ctx context.Context, apiClient *client.Client, registry *exporter.Registry, cfgs *config.Holder,
+	store *state.Store, tracker *health.Tracker) {
 	statsLog := logrus.WithField("component", "stats_scheduler")
 
 	runCycle := func() {
+		// the config may be replaced on reload, so the cycle uses the current one
+		cfg := cfgs.Get()
+
 		cycleStartTime := time.Now()
 		statsLog.Info("Starting new stats refresh cycle...")
+		tracker.CycleStarted(health.SchedulerStats, cycleStartTime.Add(cfg.RefreshInterval))
 
 		var wg sync.WaitGroup
 		var mu sync.Mutex
 
+		// perform request about all tasks only once
+		statsLog.Info("Updating all tasks info...")
+		allTasksInfo, err := apiClient.GetAllTasks(ctx)
+		tracker.ObserveAPI(err)
+		if err != nil {
+			exporter.EErrorsTotal.WithLabelValues("api_client", client.ErrorType(err), "", "").Inc()
+			statsLog.WithField("error", err).Error("All Tasks info refresh failed")
+		} else {
+			allTasksJSON, err := json.Marshal(allTasksInfo)
+			if err != nil {
+				statsLog.Errorf("Failed to marshal tasks info to JSON: %v", err)
+			} else {
+				cache.AllTasksInfoCache.UpdateCache(allTasksJSON)
+			}
+			cache.Data.SetTasks(allTasksInfo)
+		}
+
+		exporters := registry.Exporters()
+
+		// update task metrics from the same tasks info
+		if allTasksInfo != nil {
+			tasksByID := make(map[int]*client.TaskInfo, len(allTasksInfo))
+			for _, task := range allTasksInfo {
+				tasksByID[task.ID] = task
+			}
+			for _, e := range exporters {
+				if task, ok := tasksByID[e.Config().TaskID]; ok {
+					e.UpdateTaskMetrics(task)
+				}
+			}
+		}
+
 		// All Task Stats will be here
 		allStats := make([]*client.TaskStatEntry, 0, len(exporters))
 
-		wg.Add(len(exporters))
 		for _, exp := range exporters {
 
-			utils.RandomizedPause(cfg.RequestDelay)
+			if err := utils.RandomizedPause(ctx, cfg.RequestDelay); err != nil {
+				break
+			}
 
+			wg.Add(1)
 			go func(e *exporter.Exporter) {
 				defer wg.Done()
 
-				// perform request about all tasks only once
-				if e == exporters[0] {
-					allTasksInfo, err := e.UpdateAllTasksInfo()
-					if err != nil {
-						statsLog.WithFields(logrus.Fields{
-							"task_id": e.Config.TaskID,
-							"error":   err,
-						}).Error("All Tasks info refresh failed")
-						return
-					}
-
-					cache.AllTasksInfoCache, err = json.Marshal(allTasksInfo)
-					if err != nil {
-						statsLog.Errorf("Failed to marshal tasks info to JSON: %v", err)
-						return
-					}
-
-				}
-
-				stats, err := e.UpdateTaskStats()
+				stats, err := e.UpdateTaskStats(ctx)
+				tracker.ObserveTask(health.SchedulerStats, e.Config().TaskID, err)
 				if err != nil {
 					statsLog.WithFields(logrus.Fields{
-						"task_id": e.Config.TaskID,
+						"task_id": e.Config().TaskID,
 						"error":   err,
 					}).Error("Stats refresh failed")
 					return
@@ -72,8 +102,22 @@ func RunStatsScheduler(exporters []*exporter.Exporter, cfg *config.Config, stop
 		}
 
 		wg.Wait()
+
+		// an interrupted cycle has partial stats only, so the cache keeps the previous ones
+		if err := ctx.Err(); err != nil {
+			statsLog.WithField("error", err).Warn("Stats refresh cycle was interrupted, keeping cached stats.")
+			tracker.ObserveCycle(health.SchedulerStats, fmt.Errorf("cycle was interrupted: %w", err))
+			return
+		}
 		statsLog.Infof("All exporters finished stats refresh cycle in %s.", time.Since(cycleStartTime))
 
+		// the last good stats are kept if every refresh failed
+		if len(allStats) == 0 && len(exporters) > 0 {
+			statsLog.Warn("No task stats were refreshed, keeping cached stats.")
+			tracker.ObserveCycle(health.SchedulerStats, fmt.Errorf("all %d task refreshes failed", len(exporters)))
+			return
+		}
+
 		//// transpose stats
 		//transposedStats := make([]*client.TransposedTaskStatEntry, 0, len(allStats))
 		//for _, originalStat := range allStats {
@@ -83,15 +127,32 @@ func RunStatsScheduler(exporters []*exporter.Exporter, cfg *config.Config, stop
 		finalJSON, err := json.Marshal(allStats)
 		if err != nil {
 			statsLog.Errorf("Failed to marshal aggregated transposed stats to JSON: %v", err)
+			tracker.ObserveCycle(health.SchedulerStats, fmt.Errorf("failed to marshal stats: %w", err))
 			return
 		}
 
 		// safely update cache
 		cache.TaskDataCache.UpdateCache(finalJSON)
+		cache.Data.SetTaskStats(allStats)
 		statsLog.Info("Successfully updated tasks JSON cache.")
+		tracker.ObserveCycle(health.SchedulerStats, nil)
+
+		if store != nil {
+			err := store.Update(func(st *state.State) {
+				if allTasksInfo != nil {
+					st.Tasks = allTasksInfo
+				}
+				st.TaskData = finalJSON
+			})
+			if err != nil {
+				exporter.EErrorsTotal.WithLabelValues("state", "save", "", "").Inc()
+				statsLog.WithField("error", err).Error("Failed to save state")
+			}
+		}
 	}
 
-	ticker := time.NewTicker(cfg.RefreshInterval)
+	// the interval is not reloadable
+	ticker := time.NewTicker(cfgs.Get().RefreshInterval)
 	defer ticker.Stop()
 
 	runCycle() // first run starts without ticker
@@ -100,7 +161,8 @@ func RunStatsScheduler(exporters []*exporter.Exporter, cfg *config.Config, stop
 		select {
 		case <-ticker.C:
 			runCycle()
-		case <-stop:
+			skipOverrunTick(ticker, statsLog)
+		case <-ctx.Done():
 			logrus.Infof("Stopping stats scheduler...")
 			return
 		}
@@ -0,0 +1,17 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// skipOverrunTick drops the tick which arrived while the cycle was running,
+// so a cycle longer than the interval is not immediately followed by the next one.
+func skipOverrunTick(ticker *time.Ticker, log *logrus.Entry) {
+	select {
+	case <-ticker.C:
+		log.Warn("Refresh cycle took longer than the refresh interval, skipping the missed tick.")
+	default:
+	}
+}
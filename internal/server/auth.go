@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authCacheSize limits the number of cached successful basic auth checks.
+const authCacheSize = 100
+
+// dummyHash is compared for unknown users, so they can't be told apart by response time.
+var dummyHash = []byte("$2a$10$45HHdxNzmwr01hbcCQALhu9VNBNoE5UIGEDlTa/aaVkJPFuQzj.K2")
+
+// authenticator checks basic auth and bearer token credentials of requests.
+type authenticator struct {
+	// cache of successful bcrypt checks, as bcrypt is slow by design
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]struct{}
+}
+
+// newAuthenticator creates an authenticator with empty cache.
+func newAuthenticator() *authenticator {
+	return &authenticator{cache: make(map[[sha256.Size]byte]struct{})}
+}
+
+// credentials returns basic auth users and bearer tokens required for the path.
+// The group with the longest matching path prefix is used, the global credentials otherwise.
+func credentials(conf *WebConfig, path string) (users map[string]string, tokens []string) {
+	users, tokens = conf.BasicAuthUsers, conf.BearerTokens
+
+	matched := -1
+	for _, group := range conf.EndpointGroups {
+		for _, prefix := range group.Paths {
+			if strings.HasPrefix(path, prefix) && len(prefix) > matched {
+				matched = len(prefix)
+				users, tokens = group.BasicAuthUsers, group.BearerTokens
+			}
+		}
+	}
+	return users, tokens
+}
+
+// authorized returns true if the request has valid credentials or no credentials are required.
+func (a *authenticator) authorized(r *http.Request, users map[string]string, tokens []string) bool {
+	if len(users) == 0 && len(tokens) == 0 {
+		return true
+	}
+
+	if len(tokens) > 0 {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			for _, t := range tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if len(users) > 0 {
+		if user, password, ok := r.BasicAuth(); ok {
+			return a.checkPassword(user, password, users)
+		}
+	}
+	return false
+}
+
+// checkPassword compares the password with the bcrypt hash of the user.
+func (a *authenticator) checkPassword(user, password string, users map[string]string) bool {
+	hash, known := users[user]
+	if !known {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + password))
+	a.mu.Lock()
+	_, cached := a.cache[key]
+	a.mu.Unlock()
+	if cached {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+
+	a.mu.Lock()
+	if len(a.cache) >= authCacheSize {
+		clear(a.cache)
+	}
+	a.cache[key] = struct{}{}
+	a.mu.Unlock()
+	return true
+}
+
+// webHandler applies the current web config to requests: adds response headers and checks credentials.
+func webHandler(loader *webConfigLoader, next http.Handler) http.Handler {
+	auth := newAuthenticator()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf := loader.get().conf
+
+		for name, value := range conf.HTTPServerConfig.Headers {
+			w.Header().Set(name, value)
+		}
+
+		users, tokens := credentials(conf, r.URL.Path)
+		if !auth.authorized(r, users, tokens) {
+			if len(users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="APATIT", charset="UTF-8"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="APATIT"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
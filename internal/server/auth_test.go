@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCredentials(t *testing.T) {
+	conf := &WebConfig{
+		BasicAuthUsers: map[string]string{"global": "hash"},
+		BearerTokens:   []string{"global-token"},
+		EndpointGroups: []*EndpointGroup{
+			{Paths: []string{"/healthz", "/readyz"}},
+			{Paths: []string{"/api/"}, BearerTokens: []string{"api-token"}},
+			{Paths: []string{"/api/v1/history"}, BasicAuthUsers: map[string]string{"history": "hash"}},
+		},
+	}
+
+	tests := []struct {
+		path       string
+		wantUsers  []string
+		wantTokens []string
+	}{
+		{path: "/metrics", wantUsers: []string{"global"}, wantTokens: []string{"global-token"}},
+		{path: "/healthz"},
+		{path: "/readyz"},
+		{path: "/api/v1/tasks", wantTokens: []string{"api-token"}},
+		// the longest matching prefix wins regardless of the group order
+		{path: "/api/v1/history", wantUsers: []string{"history"}},
+		// prefixes are matched as is
+		{path: "/api", wantUsers: []string{"global"}, wantTokens: []string{"global-token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			users, tokens := credentials(conf, tt.path)
+			if len(users) != len(tt.wantUsers) {
+				t.Errorf("got users %v, want %v", users, tt.wantUsers)
+			}
+			for _, user := range tt.wantUsers {
+				if _, ok := users[user]; !ok {
+					t.Errorf("got users %v, want %v", users, tt.wantUsers)
+				}
+			}
+			if len(tokens) != len(tt.wantTokens) || len(tokens) > 0 && tokens[0] != tt.wantTokens[0] {
+				t.Errorf("got tokens %v, want %v", tokens, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]string{"admin": string(hash)}
+	tokens := []string{"token-1", "token-2"}
+
+	tests := []struct {
+		name   string
+		users  map[string]string
+		tokens []string
+		auth   func(r *http.Request)
+		want   bool
+	}{
+		{name: "no credentials required", want: true},
+		{name: "missing credentials", users: users, tokens: tokens},
+		{name: "valid password", users: users, auth: func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, want: true},
+		{name: "wrong password", users: users, auth: func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }},
+		{name: "unknown user", users: users, auth: func(r *http.Request) { r.SetBasicAuth("guest", "secret") }},
+		{name: "valid token", tokens: tokens, auth: bearer("token-2"), want: true},
+		{name: "wrong token", tokens: tokens, auth: bearer("token-3")},
+		{name: "token without required tokens", users: users, auth: bearer("token-1")},
+		{name: "password without required users", tokens: tokens, auth: func(r *http.Request) { r.SetBasicAuth("admin", "secret") }},
+		{name: "wrong token doesn't fall back to password", users: users, tokens: tokens, auth: bearer("token-3")},
+		{name: "password with users and tokens required", users: users, tokens: tokens, auth: func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, want: true},
+	}
+
+	a := newAuthenticator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the second check hits the cache of successful checks
+			for range 2 {
+				r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+				if tt.auth != nil {
+					tt.auth(r)
+				}
+				if got := a.authorized(r, tt.users, tt.tokens); got != tt.want {
+					t.Errorf("got authorized %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// bearer sets the bearer token of the request.
+func bearer(token string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
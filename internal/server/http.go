@@ -1,7 +1,11 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
@@ -9,16 +13,41 @@ import (
 	"apatit/internal/cache"
 )
 
-// startServer runs HTTP-server.
-func StartServer(listenAddress string) {
+// shutdownTimeout is the time given to in-flight HTTP requests to finish on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Server is an HTTP server with metrics, stats and admin endpoints.
+type Server struct {
+	listenAddress string
+	mux           *http.ServeMux
+	// webConfig is nil if the web config file is not set
+	webConfig *webConfigLoader
+}
+
+// New creates HTTP server with the default endpoints.
+// TLS and authentication are configured by the web config file, it is disabled if webConfigFile is empty.
+func New(listenAddress, webConfigFile string) (*Server, error) {
+	s := &Server{
+		listenAddress: listenAddress,
+		mux:           http.NewServeMux(),
+	}
+
+	if webConfigFile != "" {
+		loader, err := newWebConfigLoader(webConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		s.webConfig = loader
+	}
+
 	// JSON stats endpoint
-	http.HandleFunc("/stats", statsHandler)
+	s.mux.HandleFunc("/stats", statsHandler)
 
 	// Metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	s.mux.Handle("/metrics", promhttp.Handler())
 
 	// Root endpoint
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/" {
 			http.NotFound(w, r)
 			return
@@ -31,36 +60,112 @@ func StartServer(listenAddress string) {
 <p><a href='/metrics'>Metrics</a></p>
 <p><a href='/stats?type=task'>Tasks JSON</a></p>
 <p><a href='/stats?type=all'>All Tasks Info JSON</a></p>
+<p><a href='/status'>Status JSON</a></p>
+<p><a href='/api/v1/openapi.json'>REST API (OpenAPI)</a></p>
 </body></html>`))
 	})
 
-	logrus.WithField("address", listenAddress).Info("Starting HTTP server")
-	if err := http.ListenAndServe(listenAddress, nil); err != nil {
-		logrus.Fatalf("Failed to start HTTP server: %v", err)
+	return s, nil
+}
+
+// Handle registers an additional endpoint.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run runs HTTP-server until ctx is done, then shuts it down gracefully.
+// TLS certificates and credentials are reloaded once their files are changed.
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{Addr: s.listenAddress, Handler: s.mux}
+
+	useTLS := false
+	if s.webConfig != nil {
+		srv.Handler = webHandler(s.webConfig, s.mux)
+		if s.webConfig.get().tls != nil {
+			useTLS = true
+			srv.TLSConfig = &tls.Config{
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+					return s.webConfig.get().tls, nil
+				},
+			}
+		}
 	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("Failed to shutdown HTTP server gracefully: %v", err)
+		}
+	}()
+
+	logrus.WithFields(logrus.Fields{
+		"address": s.listenAddress,
+		"tls":     useTLS,
+	}).Info("Starting HTTP server")
+
+	var err error
+	if useTLS {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ReloadHandler handles 'POST /-/reload' requests by calling reload.
+func ReloadHandler(reload func(ctx context.Context) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := reload(r.Context()); err != nil {
+			http.Error(w, "Failed to reload config: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("OK\n"))
+	})
 }
 
 // statsHandler handle /stats request with 'type' parameter.
+// It is a compatibility shim, /api/v1 resources should be used instead.
 func statsHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 	dataType := queryParams.Get("type")
 
+	var entry *cache.Entry
 	var jsonData []byte
 
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</api/v1/tasks>; rel="successor-version"`)
+
 	switch dataType {
 	case "task":
-		jsonData = cache.TaskDataCache.GetFromCache()
+		entry = cache.TaskDataCache.Get()
 	case "all":
-		jsonData = cache.AllTasksInfoCache
+		entry = cache.AllTasksInfoCache.Get()
 	default:
+		w.WriteHeader(http.StatusBadRequest)
 		jsonData = []byte(`{"error":"Invalid or missing 'type' parameter. Use 'type=task' or 'type=all'."}`)
 	}
 
+	if entry != nil {
+		cache.Serve(w, r, entry)
+		return
+	}
+
 	if len(jsonData) == 0 {
 		jsonData = []byte("[]")
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_, err := w.Write(jsonData)
 	if err != nil {
 		logrus.Errorf("Failed to write response: %v", err)
@@ -0,0 +1,369 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.yaml.in/yaml/v2"
+)
+
+// webConfigCheckInterval limits how often the web config and certificate files are checked for changes.
+const webConfigCheckInterval = time.Second
+
+// WebConfig is a web configuration file compatible with Prometheus exporter-toolkit,
+// extended with bearer tokens and per endpoint group authentication.
+type WebConfig struct {
+	TLSServerConfig  TLSServerConfig  `yaml:"tls_server_config"`
+	HTTPServerConfig HTTPServerConfig `yaml:"http_server_config"`
+	// BasicAuthUsers are usernames with bcrypt hashed passwords
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	// BearerTokens are accepted in 'Authorization: Bearer <token>' header
+	BearerTokens []string `yaml:"bearer_tokens"`
+	// EndpointGroups override the global authentication for endpoints with path prefixes
+	EndpointGroups []*EndpointGroup `yaml:"endpoint_groups"`
+}
+
+// TLSServerConfig is the TLS configuration of the server.
+type TLSServerConfig struct {
+	CertFile          string   `yaml:"cert_file"`
+	KeyFile           string   `yaml:"key_file"`
+	ClientAuthType    string   `yaml:"client_auth_type"`
+	ClientCAFile      string   `yaml:"client_ca_file"`
+	ClientAllowedSANs []string `yaml:"client_allowed_sans"`
+	MinVersion        string   `yaml:"min_version"`
+	MaxVersion        string   `yaml:"max_version"`
+	CipherSuites      []string `yaml:"cipher_suites"`
+	CurvePreferences  []string `yaml:"curve_preferences"`
+	// PreferServerCipherSuites is accepted for compatibility, it is ignored by Go
+	PreferServerCipherSuites *bool `yaml:"prefer_server_cipher_suites"`
+}
+
+// HTTPServerConfig is the HTTP configuration of the server.
+type HTTPServerConfig struct {
+	// HTTP2 is enabled if nil
+	HTTP2 *bool `yaml:"http2"`
+	// Headers are added to every response
+	Headers map[string]string `yaml:"headers"`
+}
+
+// EndpointGroup is the authentication of endpoints with the path prefixes.
+// Endpoints of a group without users and tokens are served without authentication.
+type EndpointGroup struct {
+	Paths          []string          `yaml:"paths"`
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	BearerTokens   []string          `yaml:"bearer_tokens"`
+}
+
+// tlsEnabled returns true if TLS is configured, like exporter-toolkit does.
+func (c *TLSServerConfig) tlsEnabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientAuthType != "" || c.ClientCAFile != ""
+}
+
+// files returns the paths of the files referenced by the TLS configuration.
+func (c *TLSServerConfig) files() []string {
+	files := make([]string, 0, 3)
+	for _, path := range []string{c.CertFile, c.KeyFile, c.ClientCAFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// loadWebConfig reads the web config file, relative TLS file paths are resolved against its directory.
+func loadWebConfig(path string) (*WebConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web config file: %w", err)
+	}
+
+	conf := &WebConfig{}
+	if err := yaml.UnmarshalStrict(content, conf); err != nil {
+		return nil, fmt.Errorf("failed to parse web config file: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, file := range []*string{&conf.TLSServerConfig.CertFile, &conf.TLSServerConfig.KeyFile, &conf.TLSServerConfig.ClientCAFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(dir, *file)
+		}
+	}
+
+	for i, group := range conf.EndpointGroups {
+		if len(group.Paths) == 0 {
+			return nil, fmt.Errorf("endpoint group %d has no paths", i)
+		}
+		for _, p := range group.Paths {
+			if !strings.HasPrefix(p, "/") {
+				return nil, fmt.Errorf("endpoint group %d path %q must start with '/'", i, p)
+			}
+		}
+	}
+	return conf, nil
+}
+
+// buildTLSConfig creates the TLS configuration, certificates are read from disk.
+func buildTLSConfig(c *TLSServerConfig, http2 bool) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("both cert_file and key_file must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"http/1.1"},
+	}
+	if http2 {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	if c.MinVersion != "" {
+		if tlsConfig.MinVersion, err = parseTLSVersion(c.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if c.MaxVersion != "" {
+		if tlsConfig.MaxVersion, err = parseTLSVersion(c.MaxVersion); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range c.CipherSuites {
+		id, err := parseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+	for _, name := range c.CurvePreferences {
+		curve, err := parseCurve(name)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, curve)
+	}
+
+	switch c.ClientAuthType {
+	case "", "NoClientCert":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "RequestClientCert":
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	case "RequireAnyClientCert", "RequireClientCert":
+		tlsConfig.ClientAuth = tls.RequireAnyClientCert
+	case "VerifyClientCertIfGiven":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "RequireAndVerifyClientCert":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client_auth_type %q", c.ClientAuthType)
+	}
+
+	if c.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	} else if tlsConfig.ClientAuth == tls.VerifyClientCertIfGiven || tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_ca_file must be set for client_auth_type %q", c.ClientAuthType)
+	}
+
+	if len(c.ClientAllowedSANs) > 0 {
+		allowed := c.ClientAllowedSANs
+		tlsConfig.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			if len(chains) == 0 || len(chains[0]) == 0 {
+				return fmt.Errorf("client certificate is not verified")
+			}
+			leaf := chains[0][0]
+			sans := append(append([]string{}, leaf.DNSNames...), leaf.EmailAddresses...)
+			for _, ip := range leaf.IPAddresses {
+				sans = append(sans, ip.String())
+			}
+			for _, uri := range leaf.URIs {
+				sans = append(sans, uri.String())
+			}
+			for _, san := range sans {
+				if slices.Contains(allowed, san) {
+					return nil
+				}
+			}
+			return fmt.Errorf("client certificate SANs are not allowed")
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// parseTLSVersion parses exporter-toolkit TLS version names, e.g. TLS12.
+func parseTLSVersion(name string) (uint16, error) {
+	switch name {
+	case "TLS10":
+		return tls.VersionTLS10, nil
+	case "TLS11":
+		return tls.VersionTLS11, nil
+	case "TLS12":
+		return tls.VersionTLS12, nil
+	case "TLS13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", name)
+}
+
+// parseCipherSuite parses a cipher suite name, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func parseCipherSuite(name string) (uint16, error) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+// parseCurve parses exporter-toolkit curve names, e.g. CurveP256.
+func parseCurve(name string) (tls.CurveID, error) {
+	switch name {
+	case "CurveP256":
+		return tls.CurveP256, nil
+	case "CurveP384":
+		return tls.CurveP384, nil
+	case "CurveP521":
+		return tls.CurveP521, nil
+	case "X25519":
+		return tls.X25519, nil
+	}
+	return 0, fmt.Errorf("unknown curve %q", name)
+}
+
+// loadedWebConfig is the web configuration with TLS configuration built from it.
+type loadedWebConfig struct {
+	conf *WebConfig
+	// tls is nil if TLS is disabled
+	tls *tls.Config
+}
+
+// webConfigLoader keeps the web configuration up to date with the files on disk.
+// A broken configuration is logged and the previous one is kept.
+type webConfigLoader struct {
+	path string
+	log  *logrus.Entry
+
+	mu        sync.Mutex
+	current   *loadedWebConfig
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+// newWebConfigLoader loads the web config file, it fails if the configuration is invalid.
+func newWebConfigLoader(path string) (*webConfigLoader, error) {
+	l := &webConfigLoader{
+		path: path,
+		log:  logrus.WithField("component", "web_config"),
+	}
+	loaded, modTimes, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	l.current = loaded
+	l.modTimes = modTimes
+	l.checkedAt = time.Now()
+	return l, nil
+}
+
+// load reads the web config and TLS files.
+func (l *webConfigLoader) load() (*loadedWebConfig, map[string]time.Time, error) {
+	modTimes, err := fileModTimes(l.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conf, err := loadWebConfig(l.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	loaded := &loadedWebConfig{conf: conf}
+
+	if conf.TLSServerConfig.tlsEnabled() {
+		http2 := conf.HTTPServerConfig.HTTP2 == nil || *conf.HTTPServerConfig.HTTP2
+		if loaded.tls, err = buildTLSConfig(&conf.TLSServerConfig, http2); err != nil {
+			return nil, nil, fmt.Errorf("invalid TLS server config: %w", err)
+		}
+		tlsModTimes, err := fileModTimes(conf.TLSServerConfig.files()...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for path, modTime := range tlsModTimes {
+			modTimes[path] = modTime
+		}
+	}
+	return loaded, modTimes, nil
+}
+
+// get returns the current web configuration, reloading it if the files were changed.
+func (l *webConfigLoader) get() *loadedWebConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checkedAt) < webConfigCheckInterval {
+		return l.current
+	}
+	l.checkedAt = time.Now()
+
+	paths := make([]string, 0, len(l.modTimes))
+	for path := range l.modTimes {
+		paths = append(paths, path)
+	}
+	modTimes, err := fileModTimes(paths...)
+	if err == nil && maps.EqualFunc(modTimes, l.modTimes, time.Time.Equal) {
+		return l.current
+	}
+
+	loaded, modTimes, err := l.load()
+	if err != nil {
+		l.log.WithField("error", err).Error("Failed to reload web config, previous one is kept")
+		// the broken files are not reloaded again until they are changed
+		if modTimes, err := fileModTimes(paths...); err == nil {
+			l.modTimes = modTimes
+		}
+		return l.current
+	}
+	// TLS can't be enabled or disabled without restart
+	if (loaded.tls == nil) != (l.current.tls == nil) {
+		l.log.Error("TLS can't be enabled or disabled without restart, previous web config is kept")
+		l.modTimes = modTimes
+		return l.current
+	}
+
+	l.current = loaded
+	l.modTimes = modTimes
+	l.log.Info("Web config reloaded")
+	return l.current
+}
+
+// fileModTimes returns modification times of the files.
+func fileModTimes(paths ...string) (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes, nil
+}
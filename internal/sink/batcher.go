@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/exporter"
+	"apatit/internal/utils"
+)
+
+const (
+	minRetryBackoff = 1 * time.Second
+	maxRetryBackoff = 30 * time.Second
+	// maxBufferedBatches limits the buffer while the storage is unavailable
+	maxBufferedBatches = 100
+)
+
+// BatchConfig is the batching configuration of a sink.
+type BatchConfig struct {
+	// Size is the maximum number of samples in a batch
+	Size int
+	// FlushInterval is the maximum time a sample waits for its batch
+	FlushInterval time.Duration
+	// MaxRetries is the number of retries of a failed batch before it is dropped
+	MaxRetries int
+}
+
+// Batcher is a Sink which buffers samples in memory and writes them to the client in batches.
+// Failed batches are retried with exponential backoff. Write errors and dropped samples
+// are counted in EErrorsTotal with the sink name as the error module.
+type Batcher struct {
+	name   string
+	client Client
+	conf   *BatchConfig
+	log    *logrus.Entry
+
+	mu     sync.Mutex
+	buffer []*exporter.Sample
+	// full is signaled when the buffer has enough samples for a batch
+	full chan struct{}
+}
+
+// NewBatcher creates a batching sink writing to the client.
+func NewBatcher(name string, client Client, conf *BatchConfig) *Batcher {
+	return &Batcher{
+		name:   name,
+		client: client,
+		conf:   conf,
+		log:    logrus.WithFields(logrus.Fields{"component": "sink", "sink": name}),
+		buffer: make([]*exporter.Sample, 0),
+		full:   make(chan struct{}, 1),
+	}
+}
+
+// Push implements Sink. Once the buffer is full, the oldest samples are dropped.
+func (b *Batcher) Push(samples []*exporter.Sample) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buffer = append(b.buffer, samples...)
+	if limit := b.conf.Size * maxBufferedBatches; len(b.buffer) > limit {
+		dropped := len(b.buffer) - limit
+		b.buffer = b.buffer[dropped:]
+		exporter.EErrorsTotal.WithLabelValues(b.name, "drop", "", "").Inc()
+		b.log.Warnf("Sink buffer is full, %d oldest samples were dropped", dropped)
+	}
+
+	if len(b.buffer) >= b.conf.Size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run implements Sink.
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.conf.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.full:
+		case <-ctx.Done():
+			b.log.Info("Stopping sink...")
+			return
+		}
+
+		for batch := b.next(); len(batch) > 0; batch = b.next() {
+			if err := b.write(ctx, batch); err != nil {
+				if ctx.Err() != nil {
+					b.log.Info("Stopping sink...")
+					return
+				}
+				exporter.EErrorsTotal.WithLabelValues(b.name, "drop", "", "").Inc()
+				b.log.Errorf("Failed to write batch of %d samples, dropping it: %v", len(batch), err)
+			}
+		}
+	}
+}
+
+// next takes the next batch from the buffer.
+func (b *Batcher) next() []*exporter.Sample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := min(len(b.buffer), b.conf.Size)
+	batch := b.buffer[:n:n]
+	b.buffer = b.buffer[n:]
+	return batch
+}
+
+// write writes the batch, retrying failed attempts.
+func (b *Batcher) write(ctx context.Context, batch []*exporter.Sample) error {
+	backoff := minRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := b.client.Write(ctx, batch)
+		if err == nil {
+			b.log.WithField("samples", len(batch)).Debug("Batch written")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		exporter.EErrorsTotal.WithLabelValues(b.name, "write", "", "").Inc()
+		if attempt >= b.conf.MaxRetries {
+			return err
+		}
+		b.log.WithField("retry_in", backoff.String()).Warnf("Failed to write batch: %v", err)
+		if err := utils.Sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,174 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"apatit/internal/exporter"
+)
+
+// fakeClient records written batches, the first failures writes fail.
+type fakeClient struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	batches  [][]*exporter.Sample
+	written  chan struct{}
+}
+
+func newFakeClient(failures int) *fakeClient {
+	return &fakeClient{failures: failures, written: make(chan struct{}, 100)}
+}
+
+func (c *fakeClient) Write(ctx context.Context, samples []*exporter.Sample) error {
+	c.mu.Lock()
+	defer func() {
+		c.mu.Unlock()
+		c.written <- struct{}{}
+	}()
+	c.attempts++
+	if c.attempts <= c.failures {
+		return errors.New("storage is unavailable")
+	}
+	c.batches = append(c.batches, samples)
+	return nil
+}
+
+// wait waits for n write attempts.
+func (c *fakeClient) wait(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-c.written:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d write attempts, got %d", n, i)
+		}
+	}
+}
+
+func testSamples(n int) []*exporter.Sample {
+	samples := make([]*exporter.Sample, 0, n)
+	for i := 0; i < n; i++ {
+		samples = append(samples, testSample("1001", "site", strconv.Itoa(i), "MP", 1700000000+int64(i)))
+	}
+	return samples
+}
+
+// runBatcher runs the batcher until the test is finished.
+func runBatcher(t *testing.T, b *Batcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestBatcherBatches(t *testing.T) {
+	c := newFakeClient(0)
+	b := NewBatcher("test_batches", c, &BatchConfig{Size: 2, FlushInterval: time.Hour})
+	runBatcher(t, b)
+
+	samples := testSamples(5)
+	if err := b.Push(samples); err != nil {
+		t.Fatal(err)
+	}
+	// a full batch wakes the sink up before the flush interval, and the whole buffer is written in batches
+	c.wait(t, 3)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.batches) != 3 || len(c.batches[0]) != 2 || len(c.batches[1]) != 2 || len(c.batches[2]) != 1 {
+		t.Fatalf("expected batches of 2, 2 and 1 samples, got %v", c.batches)
+	}
+	if c.batches[0][0] != samples[0] || c.batches[1][1] != samples[3] || c.batches[2][0] != samples[4] {
+		t.Error("expected samples to be written in order")
+	}
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	c := newFakeClient(0)
+	b := NewBatcher("test_flush", c, &BatchConfig{Size: 10, FlushInterval: 10 * time.Millisecond})
+	runBatcher(t, b)
+
+	if err := b.Push(testSamples(3)); err != nil {
+		t.Fatal(err)
+	}
+	c.wait(t, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.batches) != 1 || len(c.batches[0]) != 3 {
+		t.Fatalf("expected a batch of 3 samples, got %v", c.batches)
+	}
+}
+
+func TestBatcherRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		maxRetries int
+		written    int
+		writeErrs  float64
+		drops      float64
+	}{
+		{name: "test_retry", failures: 1, maxRetries: 1, written: 1, writeErrs: 1},
+		{name: "test_drop", failures: 2, maxRetries: 0, written: 0, writeErrs: 1, drops: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeErrs := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues(tt.name, "write", "", ""))
+			drops := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues(tt.name, "drop", "", ""))
+			c := newFakeClient(tt.failures)
+			b := NewBatcher(tt.name, c, &BatchConfig{Size: 1, FlushInterval: time.Hour, MaxRetries: tt.maxRetries})
+			runBatcher(t, b)
+
+			if err := b.Push(testSamples(1)); err != nil {
+				t.Fatal(err)
+			}
+			c.wait(t, tt.maxRetries+1)
+			// the counters are updated right after the attempt
+			time.Sleep(10 * time.Millisecond)
+
+			c.mu.Lock()
+			written := len(c.batches)
+			c.mu.Unlock()
+			if written != tt.written {
+				t.Errorf("expected %d written batches, got %d", tt.written, written)
+			}
+			if got := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues(tt.name, "write", "", "")) - writeErrs; got != tt.writeErrs {
+				t.Errorf("expected %v write errors, got %v", tt.writeErrs, got)
+			}
+			if got := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues(tt.name, "drop", "", "")) - drops; got != tt.drops {
+				t.Errorf("expected %v drops, got %v", tt.drops, got)
+			}
+		})
+	}
+}
+
+func TestBatcherBufferLimit(t *testing.T) {
+	drops := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues("test_buffer", "drop", "", ""))
+	b := NewBatcher("test_buffer", newFakeClient(0), &BatchConfig{Size: 1, FlushInterval: time.Hour})
+
+	samples := testSamples(maxBufferedBatches + 5)
+	if err := b.Push(samples); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(exporter.EErrorsTotal.WithLabelValues("test_buffer", "drop", "", "")) - drops; got != 1 {
+		t.Errorf("expected 1 drop, got %v", got)
+	}
+	// the oldest samples are dropped
+	if len(b.buffer) != maxBufferedBatches || b.buffer[0] != samples[5] {
+		t.Errorf("expected the buffer to keep the latest %d samples, got %d", maxBufferedBatches, len(b.buffer))
+	}
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"apatit/internal/exporter"
+)
+
+// GraphiteConfig is the Graphite plaintext protocol configuration.
+type GraphiteConfig struct {
+	// Address is the carbon plaintext TCP address, e.g. graphite:2003
+	Address string
+	// Prefix is the prefix of metric paths
+	Prefix  string
+	Timeout time.Duration
+}
+
+// Graphite writes samples with the plaintext protocol over TCP.
+// Metric paths are '<prefix>.<task_id>.<mp_id>.<metric>', as names may contain any characters.
+type Graphite struct {
+	conf   *GraphiteConfig
+	dialer *net.Dialer
+}
+
+// NewGraphite creates a Graphite client.
+func NewGraphite(conf *GraphiteConfig) (*Graphite, error) {
+	if _, _, err := net.SplitHostPort(conf.Address); err != nil {
+		return nil, fmt.Errorf("invalid Graphite address '%s': %w", conf.Address, err)
+	}
+	return &Graphite{
+		conf:   conf,
+		dialer: &net.Dialer{Timeout: conf.Timeout},
+	}, nil
+}
+
+// Write implements Client, a connection is opened for each batch.
+func (g *Graphite) Write(ctx context.Context, samples []*exporter.Sample) error {
+	var body bytes.Buffer
+	for _, sample := range samples {
+		path := graphitePath(g.conf.Prefix, sample.Labels[exporter.LabelTaskID], sample.Labels[exporter.LabelMPID])
+		ts := strconv.FormatInt(sample.Result.Timestamp, 10)
+		for _, m := range exporter.Measurements {
+			fmt.Fprintf(&body, "%s.%s %s %s\n", path, m.Field, strconv.FormatFloat(m.Value(sample.Result), 'g', -1, 64), ts)
+		}
+	}
+
+	conn, err := g.dialer.DialContext(ctx, "tcp", g.conf.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(g.conf.Timeout)); err != nil {
+		return err
+	}
+	_, err = body.WriteTo(conn)
+	return err
+}
+
+// graphiteWhitespaceReplacer replaces characters which break plaintext protocol lines
+var graphiteWhitespaceReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// graphitePath joins the prefix and non-empty path nodes. The prefix may have several dot-separated nodes,
+// while dots in the other nodes are replaced, and so is whitespace in any of them.
+func graphitePath(prefix string, nodes ...string) string {
+	path := make([]string, 0, len(nodes)+1)
+	if prefix = strings.Trim(graphiteWhitespaceReplacer.Replace(prefix), "."); prefix != "" {
+		path = append(path, prefix)
+	}
+	for _, node := range nodes {
+		if node = strings.ReplaceAll(graphiteWhitespaceReplacer.Replace(node), ".", "_"); node != "" {
+			path = append(path, node)
+		}
+	}
+	return strings.Join(path, ".")
+}
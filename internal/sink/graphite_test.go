@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"apatit/internal/exporter"
+)
+
+func TestGraphitePath(t *testing.T) {
+	tests := []struct {
+		prefix string
+		nodes  []string
+		want   string
+	}{
+		{prefix: "apatit", nodes: []string{"1001", "1"}, want: "apatit.1001.1"},
+		{prefix: "monitoring.apatit", nodes: []string{"1001", "1"}, want: "monitoring.apatit.1001.1"},
+		{prefix: ".apatit.", nodes: []string{"1001", "1"}, want: "apatit.1001.1"},
+		{prefix: "", nodes: []string{"1001", "1"}, want: "1001.1"},
+		{prefix: "apatit", nodes: []string{"10.01", "mp 1"}, want: "apatit.10_01.mp_1"},
+		{prefix: "my apatit", nodes: []string{"1001\n", "\t1"}, want: "my_apatit.1001_._1"},
+		{prefix: "apatit", nodes: []string{"", "1"}, want: "apatit.1"},
+	}
+	for _, tt := range tests {
+		if got := graphitePath(tt.prefix, tt.nodes...); got != tt.want {
+			t.Errorf("graphitePath(%q, %q) = %q, want %q", tt.prefix, tt.nodes, got, tt.want)
+		}
+	}
+}
+
+func TestGraphiteWrite(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	graphite, err := NewGraphite(&GraphiteConfig{Address: ln.Addr().String(), Prefix: "monitoring.apatit", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []*exporter.Sample{
+		testSample("1001", "Main site", "1", "Moscow", 1700000000),
+		testSample("1001", "Main site", "2", "Frankfurt", 1700000180),
+	}
+	if err := graphite.Write(context.Background(), samples); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// the data timestamps are kept
+	want := "monitoring.apatit.1001.1.connect_seconds 0.012 1700000000\n" +
+		"monitoring.apatit.1001.1.dns_lookup_seconds 0.004 1700000000\n" +
+		"monitoring.apatit.1001.1.server_processing_seconds 0.145 1700000000\n" +
+		"monitoring.apatit.1001.1.total_duration_seconds 0.231 1700000000\n" +
+		"monitoring.apatit.1001.1.speed_bytes_per_second 524288 1700000000\n" +
+		"monitoring.apatit.1001.2.connect_seconds 0.012 1700000180\n" +
+		"monitoring.apatit.1001.2.dns_lookup_seconds 0.004 1700000180\n" +
+		"monitoring.apatit.1001.2.server_processing_seconds 0.145 1700000180\n" +
+		"monitoring.apatit.1001.2.total_duration_seconds 0.231 1700000180\n" +
+		"monitoring.apatit.1001.2.speed_bytes_per_second 524288 1700000180\n"
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("unexpected payload:\n%s\nwant:\n%s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload was not received")
+	}
+}
+
+func TestGraphiteWriteUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	graphite, err := NewGraphite(&GraphiteConfig{Address: address, Prefix: "apatit", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := graphite.Write(context.Background(), []*exporter.Sample{testSample("1001", "site", "1", "Moscow", 1700000000)}); err == nil {
+		t.Error("expected an error writing to a closed port")
+	}
+}
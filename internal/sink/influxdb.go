@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"apatit/internal/exporter"
+	"apatit/internal/version"
+)
+
+// influxMeasurement is the InfluxDB measurement of MP samples
+const influxMeasurement = "apatit_mp"
+
+// InfluxDBConfig is the InfluxDB HTTP write API configuration.
+type InfluxDBConfig struct {
+	// URL is the base InfluxDB URL, e.g. http://influxdb:8086
+	URL string
+	// Version is the write API version: 1 (/write) or 2 (/api/v2/write)
+	Version int
+	// Database is the database (v1) or bucket (v2)
+	Database string
+	// Org is the organization (v2 only)
+	Org string
+	// Token is the API token (v2) or 'username:password' (v1), optional
+	Token   string
+	Timeout time.Duration
+}
+
+// InfluxDB writes samples in line protocol with the HTTP write API.
+// Each sample is a point of the apatit_mp measurement with MP labels as tags
+// and measurement metrics as fields, with the original data timestamp.
+type InfluxDB struct {
+	writeURL   string
+	conf       *InfluxDBConfig
+	httpClient *http.Client
+}
+
+// NewInfluxDB creates an InfluxDB client.
+func NewInfluxDB(conf *InfluxDBConfig) (*InfluxDB, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid InfluxDB URL '%s': must be an absolute http(s) URL", conf.URL)
+	}
+	if conf.Database == "" {
+		return nil, fmt.Errorf("InfluxDB database (bucket) is required")
+	}
+
+	query := url.Values{}
+	query.Set("precision", "s")
+	switch conf.Version {
+	case 1:
+		u = u.JoinPath("write")
+		query.Set("db", conf.Database)
+	case 2:
+		u = u.JoinPath("api", "v2", "write")
+		query.Set("bucket", conf.Database)
+		query.Set("org", conf.Org)
+	default:
+		return nil, fmt.Errorf("unsupported InfluxDB API version %d, must be 1 or 2", conf.Version)
+	}
+	u.RawQuery = query.Encode()
+
+	return &InfluxDB{
+		writeURL:   u.String(),
+		conf:       conf,
+		httpClient: &http.Client{Timeout: conf.Timeout},
+	}, nil
+}
+
+// Write implements Client.
+func (i *InfluxDB) Write(ctx context.Context, samples []*exporter.Sample) error {
+	var body bytes.Buffer
+	for _, sample := range samples {
+		writeInfluxLine(&body, sample)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.writeURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", version.Name, version.Version))
+	if i.conf.Token != "" {
+		if i.conf.Version == 1 {
+			username, password, _ := strings.Cut(i.conf.Token, ":")
+			req.SetBasicAuth(username, password)
+		} else {
+			req.Header.Set("Authorization", "Token "+i.conf.Token)
+		}
+	}
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// writeInfluxLine writes the sample as a line protocol point.
+func writeInfluxLine(b *bytes.Buffer, sample *exporter.Sample) {
+	b.WriteString(influxMeasurement)
+
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// empty tag values are not allowed
+		if sample.Labels[name] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(escapeInfluxTag(name))
+		b.WriteByte('=')
+		b.WriteString(escapeInfluxTag(sample.Labels[name]))
+	}
+
+	for i, m := range exporter.Measurements {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(m.Field)
+		b.WriteByte('=')
+		b.WriteString(strconv.FormatFloat(m.Value(sample.Result), 'g', -1, 64))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(sample.Result.Timestamp, 10))
+	b.WriteByte('\n')
+}
+
+// influxTagReplacer escapes tag keys and values of line protocol
+var influxTagReplacer = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+func escapeInfluxTag(s string) string {
+	return influxTagReplacer.Replace(s)
+}
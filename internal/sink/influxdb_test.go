@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"apatit/internal/client"
+	"apatit/internal/exporter"
+)
+
+// testSample returns an MP sample of the task with the data timestamp.
+func testSample(taskID, taskName, mpID, mpName string, timestamp int64) *exporter.Sample {
+	return &exporter.Sample{
+		Labels: prometheus.Labels{
+			exporter.LabelTaskID:   taskID,
+			exporter.LabelTaskName: taskName,
+			exporter.LabelMPID:     mpID,
+			exporter.LabelMPName:   mpName,
+			exporter.LabelMPGPS:    "",
+		},
+		Result: &client.MonitoringPointConnectionResult{
+			Connect: 0.012, DNS: 0.004, Server: 0.145, Total: 0.231, Speed: 524288, Timestamp: timestamp,
+		},
+	}
+}
+
+func TestInfluxDBWrite(t *testing.T) {
+	samples := []*exporter.Sample{
+		testSample("1001", "Main site, EU", "1", `Mos=cow\`, 1700000000),
+		testSample("1001", "Main site, EU", "2", "Frankfurt am Main", 1700000180),
+	}
+	// tags are sorted, empty ones are skipped, the data timestamps are kept
+	wantBody := `apatit_mp,mp_id=1,mp_name=Mos\=cow\\,task_id=1001,task_name=Main\ site\,\ EU ` +
+		`connect_seconds=0.012,dns_lookup_seconds=0.004,server_processing_seconds=0.145,total_duration_seconds=0.231,speed_bytes_per_second=524288 1700000000` + "\n" +
+		`apatit_mp,mp_id=2,mp_name=Frankfurt\ am\ Main,task_id=1001,task_name=Main\ site\,\ EU ` +
+		`connect_seconds=0.012,dns_lookup_seconds=0.004,server_processing_seconds=0.145,total_duration_seconds=0.231,speed_bytes_per_second=524288 1700000180` + "\n"
+
+	tests := []struct {
+		name      string
+		conf      *InfluxDBConfig
+		wantPath  string
+		wantQuery string
+		checkAuth func(t *testing.T, r *http.Request)
+	}{
+		{
+			name:      "v1",
+			conf:      &InfluxDBConfig{Version: 1, Database: "apatit", Token: "user:secret"},
+			wantPath:  "/influx/write",
+			wantQuery: "db=apatit&precision=s",
+			checkAuth: func(t *testing.T, r *http.Request) {
+				if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "secret" {
+					t.Errorf("expected basic auth user:secret, got %q", r.Header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name:      "v2",
+			conf:      &InfluxDBConfig{Version: 2, Database: "bucket", Org: "acme", Token: "token"},
+			wantPath:  "/influx/api/v2/write",
+			wantQuery: "bucket=bucket&org=acme&precision=s",
+			checkAuth: func(t *testing.T, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Token token" {
+					t.Errorf("expected token auth, got %q", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != tt.wantPath || r.URL.RawQuery != tt.wantQuery {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL)
+				}
+				tt.checkAuth(t, r)
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != wantBody {
+					t.Errorf("unexpected body:\n%s\nwant:\n%s", body, wantBody)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			tt.conf.URL = srv.URL + "/influx"
+			tt.conf.Timeout = time.Second
+			influx, err := NewInfluxDB(tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := influx.Write(context.Background(), samples); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestInfluxDBWriteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"database not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	influx, err := NewInfluxDB(&InfluxDBConfig{URL: srv.URL, Version: 1, Database: "apatit", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = influx.Write(context.Background(), []*exporter.Sample{testSample("1001", "site", "1", "Moscow", 1700000000)})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "database not found") {
+		t.Errorf("expected an error with the status code and response, got %v", err)
+	}
+}
+
+func TestNewInfluxDBValidation(t *testing.T) {
+	for _, conf := range []*InfluxDBConfig{
+		{URL: "influxdb:8086", Version: 1, Database: "apatit"},
+		{URL: "http://influxdb:8086", Version: 1},
+		{URL: "http://influxdb:8086", Version: 3, Database: "apatit"},
+	} {
+		if _, err := NewInfluxDB(conf); err == nil {
+			t.Errorf("expected an error for %+v", conf)
+		}
+	}
+}
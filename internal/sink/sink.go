@@ -0,0 +1,28 @@
+// Package sink contains outputs which receive new MP samples from the metrics pipeline.
+package sink
+
+import (
+	"context"
+
+	"apatit/internal/exporter"
+)
+
+// Sink receives new MP samples of every refresh (with their original timestamps) and delivers them somewhere.
+type Sink interface {
+	// Push accepts samples for delivery, it must not block on the delivery itself.
+	Push(samples []*exporter.Sample) error
+	// Run delivers accepted samples until ctx is done.
+	Run(ctx context.Context)
+}
+
+// OutageSink is a sink which also records MP outages of every refresh, e.g. the local history.
+// Outages have no measurements, so they are not pushed to the other sinks.
+type OutageSink interface {
+	// PushOutages accepts outages of MPs without a measurement at refresh time.
+	PushOutages(outages []*exporter.Outage) error
+}
+
+// Client writes a batch of samples to a storage.
+type Client interface {
+	Write(ctx context.Context, samples []*exporter.Sample) error
+}
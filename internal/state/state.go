@@ -0,0 +1,107 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/client"
+)
+
+// fileName is the name of the state file within the state directory.
+const fileName = "state.json"
+
+// State is the last good data received from the API, it lets a restarted exporter serve it
+// until the first refresh cycles are finished.
+type State struct {
+	SavedAt time.Time `json:"saved_at"`
+	// MPs is monitoring points info of the last complete metrics cycle
+	MPs []*client.MonitoringPointInfo `json:"mps,omitempty"`
+	// Entries is MP data of the last successful refresh by task ID
+	Entries map[int][]*client.MonitoringPointEntry `json:"entries,omitempty"`
+	// Tasks is all tasks info of the last successful stats cycle
+	Tasks []*client.TaskInfo `json:"tasks,omitempty"`
+	// TaskData is the /stats response of the last complete stats cycle
+	TaskData json.RawMessage `json:"task_data,omitempty"`
+}
+
+// Store keeps the state in a file of the state directory.
+type Store struct {
+	path  string
+	log   *logrus.Entry
+	mu    sync.Mutex
+	state *State
+}
+
+// Open creates the state directory if needed and loads the saved state.
+// A missing or broken state file results in an empty state.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	s := &Store{
+		path:  filepath.Join(dir, fileName),
+		log:   logrus.WithField("component", "state"),
+		state: &State{},
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		// the state is an optimization only, so a broken file is replaced on the next save
+		s.log.WithField("error", err).Warn("Failed to decode state file, starting without state")
+		return s, nil
+	}
+	s.state = state
+	s.log.WithField("saved_at", state.SavedAt).Info("State loaded")
+	return s, nil
+}
+
+// State returns the loaded state, it must not be modified.
+// SavedAt is zero if there is no saved state.
+func (s *Store) State() *State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Update applies fn to a copy of the state and saves it, the state file is replaced atomically.
+func (s *Store) Update(fn func(state *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := *s.state
+	fn(&state)
+	state.SavedAt = time.Now()
+
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	s.state = &state
+	return nil
+}
@@ -0,0 +1,137 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"apatit/internal/client"
+)
+
+// dirFiles returns names of the files in the directory.
+func dirFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.State().SavedAt.IsZero() {
+		t.Fatal("expected an empty state without a state file")
+	}
+
+	mps := []*client.MonitoringPointInfo{{ID: "1", Name: "Moscow", IP: "192.0.2.1", Status: 1}}
+	entries := map[int][]*client.MonitoringPointEntry{1001: {{
+		ID:     "1",
+		Name:   "Moscow",
+		Status: 1,
+		Result: []*client.MonitoringPointConnectionResult{{Connect: 0.012, Total: 0.231, Speed: 524288, Timestamp: 1700000000}},
+	}}}
+	tasks := []*client.TaskInfo{{ID: 1001, ServiceName: "Main site", EnabledStatus: 1}}
+	taskData := json.RawMessage(`[{"task_id":"1001"}]`)
+
+	if err := store.Update(func(st *State) {
+		st.MPs = mps
+		st.Entries = entries
+	}); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	// updates keep the other fields
+	if err := store.Update(func(st *State) {
+		st.Tasks = tasks
+		st.TaskData = taskData
+	}); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	saved := store.State()
+
+	loaded, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := loaded.State()
+	if !st.SavedAt.Equal(saved.SavedAt) {
+		t.Errorf("saved at %s, loaded %s", saved.SavedAt, st.SavedAt)
+	}
+	if !reflect.DeepEqual(st.MPs, mps) || !reflect.DeepEqual(st.Entries, entries) || !reflect.DeepEqual(st.Tasks, tasks) {
+		t.Errorf("loaded state differs from the saved one: %+v", st)
+	}
+	if string(st.TaskData) != string(taskData) {
+		t.Errorf("loaded task data %s, want %s", st.TaskData, taskData)
+	}
+}
+
+func TestStoreCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte(`{"saved_at": "2026-01-01T00:00:00Z", "mps": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("expected a corrupt state file to be ignored, got %v", err)
+	}
+	if st := store.State(); !st.SavedAt.IsZero() || st.MPs != nil {
+		t.Errorf("expected an empty state, got %+v", st)
+	}
+
+	// the corrupt file is replaced on the next save
+	if err := store.Update(func(st *State) { st.Tasks = []*client.TaskInfo{{ID: 1001}} }); err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+	loaded, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := loaded.State(); len(st.Tasks) != 1 {
+		t.Errorf("expected the saved state to replace the corrupt one, got %+v", st)
+	}
+}
+
+func TestStoreUpdateLeavesNoPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Update(func(st *State) { st.Tasks = []*client.TaskInfo{{ID: 1001 + i}} }); err != nil {
+			t.Fatalf("failed to save state: %v", err)
+		}
+	}
+	if files := dirFiles(t, dir); !reflect.DeepEqual(files, []string{fileName}) {
+		t.Errorf("expected only the state file after saves, got %v", files)
+	}
+
+	// the state file can't be replaced by a directory, so the save fails after the temporary file is written
+	failing, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(failing.path, "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := failing.Update(func(st *State) { st.Tasks = []*client.TaskInfo{{ID: 1001}} }); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if files := dirFiles(t, filepath.Dir(failing.path)); !reflect.DeepEqual(files, []string{fileName}) {
+		t.Errorf("expected no temporary file after a failed save, got %v", files)
+	}
+	if st := failing.State(); len(st.Tasks) != 0 {
+		t.Errorf("expected the state to be kept after a failed save, got %+v", st)
+	}
+}
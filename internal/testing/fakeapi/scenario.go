@@ -0,0 +1,125 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Scenario describes the account state served by the fake API and its misbehaviour knobs.
+type Scenario struct {
+	// APIKey is an accepted API key, any key is accepted if empty
+	APIKey string `json:"api_key"`
+	// Latency is added to every response
+	Latency Duration `json:"latency"`
+	// ErrorRate is a share (0..1) of requests answered with 503 Service Unavailable
+	ErrorRate float64 `json:"error_rate"`
+	// RateLimit emulates the API requests limit
+	RateLimit RateLimit `json:"rate_limit"`
+	// StaleOffset shifts all data timestamps into the past
+	StaleOffset Duration `json:"stale_offset"`
+	// DataStep is the time between data points, 3m by default
+	DataStep Duration `json:"data_step"`
+
+	MPs   []*MP   `json:"mps"`
+	Tasks []*Task `json:"tasks"`
+}
+
+// RateLimit emulates the API requests limit.
+type RateLimit struct {
+	// MaxRequestsPerSecond is a number of allowed requests per second, zero disables the limit
+	MaxRequestsPerSecond int `json:"max_requests_per_second"`
+	// Payload makes limited requests return HTTP 200 with an error payload instead of 429
+	Payload bool `json:"payload"`
+}
+
+// MP is a monitoring point.
+type MP struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+	GPS  string `json:"gps"`
+	// Down marks MP as unavailable: it has zero status and reports no data
+	Down bool `json:"down"`
+}
+
+// Task is a monitoring task.
+type Task struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	Up      bool   `json:"up"`
+	// Blacklisted and Virus set the corresponding task statuses
+	Blacklisted bool `json:"blacklisted"`
+	Virus       bool `json:"virus"`
+	// Period is a check period in minutes
+	Period int `json:"period"`
+	// Uptime is a share (0..1) of the time the task was available
+	Uptime float64 `json:"uptime"`
+	// MPs is a list of MP IDs that check the task, all MPs are used if empty
+	MPs []string `json:"mps"`
+	// Graph is a template for task_graph_stat data points
+	Graph Graph `json:"graph"`
+	// Logs are task_stat events
+	Logs []*Log `json:"logs"`
+}
+
+// Graph is a template for task_graph_stat data points.
+type Graph struct {
+	Connect float64 `json:"connect"`
+	DNS     float64 `json:"dns"`
+	Server  float64 `json:"server"`
+	Total   float64 `json:"total"`
+	Speed   int64   `json:"speed"`
+	// Age is an age of the latest data point
+	Age Duration `json:"age"`
+}
+
+// Log is a task_stat event.
+type Log struct {
+	// Age is an age of the event at the server start
+	Age         Duration `json:"age"`
+	MPID        string   `json:"mp_id"`
+	Status      int      `json:"status"`
+	Description string   `json:"description"`
+	Traceroute  string   `json:"traceroute"`
+}
+
+// Duration is a time.Duration decoded from a string like "3m".
+type Duration time.Duration
+
+// UnmarshalJSON decodes duration from a JSON string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON encodes duration as a JSON string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadScenario reads a scenario from the JSON file.
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	scenario := &Scenario{}
+	if err := json.Unmarshal(file, scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file: %w", err)
+	}
+	return scenario, nil
+}
@@ -0,0 +1,389 @@
+// Package fakeapi is a Ping-Admin API simulator for local development and tests.
+// It serves the 'a=api' endpoints APATIT uses ('tasks', 'tm', 'task_stat', 'task_graph_stat')
+// from a Scenario and can emulate latency, 5xx errors, rate limits, stale data and MPs going down.
+package fakeapi
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"apatit/internal/client"
+)
+
+const (
+	defaultDataStep = 3 * time.Minute
+	// apiTimeLayout is a datetime layout used by Ping-Admin API
+	apiTimeLayout = "2006-01-02 15:04:05"
+)
+
+// apiTimeLocation is a time zone of Ping-Admin API datetimes (Moscow time)
+var apiTimeLocation = time.FixedZone("MSK", 3*60*60)
+
+// Server is a fake Ping-Admin API server.
+// It implements http.Handler, so it can be used with net/http/httptest.
+type Server struct {
+	mu       sync.Mutex
+	scenario *Scenario
+	requests map[string]int
+	recent   []time.Time // requests within the last second, for the rate limit emulation
+	now      func() time.Time
+	started  time.Time
+}
+
+// New creates a new fake API server for the scenario.
+func New(scenario *Scenario) *Server {
+	return &Server{
+		scenario: scenario,
+		requests: make(map[string]int),
+		now:      time.Now,
+		started:  time.Now(),
+	}
+}
+
+// SetLatency changes the latency added to every response.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.Latency = Duration(latency)
+}
+
+// SetErrorRate changes the share (0..1) of requests answered with 503 Service Unavailable.
+func (s *Server) SetErrorRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.ErrorRate = rate
+}
+
+// SetClock replaces the clock of data timestamps, e.g. to freeze them in tests.
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// SetRateLimit changes the API requests limit emulation.
+func (s *Server) SetRateLimit(limit RateLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.RateLimit = limit
+}
+
+// SetStaleOffset shifts all data timestamps into the past.
+func (s *Server) SetStaleOffset(offset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario.StaleOffset = Duration(offset)
+}
+
+// SetMPDown marks MP as unavailable (or available again).
+func (s *Server) SetMPDown(mpID string, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mp := range s.scenario.MPs {
+		if mp.ID == mpID {
+			mp.Down = down
+		}
+	}
+}
+
+// AddEvent adds a new task_stat event happened now, it becomes the latest event of the task.
+func (s *Server) AddEvent(taskID int, mpID string, status int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range s.scenario.Tasks {
+		if task.ID == taskID {
+			event := &Log{
+				Age:         Duration(s.started.Sub(s.now())),
+				MPID:        mpID,
+				Status:      status,
+				Description: description,
+			}
+			task.Logs = append([]*Log{event}, task.Logs...)
+		}
+	}
+}
+
+// Requests returns the number of requests received for the 'sa' API method.
+func (s *Server) Requests(sa string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[sa]
+}
+
+// ServeHTTP handles '/?a=api&sa=...' requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sa := query.Get("sa")
+
+	log := logrus.WithFields(logrus.Fields{"component": "fakeapi", "sa": sa})
+	log.Debug("Request received")
+
+	s.mu.Lock()
+	s.requests[sa]++
+	latency := time.Duration(s.scenario.Latency)
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path != "/" || query.Get("a") != "api" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.scenario.APIKey != "" && query.Get("api_key") != s.scenario.APIKey {
+		writeJSON(w, map[string]string{"error": "Wrong API key"})
+		return
+	}
+
+	if s.scenario.ErrorRate > 0 && rand.Float64() < s.scenario.ErrorRate {
+		log.Debug("Emulating upstream error")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.rateLimited() {
+		log.Debug("Emulating rate limit")
+		if s.scenario.RateLimit.Payload {
+			writeJSON(w, map[string]string{"error": "Too many requests"})
+			return
+		}
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	switch sa {
+	case "tasks":
+		writeJSON(w, s.tasks())
+	case "tm":
+		writeJSON(w, s.mps())
+	case "task_graph_stat", "task_stat":
+		task := s.task(query.Get("id"))
+		if task == nil {
+			writeJSON(w, map[string]string{"error": "Task not found"})
+			return
+		}
+		if sa == "task_stat" {
+			writeJSON(w, s.taskStat(task))
+			return
+		}
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 1
+		}
+		writeJSON(w, s.taskGraphStat(task, limit))
+	default:
+		writeJSON(w, map[string]string{"error": "Unknown method"})
+	}
+}
+
+// rateLimited checks and records the request against the rate limit emulation.
+func (s *Server) rateLimited() bool {
+	limit := s.scenario.RateLimit.MaxRequestsPerSecond
+	if limit <= 0 {
+		return false
+	}
+
+	now := s.now()
+	recent := s.recent[:0]
+	for _, t := range s.recent {
+		if now.Sub(t) < time.Second {
+			recent = append(recent, t)
+		}
+	}
+	s.recent = recent
+
+	if len(s.recent) >= limit {
+		return true
+	}
+	s.recent = append(s.recent, now)
+	return false
+}
+
+func (s *Server) task(idStr string) *Task {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil
+	}
+	for _, task := range s.scenario.Tasks {
+		if task.ID == id {
+			return task
+		}
+	}
+	return nil
+}
+
+func (s *Server) mp(id string) *MP {
+	for _, mp := range s.scenario.MPs {
+		if mp.ID == id {
+			return mp
+		}
+	}
+	return nil
+}
+
+// taskMPs returns MPs that check the task.
+func (s *Server) taskMPs(task *Task) []*MP {
+	if len(task.MPs) == 0 {
+		return s.scenario.MPs
+	}
+	mps := make([]*MP, 0, len(task.MPs))
+	for _, id := range task.MPs {
+		if mp := s.mp(id); mp != nil {
+			mps = append(mps, mp)
+		}
+	}
+	return mps
+}
+
+// dataTime returns the time of the data with the given age with stale offset applied.
+func (s *Server) dataTime(age Duration) time.Time {
+	return s.now().Add(-time.Duration(age) - time.Duration(s.scenario.StaleOffset)).In(apiTimeLocation)
+}
+
+// eventTime returns the time of the event with the given age.
+// Events are anchored to the server start, so they are the same in every response.
+func (s *Server) eventTime(age Duration) time.Time {
+	return s.started.Add(-time.Duration(age)).In(apiTimeLocation)
+}
+
+func (s *Server) tasks() []*client.TaskRaw {
+	tasks := make([]*client.TaskRaw, 0, len(s.scenario.Tasks))
+	for _, task := range s.scenario.Tasks {
+		day := int((24 * time.Hour).Seconds())
+		uptimeW := int(float64(day) * task.Uptime)
+
+		lastData := s.dataTime(task.Graph.Age).Format(apiTimeLayout)
+		logData := lastData
+		if len(task.Logs) > 0 {
+			logData = s.eventTime(task.Logs[0].Age).Format(apiTimeLayout)
+		}
+
+		tasks = append(tasks, &client.TaskRaw{
+			Status:          boolToInt(task.Enabled),
+			ID:              task.ID,
+			SName:           task.Name,
+			Address:         task.Address,
+			TaskStatus:      boolToInt(task.Up),
+			BlackListStatus: boolToInt(task.Blacklisted),
+			VirusStatus:     boolToInt(task.Virus),
+			LastData:        lastData,
+			LogData:         logData,
+			Period:          task.Period,
+			PeriodError:     task.Period,
+			Tip:             task.Type,
+			UptimeW:         uptimeW,
+			UptimeNw:        day - uptimeW,
+		})
+	}
+	return tasks
+}
+
+func (s *Server) mps() []*client.MonitoringPointRaw {
+	mps := make([]*client.MonitoringPointRaw, 0, len(s.scenario.MPs))
+	for _, mp := range s.scenario.MPs {
+		mps = append(mps, &client.MonitoringPointRaw{
+			ID:     mp.ID,
+			Name:   mp.Name,
+			IP:     mp.IP,
+			GPS:    mp.GPS,
+			Status: strconv.Itoa(boolToInt(!mp.Down)),
+		})
+	}
+	return mps
+}
+
+func (s *Server) taskGraphStat(task *Task, limit int) []*client.EntryRaw {
+	step := time.Duration(s.scenario.DataStep)
+	if step <= 0 {
+		step = defaultDataStep
+	}
+
+	entries := make([]*client.EntryRaw, 0, len(s.scenario.MPs))
+	for _, mp := range s.taskMPs(task) {
+		entry := &client.EntryRaw{
+			TmID:   mp.ID,
+			TmName: mp.Name,
+			TmRes:  make([]*client.TmResRaw, 0, limit),
+		}
+		if !mp.Down {
+			latest := s.dataTime(task.Graph.Age)
+			for i := 0; i < limit; i++ {
+				entry.TmRes = append(entry.TmRes, &client.TmResRaw{
+					Connect: formatFloat(task.Graph.Connect),
+					DNS:     formatFloat(task.Graph.DNS),
+					Server:  formatFloat(task.Graph.Server),
+					Total:   formatFloat(task.Graph.Total),
+					Speed:   formatInt(task.Graph.Speed),
+					TmStamp: formatInt(latest.Add(-time.Duration(i) * step).Unix()),
+				})
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (s *Server) taskStat(task *Task) []*client.TaskStatRaw {
+	stat := &client.TaskStatRaw{
+		TasksLogs: make([]*client.TasksLogsRaw, 0, len(task.Logs)),
+	}
+	for _, l := range task.Logs {
+		mpName := l.MPID
+		if mp := s.mp(l.MPID); mp != nil {
+			mpName = mp.Name
+		}
+		comment := any(nil)
+		stat.TasksLogs = append(stat.TasksLogs, &client.TasksLogsRaw{
+			Comment:    &comment,
+			Data:       formatString(s.eventTime(l.Age).Format(apiTimeLayout)),
+			Descr:      formatString(l.Description),
+			Status:     &l.Status,
+			Tm:         formatString(mpName),
+			TmID:       formatString(l.MPID),
+			Traceroute: formatString(l.Traceroute),
+		})
+	}
+	return []*client.TaskStatRaw{stat}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithField("component", "fakeapi").Errorf("Failed to write response: %v", err)
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatFloat(f float64) *string {
+	return formatString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func formatInt(i int64) *string {
+	return formatString(strconv.FormatInt(i, 10))
+}
+
+func formatString(s string) *string {
+	return &s
+}
@@ -12,45 +12,52 @@ import (
 )
 
 var (
+	mu               sync.RWMutex
 	locationRusToEng map[string]string
-	once             sync.Once
-	initErr          error
 )
 
-// Init loads the locations file once.
+// Init loads the locations file.
+// It may be called again to reload translations, the loaded ones are kept if the file can't be loaded.
 func Init(filePath string) error {
-	once.Do(func() {
-		log := logrus.WithFields(logrus.Fields{
-			"component": "translator",
-			"path":      filePath,
-		})
-		log.Info("Loading translations...")
-
-		file, err := os.ReadFile(filePath)
-		if err != nil {
-			initErr = fmt.Errorf("failed to read translations file: %w", err)
-			log.Error(initErr)
-			return
-		}
-
-		if err = json.Unmarshal(file, &locationRusToEng); err != nil {
-			initErr = fmt.Errorf("failed to parse translations file: %w", err)
-			log.Error(initErr)
-			return
-		}
-		log.Info("Translations loaded successfully.")
+	log := logrus.WithFields(logrus.Fields{
+		"component": "translator",
+		"path":      filePath,
 	})
+	log.Info("Loading translations...")
 
-	return initErr
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read translations file: %w", err)
+		log.Error(err)
+		return err
+	}
+
+	translations := make(map[string]string)
+	if err = json.Unmarshal(file, &translations); err != nil {
+		err = fmt.Errorf("failed to parse translations file: %w", err)
+		log.Error(err)
+		return err
+	}
+
+	mu.Lock()
+	locationRusToEng = translations
+	mu.Unlock()
+
+	log.Info("Translations loaded successfully.")
+	return nil
 }
 
 // GetEngLocation returns Monitoring Point name in English
 func GetEngLocation(rus string) string {
-	if initErr != nil {
+	mu.RLock()
+	translations := locationRusToEng
+	mu.RUnlock()
+
+	if translations == nil {
 		return rus
 	}
 
-	if val, ok := locationRusToEng[rus]; ok {
+	if val, ok := translations[rus]; ok {
 		return val
 	}
 
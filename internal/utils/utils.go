@@ -1,19 +1,39 @@
 package utils
 
 import (
+	"context"
 	"math/rand"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// RandomizedPause pauses for a random amount of time in the range [min, 2*min]
-func RandomizedPause(minDuration time.Duration) {
-	if minDuration == time.Duration(0) {
-		return
+// RandomizedPause pauses for a random amount of time in the range [min, 2*min].
+// A pause shorter than a millisecond is not randomized, a negative one is skipped.
+// It returns the context error if the context is done before the pause is over.
+func RandomizedPause(ctx context.Context, minDuration time.Duration) error {
+	if minDuration < time.Millisecond {
+		return Sleep(ctx, minDuration)
 	}
 	pauseRange := minDuration.Milliseconds()
 	timeToSleep := time.Duration(pauseRange+rand.Int63n(pauseRange)) * time.Millisecond
 	logrus.WithField("duration", timeToSleep.String()).Debug("Pausing before next request")
-	time.Sleep(timeToSleep)
+	return Sleep(ctx, timeToSleep)
+}
+
+// Sleep pauses for the given duration or until the context is done.
+// It returns the context error if the context is done first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }